@@ -0,0 +1,551 @@
+package rescript
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrCacheMiss is returned by Cache.Get if there is no entry for a key.
+	ErrCacheMiss = errors.New("cache miss")
+	// ErrCacheCorrupt is returned by Cache.Get if an entry is damaged.
+	ErrCacheCorrupt = errors.New("corrupt cache entry")
+)
+
+const (
+	cacheSuffix  = ".cache"
+	legacySuffix = ".cache.json"
+	tempPattern  = ".tmp-*"
+	statsFile    = "stats.json"
+	cacheHeader  = "rescript-cache v1 sha256:"
+	// tempMaxAge is the age after which a leftover temp file is removed.
+	tempMaxAge = time.Hour
+	// pruneLowWater is the part of the maximum size that is kept
+	// when a cache is pruned after a write,
+	// so that the next writes do not evict entries again.
+	pruneLowWater = 0.9
+	// pruneEvery is the number of writes after which
+	// a FileCache checks for expired entries.
+	pruneEvery = 100
+)
+
+var cacheKeyRe = regexp.MustCompile(`^[0-9A-Za-z_-]+$`)
+
+// ResultCache stores recognition results by key.
+//
+// Keys for results are derived from the request, see Request.checksum,
+// so these entries never need to be updated.
+// Other entries, like the state of a page (see pageKey), are replaced
+// with each recognition; Put must replace an existing entry.
+// The results are stored as JSON.
+type ResultCache interface {
+	// Get returns the data for the given key.
+	// It returns ErrCacheMiss if there is no entry
+	// and ErrCacheCorrupt if the entry is damaged.
+	Get(key string) ([]byte, error)
+	// Put stores data under the given key,
+	// replacing an existing entry.
+	Put(key string, data []byte) error
+}
+
+// Cache is a ResultCache that can be inspected and maintained.
+//
+// FileCache keeps one file per entry, KVCache keeps all entries
+// in a single file.
+type Cache interface {
+	ResultCache
+	// Each calls f for each entry.
+	Each(f func(key string, data []byte) error) error
+	// Stats returns information about the entries and the use of the cache.
+	Stats() (CacheStats, error)
+	// Prune removes entries that exceed the limits of the cache
+	// and returns the number of removed entries.
+	Prune() (int, error)
+	// Clear removes all entries.
+	Clear() error
+	// Close saves the statistics.
+	Close() error
+}
+
+// CacheStats holds information about a cache.
+type CacheStats struct {
+	// Entries is the number of entries.
+	Entries int
+	// Size is the total size of all entries in bytes.
+	Size int64
+	// Oldest and Newest are the times an entry was last used.
+	Oldest time.Time
+	Newest time.Time
+	// Hits, Misses, Corrupt and Evicted count the use of the cache
+	// since it was created or cleared.
+	Hits    int64
+	Misses  int64
+	Corrupt int64
+	Evicted int64
+}
+
+// cacheCounters are the saved statistics of a FileCache.
+type cacheCounters struct {
+	Hits    int64 `json:"hits"`
+	Misses  int64 `json:"misses"`
+	Corrupt int64 `json:"corrupt"`
+	Evicted int64 `json:"evicted"`
+}
+
+func (c *cacheCounters) add(o cacheCounters) {
+	c.Hits += o.Hits
+	c.Misses += o.Misses
+	c.Corrupt += o.Corrupt
+	c.Evicted += o.Evicted
+}
+
+// CacheLimits restrict the size of a cache.
+// A zero value means no limit.
+type CacheLimits struct {
+	// MaxSize is the maximum total size of all entries in bytes.
+	MaxSize int64
+	// MaxAge is the maximum time since an entry was last used.
+	MaxAge time.Duration
+}
+
+// FileCache is a Cache that keeps one file per entry in a directory.
+//
+// Files are written atomically, so a crash cannot leave a partial entry.
+// Each file includes a checksum over the data which is verified on read.
+// Entries that exceed the limits are evicted on write,
+// least recently used first.
+type FileCache struct {
+	dir    string
+	limits CacheLimits
+	mx     sync.Mutex
+	// counters since the last call to Close
+	counters cacheCounters
+	// size is the total size of the entries,
+	// known after the first call to prune.
+	size  int64
+	sized bool
+	// writes counts the writes since the last call to prune.
+	writes int
+}
+
+// NewFileCache creates a cache in the given directory.
+// The directory is created with the first entry.
+func NewFileCache(dir string, limits CacheLimits) *FileCache {
+	return &FileCache{
+		dir:    dir,
+		limits: limits,
+	}
+}
+
+// Get reads the entry for the given key.
+//
+// Reading an entry marks it as used.
+// A damaged entry is removed.
+// Entries from older versions are converted when they are read.
+func (c *FileCache) Get(key string) ([]byte, error) {
+	p, err := c.path(key)
+	if err != nil {
+		return nil, err
+	}
+
+	raw, err := ioutil.ReadFile(p)
+	if os.IsNotExist(err) {
+		return c.getLegacy(key)
+	} else if err != nil {
+		return nil, err
+	}
+
+	data, ok := verifyEntry(raw)
+	if !ok {
+		c.count(&c.counters.Corrupt)
+		if os.Remove(p) == nil {
+			c.resize(-int64(len(raw)))
+		}
+		return nil, fmt.Errorf("%w: %v", ErrCacheCorrupt, key)
+	}
+	c.count(&c.counters.Hits)
+
+	// the modification time is the last use, for eviction
+	now := time.Now()
+	os.Chtimes(p, now, now)
+
+	return data, nil
+}
+
+// getLegacy reads an entry from an older version,
+// which holds the JSON data without a checksum,
+// and replaces it with an entry in the current format.
+func (c *FileCache) getLegacy(key string) ([]byte, error) {
+	p := filepath.Join(c.dir, key+legacySuffix)
+	data, err := ioutil.ReadFile(p)
+	if os.IsNotExist(err) {
+		c.count(&c.counters.Misses)
+		return nil, ErrCacheMiss
+	} else if err != nil {
+		return nil, err
+	}
+
+	if !json.Valid(data) {
+		c.count(&c.counters.Corrupt)
+		if os.Remove(p) == nil {
+			c.resize(-int64(len(data)))
+		}
+		return nil, fmt.Errorf("%w: %v", ErrCacheCorrupt, key)
+	}
+	c.count(&c.counters.Hits)
+
+	err = c.Put(key, data)
+	if err == nil && os.Remove(p) == nil {
+		c.resize(-int64(len(data)))
+	}
+	return data, nil
+}
+
+// Put writes the entry for the given key
+// and evicts old entries if the cache exceeds its limits.
+//
+// The size of the cache is kept up to date with each write
+// and checked against the directory only when it exceeds the limit.
+// Expired entries are evicted with the first write
+// and then every pruneEvery writes.
+func (c *FileCache) Put(key string, data []byte) error {
+	p, err := c.path(key)
+	if err != nil {
+		return err
+	}
+
+	err = os.MkdirAll(c.dir, 0755)
+	if err != nil {
+		return err
+	}
+
+	f, err := ioutil.TempFile(c.dir, key+tempPattern)
+	if err != nil {
+		return err
+	}
+	tmp := f.Name()
+	defer os.Remove(tmp)
+
+	sum := sha256.Sum256(data)
+	_, err = f.WriteString(cacheHeader + hex.EncodeToString(sum[:]) + "\n")
+	if err == nil {
+		_, err = f.Write(data)
+	}
+	if err == nil {
+		err = f.Sync()
+	}
+	cerr := f.Close()
+	if err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return fmt.Errorf("failed to write cache entry: %v", err)
+	}
+
+	var replaced int64
+	if info, err := os.Stat(p); err == nil {
+		replaced = info.Size()
+	}
+	err = os.Rename(tmp, p)
+	if err != nil {
+		return fmt.Errorf("failed to write cache entry: %v", err)
+	}
+	size := int64(len(cacheHeader)+hex.EncodedLen(len(sum))+1+len(data)) - replaced
+
+	c.mx.Lock()
+	defer c.mx.Unlock()
+	c.size += size
+	c.writes++
+	if c.limits.MaxSize == 0 && c.limits.MaxAge == 0 {
+		return nil
+	}
+	full := c.limits.MaxSize > 0 && c.size > c.limits.MaxSize
+	expire := c.limits.MaxAge > 0 && c.writes >= pruneEvery
+	if c.sized && !full && !expire {
+		return nil
+	}
+
+	limit := c.limits.MaxSize
+	if full {
+		limit = int64(float64(limit) * pruneLowWater)
+	}
+	_, err = c.prune(limit)
+	return err
+}
+
+// Each calls f for each entry in the cache.
+// Damaged entries are skipped.
+func (c *FileCache) Each(f func(key string, data []byte) error) error {
+	entries, err := c.entries()
+	if err != nil {
+		return err
+	}
+
+	for _, e := range entries {
+		raw, err := ioutil.ReadFile(filepath.Join(c.dir, e.Name()))
+		if err != nil {
+			continue
+		}
+		name := e.Name()
+		var data []byte
+		var ok bool
+		if strings.HasSuffix(name, legacySuffix) {
+			data, ok = raw, json.Valid(raw)
+			name = strings.TrimSuffix(name, legacySuffix)
+		} else {
+			data, ok = verifyEntry(raw)
+			name = strings.TrimSuffix(name, cacheSuffix)
+		}
+		if !ok {
+			continue
+		}
+		err = f(name, data)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Stats returns information about the entries in the cache
+// and the counters from all previous uses.
+func (c *FileCache) Stats() (CacheStats, error) {
+	var s CacheStats
+	saved, err := c.readStats()
+	if err != nil {
+		return s, err
+	}
+
+	c.mx.Lock()
+	saved.add(c.counters)
+	c.mx.Unlock()
+	s.Hits = saved.Hits
+	s.Misses = saved.Misses
+	s.Corrupt = saved.Corrupt
+	s.Evicted = saved.Evicted
+
+	entries, err := c.entries()
+	if err != nil {
+		return s, err
+	}
+	s.Entries = len(entries)
+	for i, e := range entries {
+		s.Size += e.Size()
+		if i == 0 {
+			s.Oldest = e.ModTime()
+		}
+		s.Newest = e.ModTime()
+	}
+
+	return s, nil
+}
+
+// Prune evicts entries that were not used within the maximum age
+// and the least recently used entries until the cache is within its size limit.
+//
+// Entries from older versions count like current entries.
+// Leftover temporary files are removed as well.
+func (c *FileCache) Prune() (int, error) {
+	c.mx.Lock()
+	defer c.mx.Unlock()
+	return c.prune(c.limits.MaxSize)
+}
+
+// prune evicts expired entries and old entries
+// until the cache is within the given size; 0 means no limit.
+// The caller must hold the lock.
+func (c *FileCache) prune(maxSize int64) (int, error) {
+	files, err := ioutil.ReadDir(c.dir)
+	if os.IsNotExist(err) {
+		return 0, nil
+	} else if err != nil {
+		return 0, err
+	}
+	for _, f := range files {
+		name := f.Name()
+		if strings.Contains(name, ".tmp-") && time.Since(f.ModTime()) > tempMaxAge {
+			os.Remove(filepath.Join(c.dir, name))
+		}
+	}
+
+	entries, err := c.entries()
+	if err != nil {
+		return 0, err
+	}
+
+	var total int64
+	for _, e := range entries {
+		total += e.Size()
+	}
+
+	n := 0
+	for _, e := range entries {
+		expired := c.limits.MaxAge > 0 && time.Since(e.ModTime()) > c.limits.MaxAge
+		full := maxSize > 0 && total > maxSize
+		if !expired && !full {
+			// entries are sorted by last use, the rest is newer
+			break
+		}
+		err = os.Remove(filepath.Join(c.dir, e.Name()))
+		if err != nil && !os.IsNotExist(err) {
+			return n, err
+		}
+		total -= e.Size()
+		n++
+	}
+	c.counters.Evicted += int64(n)
+	c.size = total
+	c.sized = true
+	c.writes = 0
+
+	return n, nil
+}
+
+// Clear removes all entries and resets the statistics.
+func (c *FileCache) Clear() error {
+	c.mx.Lock()
+	defer c.mx.Unlock()
+
+	files, err := ioutil.ReadDir(c.dir)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	for _, f := range files {
+		name := f.Name()
+		if strings.HasSuffix(name, cacheSuffix) || strings.HasSuffix(name, legacySuffix) ||
+			strings.Contains(name, ".tmp-") || name == statsFile {
+			err = os.Remove(filepath.Join(c.dir, name))
+			if err != nil && !os.IsNotExist(err) {
+				return err
+			}
+		}
+	}
+	c.counters = cacheCounters{}
+	c.size = 0
+	c.sized = true
+
+	return nil
+}
+
+// Close adds the counters from this session to the saved statistics.
+func (c *FileCache) Close() error {
+	s, err := c.readStats()
+	if err != nil {
+		return err
+	}
+
+	c.mx.Lock()
+	defer c.mx.Unlock()
+
+	if c.counters == (cacheCounters{}) {
+		return nil
+	}
+	s.add(c.counters)
+
+	data, err := json.Marshal(s)
+	if err != nil {
+		return err
+	}
+	err = os.MkdirAll(c.dir, 0755)
+	if err != nil {
+		return err
+	}
+	err = ioutil.WriteFile(filepath.Join(c.dir, statsFile), data, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to write cache stats: %v", err)
+	}
+	c.counters = cacheCounters{}
+
+	return nil
+}
+
+func (c *FileCache) path(key string) (string, error) {
+	if !cacheKeyRe.MatchString(key) {
+		return "", fmt.Errorf("invalid cache key %q", key)
+	}
+	return filepath.Join(c.dir, key+cacheSuffix), nil
+}
+
+func (c *FileCache) count(n *int64) {
+	c.mx.Lock()
+	*n++
+	c.mx.Unlock()
+}
+
+func (c *FileCache) resize(d int64) {
+	c.mx.Lock()
+	c.size += d
+	c.mx.Unlock()
+}
+
+// entries returns the cache files, least recently used first.
+// Entries from older versions are included.
+func (c *FileCache) entries() ([]os.FileInfo, error) {
+	files, err := ioutil.ReadDir(c.dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	entries := files[:0]
+	for _, f := range files {
+		name := f.Name()
+		if f.Mode().IsRegular() && (strings.HasSuffix(name, cacheSuffix) || strings.HasSuffix(name, legacySuffix)) {
+			entries = append(entries, f)
+		}
+	}
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].ModTime().Before(entries[j].ModTime())
+	})
+	return entries, nil
+}
+
+// readStats reads the saved counters.
+func (c *FileCache) readStats() (cacheCounters, error) {
+	var s cacheCounters
+	data, err := ioutil.ReadFile(filepath.Join(c.dir, statsFile))
+	if os.IsNotExist(err) {
+		return s, nil
+	} else if err != nil {
+		return s, err
+	}
+
+	err = json.Unmarshal(data, &s)
+	if err != nil {
+		return s, fmt.Errorf("failed to read cache stats: %v", err)
+	}
+	return s, nil
+}
+
+// verifyEntry checks the header of a cache file
+// and returns the data if it matches the checksum.
+func verifyEntry(raw []byte) ([]byte, bool) {
+	i := bytes.IndexByte(raw, '\n')
+	if i < 0 || !bytes.HasPrefix(raw, []byte(cacheHeader)) {
+		return nil, false
+	}
+	want, err := hex.DecodeString(string(raw[len(cacheHeader):i]))
+	if err != nil {
+		return nil, false
+	}
+
+	data := raw[i+1:]
+	sum := sha256.Sum256(data)
+	return data, bytes.Equal(want, sum[:])
+}
@@ -0,0 +1,194 @@
+package rescript
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFileCache(t *testing.T) {
+	assert := assert.New(t)
+
+	dir := filepath.Join(t.TempDir(), "hwr")
+	c := NewFileCache(dir, CacheLimits{})
+
+	_, err := c.Get("abc")
+	assert.True(errors.Is(err, ErrCacheMiss))
+
+	err = c.Put("abc", []byte(`{"label": "foo"}`))
+	assert.Nil(err)
+	data, err := c.Get("abc")
+	assert.Nil(err)
+	assert.Equal(`{"label": "foo"}`, string(data))
+
+	// no temp files are left
+	files, err := ioutil.ReadDir(dir)
+	assert.Nil(err)
+	assert.Len(files, 1)
+
+	// keys are file names
+	assert.NotNil(c.Put("../abc", nil))
+	_, err = c.Get("")
+	assert.NotNil(err)
+
+	// damaged entries are removed
+	p := filepath.Join(dir, "abc"+cacheSuffix)
+	raw, err := ioutil.ReadFile(p)
+	assert.Nil(err)
+	raw[len(raw)-2] = 'x'
+	assert.Nil(ioutil.WriteFile(p, raw, 0644))
+	_, err = c.Get("abc")
+	assert.True(errors.Is(err, ErrCacheCorrupt))
+	_, err = c.Get("abc")
+	assert.True(errors.Is(err, ErrCacheMiss))
+
+	st, err := c.Stats()
+	assert.Nil(err)
+	assert.Equal(0, st.Entries)
+	assert.Equal(int64(1), st.Hits)
+	assert.Equal(int64(2), st.Misses)
+	assert.Equal(int64(1), st.Corrupt)
+
+	// counters are kept
+	assert.Nil(c.Close())
+	c = NewFileCache(dir, CacheLimits{})
+	st, err = c.Stats()
+	assert.Nil(err)
+	assert.Equal(int64(1), st.Hits)
+
+	assert.Nil(c.Put("def", []byte("data")))
+	assert.Nil(c.Clear())
+	st, err = c.Stats()
+	assert.Nil(err)
+	assert.Equal(CacheStats{}, st)
+}
+
+func TestFileCacheEviction(t *testing.T) {
+	assert := assert.New(t)
+
+	dir := t.TempDir()
+	c := NewFileCache(dir, CacheLimits{})
+
+	data := make([]byte, 100)
+	old := time.Now().Add(-time.Hour)
+	for i, key := range []string{"a", "b", "c", "d"} {
+		assert.Nil(c.Put(key, data))
+		mtime := old.Add(time.Duration(i) * time.Minute)
+		assert.Nil(os.Chtimes(filepath.Join(dir, key+cacheSuffix), mtime, mtime))
+	}
+	// reading marks an entry as used
+	_, err := c.Get("a")
+	assert.Nil(err)
+
+	st, err := c.Stats()
+	assert.Nil(err)
+	assert.Equal(4, st.Entries)
+	size := st.Size / 4
+
+	c.limits = CacheLimits{MaxSize: 3 * size}
+	n, err := c.Prune()
+	assert.Nil(err)
+	assert.Equal(1, n)
+	_, err = c.Get("b")
+	assert.True(errors.Is(err, ErrCacheMiss))
+
+	// c is older than the maximum age, d is not
+	c.limits = CacheLimits{MaxAge: time.Hour - 150*time.Second}
+	n, err = c.Prune()
+	assert.Nil(err)
+	assert.Equal(1, n)
+	_, err = c.Get("c")
+	assert.True(errors.Is(err, ErrCacheMiss))
+
+	// eviction on write, down to the low-water mark
+	c.limits = CacheLimits{MaxSize: 2*size + size/2}
+	assert.Nil(c.Put("e", data))
+	_, err = c.Get("d")
+	assert.True(errors.Is(err, ErrCacheMiss))
+	_, err = c.Get("a")
+	assert.Nil(err)
+	assert.Equal(2*size, c.size)
+
+	// replacing an entry does not change the size
+	assert.Nil(c.Put("e", data))
+	assert.Equal(2*size, c.size)
+
+	st, err = c.Stats()
+	assert.Nil(err)
+	assert.Equal(int64(3), st.Evicted)
+}
+
+func TestFileCacheLegacy(t *testing.T) {
+	assert := assert.New(t)
+
+	dir := t.TempDir()
+	c := NewFileCache(dir, CacheLimits{})
+	data := []byte(`{"label": "foo"}`)
+	old := time.Now().Add(-time.Hour)
+	for _, key := range []string{"a", "b"} {
+		p := filepath.Join(dir, key+legacySuffix)
+		assert.Nil(ioutil.WriteFile(p, data, 0644))
+		assert.Nil(os.Chtimes(p, old, old))
+	}
+	assert.Nil(ioutil.WriteFile(filepath.Join(dir, "x"+legacySuffix), []byte("{damaged"), 0644))
+
+	// entries from older versions are counted
+	st, err := c.Stats()
+	assert.Nil(err)
+	assert.Equal(3, st.Entries)
+	keys := map[string]bool{}
+	assert.Nil(c.Each(func(key string, _ []byte) error {
+		keys[key] = true
+		return nil
+	}))
+	assert.Equal(map[string]bool{"a": true, "b": true}, keys)
+
+	// and converted when they are read
+	got, err := c.Get("a")
+	assert.Nil(err)
+	assert.Equal(data, got)
+	_, err = os.Stat(filepath.Join(dir, "a"+legacySuffix))
+	assert.True(os.IsNotExist(err))
+	got, err = c.Get("a")
+	assert.Nil(err)
+	assert.Equal(data, got)
+	_, err = c.Get("x")
+	assert.True(errors.Is(err, ErrCacheCorrupt))
+
+	// and evicted like other entries
+	c.limits = CacheLimits{MaxAge: time.Minute}
+	n, err := c.Prune()
+	assert.Nil(err)
+	assert.Equal(1, n)
+	_, err = c.Get("b")
+	assert.True(errors.Is(err, ErrCacheMiss))
+	_, err = c.Get("a")
+	assert.Nil(err)
+}
+
+func TestFileCacheExpireOnWrite(t *testing.T) {
+	assert := assert.New(t)
+
+	dir := t.TempDir()
+	c := NewFileCache(dir, CacheLimits{})
+	assert.Nil(c.Put("a", []byte("old")))
+	old := time.Now().Add(-time.Hour)
+	assert.Nil(os.Chtimes(filepath.Join(dir, "a"+cacheSuffix), old, old))
+
+	// the first write checks for expired entries
+	c = NewFileCache(dir, CacheLimits{MaxAge: time.Minute})
+	assert.Nil(c.Put("b", []byte("new")))
+	_, err := c.Get("a")
+	assert.True(errors.Is(err, ErrCacheMiss))
+
+	// later writes only check every pruneEvery writes
+	assert.Nil(os.Chtimes(filepath.Join(dir, "b"+cacheSuffix), old, old))
+	assert.Nil(c.Put("c", []byte("new")))
+	_, err = c.Get("b")
+	assert.Nil(err)
+}
@@ -0,0 +1,103 @@
+package rescript
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"path"
+	"strings"
+	"time"
+)
+
+// exportSuffix is the suffix for entries in an exported cache.
+const exportSuffix = ".json"
+
+// ExportCache writes all entries from c to w
+// as a gzipped tar archive with one JSON file per entry.
+//
+// The archive can be read by ImportCache into any kind of cache,
+// so that a team can share recognition results.
+// It returns the number of exported entries.
+func ExportCache(w io.Writer, c Cache) (int, error) {
+	zw := gzip.NewWriter(w)
+	tw := tar.NewWriter(zw)
+
+	n := 0
+	now := time.Now()
+	err := c.Each(func(key string, data []byte) error {
+		hdr := &tar.Header{
+			Name:    key + exportSuffix,
+			Mode:    0644,
+			Size:    int64(len(data)),
+			ModTime: now,
+		}
+		err := tw.WriteHeader(hdr)
+		if err != nil {
+			return err
+		}
+		_, err = tw.Write(data)
+		if err != nil {
+			return err
+		}
+		n++
+		return nil
+	})
+	if err != nil {
+		return n, fmt.Errorf("failed to export cache: %v", err)
+	}
+
+	err = tw.Close()
+	if err == nil {
+		err = zw.Close()
+	}
+	if err != nil {
+		return n, fmt.Errorf("failed to export cache: %v", err)
+	}
+	return n, nil
+}
+
+// ImportCache reads an archive created by ExportCache and adds its entries to c.
+//
+// Keys are taken from the file names in the archive,
+// other files are ignored.
+// It returns the number of imported entries.
+func ImportCache(r io.Reader, c Cache) (int, error) {
+	zr, err := gzip.NewReader(r)
+	if err != nil {
+		return 0, fmt.Errorf("failed to import cache: %v", err)
+	}
+	defer zr.Close()
+	tr := tar.NewReader(zr)
+
+	n := 0
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return n, fmt.Errorf("failed to import cache: %v", err)
+		}
+
+		name := path.Base(hdr.Name)
+		if hdr.Typeflag != tar.TypeReg || !strings.HasSuffix(name, exportSuffix) {
+			continue
+		}
+		key := strings.TrimSuffix(name, exportSuffix)
+		if !cacheKeyRe.MatchString(key) {
+			continue
+		}
+
+		data, err := ioutil.ReadAll(tr)
+		if err != nil {
+			return n, fmt.Errorf("failed to import cache: %v", err)
+		}
+		err = c.Put(key, data)
+		if err != nil {
+			return n, fmt.Errorf("failed to import cache entry %q: %v", key, err)
+		}
+		n++
+	}
+	return n, nil
+}
@@ -0,0 +1,256 @@
+package rescript
+
+import (
+	"math"
+
+	"github.com/akeil/rmtool/pkg/lines"
+)
+
+// Content types that are handled locally and never sent to the API.
+const (
+	// ContentDrawing is a sketch that is included as an image.
+	ContentDrawing ContentType = "Drawing"
+	// ContentIgnore marks strokes that are not recognized at all.
+	ContentIgnore ContentType = "Ignore"
+)
+
+// Thresholds for ClassifyRegions, in pixels.
+const (
+	// clusterGapX and clusterGapY are the maximum distance between strokes
+	// in the same cluster. Words on a line are joined, lines are not.
+	clusterGapX = 40.0
+	clusterGapY = 8.0
+	// sketchLength is the minimum extent of a stroke that is part of a drawing
+	// rather than a letter.
+	sketchLength = 150.0
+	// barRatio is the minimum ratio of width to height for a fraction bar
+	// or a stroke of an equals sign.
+	barRatio = 4.0
+)
+
+// classStroke is a stroke with its position, used to classify regions.
+type classStroke struct {
+	ref    lines.StrokeRef
+	brush  lines.BrushType
+	bounds lines.Rect
+}
+
+// ClassifyRegions splits a page into text, math and drawing regions.
+// It can be used as a RegionFunc, see Recognizer.SetRegions.
+//
+// Strokes are clustered by their bounds; clusters are roughly a line
+// of handwriting or a single shape.
+// A cluster is a drawing if it contains a long stroke or strokes drawn
+// with a pencil or paint brush; text within a drawing becomes part of it.
+// A cluster is math if it contains a fraction bar or an equals sign,
+// so a line of prose with a "=" is recognized as math.
+// Everything else is text, which is the default and not included
+// in the result.
+//
+// Highlighter strokes and strokes drawn with a large marker
+// are returned as a region with ContentIgnore.
+func ClassifyRegions(pageID string, d *lines.Drawing) []Region {
+	var strokes []classStroke
+	ignore := Region{Type: ContentIgnore}
+	for i, l := range d.Layers {
+		fl, src := l.FlattenSources()
+		for j, s := range fl.Strokes {
+			if len(s.Dots) == 0 {
+				continue
+			}
+			cs := classStroke{
+				ref:    lines.StrokeRef{Layer: i, Stroke: src[j]},
+				brush:  s.BrushType,
+				bounds: s.Bounds(),
+			}
+			if isMarkup(s) {
+				ignore.add(cs)
+				continue
+			}
+			strokes = append(strokes, cs)
+		}
+	}
+
+	clusters := clusterStrokes(strokes)
+	types := make([]ContentType, len(clusters))
+	for i, c := range clusters {
+		types[i] = classifyCluster(c.strokes)
+	}
+
+	// text inside of a drawing is a label
+	for i, c := range clusters {
+		if types[i] != ContentDrawing || len(c.strokes) == 0 {
+			continue
+		}
+		for j := range clusters {
+			if types[j] != ContentDrawing && c.Bounds.Contains(clusters[j].Bounds.Min) && c.Bounds.Contains(clusters[j].Bounds.Max) {
+				types[j] = ContentDrawing
+				c.merge(&clusters[j])
+			}
+		}
+		clusters[i] = c
+	}
+
+	var regions []Region
+	for i, c := range clusters {
+		if len(c.strokes) == 0 || (types[i] != ContentMath && types[i] != ContentDrawing) {
+			continue
+		}
+		r := c.Region
+		r.Type = types[i]
+		regions = append(regions, r)
+	}
+	if len(ignore.Strokes) != 0 {
+		regions = append(regions, ignore)
+	}
+
+	return regions
+}
+
+// cluster is a group of strokes that are close to each other.
+type cluster struct {
+	Region
+	strokes []classStroke
+}
+
+func (c *cluster) merge(o *cluster) {
+	for _, s := range o.strokes {
+		c.strokes = append(c.strokes, s)
+		c.add(s)
+	}
+	o.strokes = nil
+}
+
+// add puts a stroke into the region and extends the bounds.
+func (r *Region) add(s classStroke) {
+	if len(r.Strokes) == 0 {
+		r.Bounds = s.bounds
+	} else {
+		r.Bounds = r.Bounds.Union(s.bounds)
+	}
+	r.Strokes = append(r.Strokes, s.ref)
+}
+
+// clusterStrokes groups strokes whose bounds are within the cluster gap
+// of each other.
+func clusterStrokes(strokes []classStroke) []cluster {
+	parent := make([]int, len(strokes))
+	for i := range parent {
+		parent[i] = i
+	}
+	var find func(i int) int
+	find = func(i int) int {
+		if parent[i] != i {
+			parent[i] = find(parent[i])
+		}
+		return parent[i]
+	}
+
+	for i := range strokes {
+		grown := strokes[i].bounds
+		grown.Min.X -= clusterGapX
+		grown.Max.X += clusterGapX
+		grown.Min.Y -= clusterGapY
+		grown.Max.Y += clusterGapY
+		for j := i + 1; j < len(strokes); j++ {
+			if grown.Overlaps(strokes[j].bounds) {
+				parent[find(j)] = find(i)
+			}
+		}
+	}
+
+	index := make(map[int]int)
+	var result []cluster
+	for i, s := range strokes {
+		root := find(i)
+		k, ok := index[root]
+		if !ok {
+			k = len(result)
+			index[root] = k
+			result = append(result, cluster{})
+		}
+		result[k].strokes = append(result[k].strokes, s)
+		result[k].add(s)
+	}
+
+	return result
+}
+
+// classifyCluster determines the content type for a cluster of strokes.
+func classifyCluster(strokes []classStroke) ContentType {
+	for _, s := range strokes {
+		if isSketchBrush(s.brush) {
+			return ContentDrawing
+		}
+		dx, dy := float64(s.bounds.Dx()), float64(s.bounds.Dy())
+		// long strokes, but not an underline
+		if math.Max(dx, dy) > sketchLength && dy > dx/barRatio {
+			return ContentDrawing
+		}
+	}
+
+	for i, s := range strokes {
+		if !isBar(s.bounds) {
+			continue
+		}
+		above, below := false, false
+		for j, o := range strokes {
+			if i == j || o.bounds.Max.X < s.bounds.Min.X || o.bounds.Min.X > s.bounds.Max.X {
+				continue
+			}
+			if isBar(o.bounds) && equalsSign(s.bounds, o.bounds) {
+				return ContentMath
+			}
+			if o.bounds.Max.Y < s.bounds.Min.Y {
+				above = true
+			}
+			if o.bounds.Min.Y > s.bounds.Max.Y {
+				below = true
+			}
+		}
+		if above && below {
+			return ContentMath
+		}
+	}
+
+	return ContentText
+}
+
+// isMarkup tells if a stroke highlights or marks up the text
+// rather than being part of it.
+func isMarkup(s lines.Stroke) bool {
+	switch s.BrushType {
+	case lines.Highlighter, lines.HighlighterV5:
+		return true
+	case lines.Marker, lines.MarkerV5:
+		return s.BrushSize >= lines.Large
+	default:
+		return false
+	}
+}
+
+// isSketchBrush tells if a brush is typically used for drawing.
+func isSketchBrush(bt lines.BrushType) bool {
+	switch bt {
+	case lines.Pencil, lines.PencilV5,
+		lines.PaintBrush, lines.PaintBrushV5:
+		return true
+	default:
+		return false
+	}
+}
+
+func isBar(r lines.Rect) bool {
+	return float64(r.Dx()) >= barRatio*math.Max(1, float64(r.Dy()))
+}
+
+// equalsSign tells if two bars form an equals sign,
+// i.e. they have a similar length and one is close above the other.
+func equalsSign(a, b lines.Rect) bool {
+	la, lb := float64(a.Dx()), float64(b.Dx())
+	if math.Min(la, lb) < 0.6*math.Max(la, lb) {
+		return false
+	}
+	gap := math.Abs(float64(b.Min.Y - a.Min.Y))
+	return gap > 0 && gap < 0.5*math.Max(la, lb)
+}
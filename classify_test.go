@@ -0,0 +1,133 @@
+package rescript
+
+import (
+	"bytes"
+	"context"
+	"image/png"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/akeil/rmtool/pkg/lines"
+)
+
+// line creates a straight stroke from (x0, y0) to (x1, y1).
+func line(bt lines.BrushType, x0, y0, x1, y1 float32) lines.Stroke {
+	return lines.Stroke{
+		BrushType: bt,
+		BrushSize: lines.Medium,
+		Dots: []lines.Dot{
+			{X: x0, Y: y0, Width: 2, Pressure: 0.5},
+			{X: x1, Y: y1, Width: 2, Pressure: 0.5},
+		},
+	}
+}
+
+// letter creates a small stroke, like a handwritten letter.
+func letter(x, y float32) lines.Stroke {
+	return line(lines.BallpointV5, x, y, x+12, y+20)
+}
+
+func TestClassifyRegions(t *testing.T) {
+	assert := assert.New(t)
+
+	d := lines.NewDrawing()
+	d.Layers[0].Strokes = []lines.Stroke{
+		// 0-2: a line of text
+		letter(100, 100), letter(120, 100), letter(140, 100),
+		// 3-7: x = 1/2
+		letter(100, 300),
+		line(lines.BallpointV5, 120, 308, 150, 308),
+		line(lines.BallpointV5, 120, 316, 150, 316),
+		letter(170, 285),
+		line(lines.BallpointV5, 165, 310, 190, 310),
+		// 8-10: a box with a label
+		line(lines.FinelinerV5, 100, 500, 400, 500),
+		line(lines.FinelinerV5, 100, 500, 100, 700),
+		letter(200, 600),
+		// 11: highlighter
+		line(lines.HighlighterV5, 100, 110, 160, 110),
+	}
+	marker := line(lines.MarkerV5, 500, 100, 520, 120)
+	marker.BrushSize = lines.Large
+	d.Layers[0].Strokes = append(d.Layers[0].Strokes, marker)
+
+	regions := ClassifyRegions("p", d)
+	assert.Len(regions, 3)
+
+	ref := func(i int) lines.StrokeRef {
+		return lines.StrokeRef{Layer: 0, Stroke: i}
+	}
+	assert.Equal(ContentMath, regions[0].Type)
+	assert.ElementsMatch([]lines.StrokeRef{ref(3), ref(4), ref(5), ref(6), ref(7)}, regions[0].Strokes)
+	assert.Equal(ContentDrawing, regions[1].Type)
+	assert.ElementsMatch([]lines.StrokeRef{ref(8), ref(9), ref(10)}, regions[1].Strokes)
+	assert.Equal(ContentIgnore, regions[2].Type)
+	assert.ElementsMatch([]lines.StrokeRef{ref(11), ref(12)}, regions[2].Strokes)
+
+	// only text - nothing to split
+	d.Layers[0].Strokes = d.Layers[0].Strokes[:3]
+	assert.Empty(ClassifyRegions("p", d))
+
+	// a pencil is used for sketches
+	d.Layers[0].Strokes[1].BrushType = lines.PencilV5
+	regions = ClassifyRegions("p", d)
+	assert.Len(regions, 1)
+	assert.Equal(ContentDrawing, regions[0].Type)
+}
+
+func TestSplitRegionsByRef(t *testing.T) {
+	assert := assert.New(t)
+
+	d := lines.NewDrawing()
+	d.Layers[0].Strokes = []lines.Stroke{letter(100, 100), letter(120, 100)}
+	g, _ := ConvertLayer(0, 0, d.Layers[0])
+
+	regions := []Region{
+		{Bounds: pageBounds(), Type: ContentMath, Strokes: []lines.StrokeRef{{Layer: 0, Stroke: 1}}},
+		// not used for strokes that are listed in another region
+		{Bounds: pageBounds(), Type: ContentDiagram},
+	}
+	parts := splitRegions([]StrokeGroup{g}, regions)
+	assert.Len(parts[0], 1)
+	assert.Equal("0.1", parts[0][0].Strokes[0].ID)
+	assert.Len(parts[1], 1)
+	assert.Equal("0.0", parts[1][0].Strokes[0].ID)
+}
+
+func TestRecognizeSketch(t *testing.T) {
+	assert := assert.New(t)
+
+	// drawings and ignored strokes do not call the API
+	d := lines.NewDrawing()
+	d.Layers[0].Strokes = []lines.Stroke{
+		line(lines.PencilV5, 100, 100, 300, 300),
+		line(lines.HighlighterV5, 100, 500, 300, 500),
+	}
+	d.Text = &lines.Text{Paragraphs: []lines.Paragraph{{Text: "Typed", Y: 50}}}
+
+	r := NewRecognizer("", "", "")
+	r.SetRegions(ClassifyRegions)
+	l, err := r.recognizePage(context.Background(), "p", d, LangEN)
+	assert.Nil(err)
+	assert.Equal("Typed", l.First().Token().String())
+
+	sk := l.Last().Token().Sketch()
+	assert.NotNil(sk)
+	assert.Equal(float32(100), sk.Bounds.Min.Y)
+	img, err := png.Decode(bytes.NewReader(sk.PNG))
+	assert.Nil(err)
+	assert.Equal(200+2*sketchMargin+1, img.Bounds().Dx())
+	// on the line and beside it
+	r0, _, _, _ := img.At(sketchMargin+50, sketchMargin+50).RGBA()
+	r1, _, _, _ := img.At(sketchMargin+50, sketchMargin+150).RGBA()
+	assert.Equal(uint32(0), r0)
+	assert.Equal(uint32(0xffff), r1)
+
+	var buf bytes.Buffer
+	err = NewMarkdownComposer()(&buf, Metadata{PageIDs: []string{"p"}}, map[string]*TokenList{"p": l})
+	assert.Nil(err)
+	assert.Contains(buf.String(), "Typed\n![Sketch](data:image/png;base64,")
+	assert.True(strings.HasSuffix(buf.String(), ")\n"))
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/akeil/rescript"
+)
+
+func runCacheStats() error {
+	s, err := loadSettings()
+	if err != nil {
+		return err
+	}
+	c, err := s.hwrCache()
+	if err != nil {
+		return err
+	}
+
+	defer c.Close()
+
+	st, err := c.Stats()
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Location:  %v\n", s.hwrCachePath())
+	fmt.Printf("Entries:   %d\n", st.Entries)
+	fmt.Printf("Size:      %.1f MB\n", float64(st.Size)/1024/1024)
+	if st.Entries != 0 {
+		fmt.Printf("Last used: %v - %v\n", st.Oldest.Format(time.RFC3339), st.Newest.Format(time.RFC3339))
+	}
+	fmt.Printf("Hits:      %d\n", st.Hits)
+	fmt.Printf("Misses:    %d\n", st.Misses)
+	fmt.Printf("Corrupt:   %d\n", st.Corrupt)
+	fmt.Printf("Evicted:   %d\n", st.Evicted)
+
+	return nil
+}
+
+func runCachePrune() error {
+	s, err := loadSettings()
+	if err != nil {
+		return err
+	}
+	c, err := s.hwrCache()
+	if err != nil {
+		return err
+	}
+
+	n, err := c.Prune()
+	if err != nil {
+		return err
+	}
+	message("%v removed %d entries", checkmark, n)
+
+	return c.Close()
+}
+
+func runCacheClear() error {
+	s, err := loadSettings()
+	if err != nil {
+		return err
+	}
+	c, err := s.hwrCache()
+	if err != nil {
+		return err
+	}
+
+	err = c.Clear()
+	if err != nil {
+		c.Close()
+		return err
+	}
+	return c.Close()
+}
+
+func runCacheExport(dst string) error {
+	s, err := loadSettings()
+	if err != nil {
+		return err
+	}
+	c, err := s.hwrCache()
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+
+	var w io.Writer = os.Stdout
+	if dst != dstStdout {
+		f, err := os.Create(dst)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		w = f
+	}
+
+	n, err := rescript.ExportCache(w, c)
+	if err != nil {
+		return err
+	}
+	message("%v exported %d entries", checkmark, n)
+
+	return nil
+}
+
+func runCacheImport(src string) error {
+	s, err := loadSettings()
+	if err != nil {
+		return err
+	}
+	c, err := s.hwrCache()
+	if err != nil {
+		return err
+	}
+
+	f, err := os.Open(src)
+	if err != nil {
+		c.Close()
+		return err
+	}
+	defer f.Close()
+
+	n, err := rescript.ImportCache(f, c)
+	if err != nil {
+		c.Close()
+		return err
+	}
+	message("%v imported %d entries", checkmark, n)
+
+	return c.Close()
+}
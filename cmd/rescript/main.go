@@ -1,15 +1,20 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"io"
 	"io/ioutil"
 	"os"
+	"os/signal"
 	"path/filepath"
-	"github.com/akeil/rmtool/pkg/lines"
+	"strings"
+	"time"
+
 	"github.com/akeil/rmtool"
 	"github.com/akeil/rmtool/pkg/api"
 	"golang.org/x/sync/errgroup"
+	"gopkg.in/alecthomas/kingpin.v2"
 	"gopkg.in/yaml.v2"
 
 	"github.com/akeil/rescript"
@@ -22,84 +27,131 @@ const (
 	dstStdout = "-"
 )
 
-var langs = map[string]rescript.LanguageCode{
-	"en": rescript.LangEN,
-	"de": rescript.LangDE,
+// cache backends
+const (
+	backendFiles = "files"
+	backendKV    = "kv"
+)
+
+var contentTypes = map[string]rescript.ContentType{
+	"text":    rescript.ContentText,
+	"math":    rescript.ContentMath,
+	"diagram": rescript.ContentDiagram,
+	"raw":     rescript.ContentRawContent,
 }
 
 func main() {
-	fmt.Println("Hello, World!")
-	// Open the file
-	file, err := os.Open("test.rm")
-	if err != nil {
-		fmt.Printf("Error opening file: %v\n", err)
-		return
+	app := kingpin.New("hwr", "reMarkable Handwriting Recogntion")
+	app.HelpFlag.Short('h')
+
+	convert := app.Command("convert", "Convert notebooks to text (default)").Default()
+	var (
+		name   = convert.Arg("name", "Name of the notebook to convert").Required().String()
+		dst    = convert.Flag("output", "Directory for output document, \"-\" for STDOUT").Short('o').Default(".").String()
+		format = convert.Flag("format", "Output format").Short('f').Default("txt").Enum("txt", "md")
+		lang   = convert.Flag("lang", "Language of the notebook, e.g. \"en\", \"fr_CA\" or \"auto\" (default: en)").Short('l').String()
+		layers = convert.Flag("layers", "Comma separated names of the layers to recognize (default: all)").String()
+		dict   = convert.Flag("dictionary", "File with known words, one per line, used to resolve words with alternatives").ExistingFile()
+		mark   = convert.Flag("mark-uncertain", "Show alternatives for uncertain words, e.g. \"word{?alt1|alt2}\"").Bool()
+		kind   = convert.Flag("content", "Type of content on the pages").Default("text").Enum("text", "math", "diagram", "raw", "auto")
+	)
+
+	cache := app.Command("cache", "Manage the cache for recognition results")
+	cacheStats := cache.Command("stats", "Show the size and use of the cache")
+	cachePrune := cache.Command("prune", "Remove entries that exceed the configured limits")
+	cacheClear := cache.Command("clear", "Remove all entries")
+	cacheExport := cache.Command("export", "Write all entries to an archive")
+	exportDst := cacheExport.Arg("file", "Archive to write, \"-\" for STDOUT").Required().String()
+	cacheImport := cache.Command("import", "Add the entries from an archive")
+	importSrc := cacheImport.Arg("file", "Archive to read").Required().ExistingFile()
+
+	cmd := kingpin.MustParse(app.Parse(os.Args[1:]))
+
+	rmtool.SetLogLevel("error")
+
+	var err error
+	switch cmd {
+	case cacheStats.FullCommand():
+		err = runCacheStats()
+	case cachePrune.FullCommand():
+		err = runCachePrune()
+	case cacheClear.FullCommand():
+		err = runCacheClear()
+	case cacheExport.FullCommand():
+		err = runCacheExport(*exportDst)
+	case cacheImport.FullCommand():
+		err = runCacheImport(*importSrc)
+	default:
+		opts := options{
+			layers:        splitList(*layers),
+			dictionary:    *dict,
+			markUncertain: *mark,
+			content:       contentTypes[*kind],
+			classify:      *kind == "auto",
+		}
+		err = run(*name, *dst, *lang, *format, opts)
 	}
-	defer file.Close() // Ensure the file is closed when the function ends
-
-	// Read and check the header
-	d, err := lines.ReadDrawing(file)
 	if err != nil {
-		fmt.Printf("Error reading header: %v\n", err)
-		return
+		message("%v Error: %v", crossmark, err)
+		os.Exit(1)
 	}
 
-	// Print the detected version
-	fmt.Println(d.Version)
-	s, err := loadSettings()
-	rec := rescript.NewRecognizer(s.AppKey, s.HmacKey, s.hwrCache())
-	// rec.Recognize(doc, lc)
-	res, err := rec.RecognizeDrawing(d, "en_US")
-	fmt.Println(res.Label)
-	// tok := rescript.ToTokens(res)
-	// fmt.Println(tok.data)
-	// fmt.Println(tok)
-	// pipeline := rescript.BuildPipeline(rescript.Dehyphenate)
-	// pipe := pipeline(tok)
-	// fmt.Println(pipe)
-	// cmp := selectComposer("txt")
-	// m := rescript.Metadata{
-	// 	Title:   "TestTitle",
-	// 	PageIDs: []string{"1"},
-	// }
-	// var w io.Writer
-	// err = cmp(w, m, results)
-
-	// app := kingpin.New("hwr", "reMarkable Handwriting Recogntion")
-	// app.HelpFlag.Short('h')
-
-	// var (
-	// 	name   = app.Arg("name", "Name of the notebook to convert").Required().String()
-	// 	dst    = app.Flag("output", "Directory for output document, \"-\" for STDOUT").Short('o').Default(".").String()
-	// 	format = app.Flag("format", "Output format").Short('f').Default("txt").Enum("txt", "md")
-	// 	lang   = app.Flag("lang", "Language of the notebook").Short('l').Default("en").String()
-	// )
-
-	// kingpin.MustParse(app.Parse(os.Args[1:]))
-
-	// rmtool.SetLogLevel("error")
-
-	// err := run(*name, *dst, *lang, *format)
-	// if err != nil {
-	// 	message("%v Error: %v", crossmark, err)
-	// 	os.Exit(1)
-	// }
-
-	// message("%v Done.", checkmark)
+	message("%v Done.", checkmark)
 }
 
-func run(name, dst, lang, format string) error {
-	lc, ok := langs[lang]
-	if !ok {
-		return fmt.Errorf("invalid language %q", lang)
-	}
+// options are the optional settings from the command line.
+type options struct {
+	layers        []string
+	dictionary    string
+	markUncertain bool
+	content       rescript.ContentType
+	classify      bool
+}
 
+func run(name, dst, lang, format string, o options) error {
 	s, err := loadSettings()
 	if err != nil {
 		return err
 	}
 
-	rec := rescript.NewRecognizer(s.AppKey, s.HmacKey, s.hwrCache())
+	candidates, err := s.candidates()
+	if err != nil {
+		return err
+	}
+
+	timeout := rescript.DefaultTimeout
+	if s.Timeout != "" {
+		timeout, err = time.ParseDuration(s.Timeout)
+		if err != nil {
+			return fmt.Errorf("invalid timeout %q: %v", s.Timeout, err)
+		}
+	}
+
+	var limiter *rescript.RateLimiter
+	if s.RateLimit > 0 {
+		limiter = rescript.NewRateLimiter(s.RateLimit, 1)
+	}
+
+	cache, err := s.hwrCache()
+	if err != nil {
+		return err
+	}
+	defer cache.Close()
+
+	// stop on Ctrl+C; finished pages are kept in the cache
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	interrupt := make(chan os.Signal, 1)
+	signal.Notify(interrupt, os.Interrupt)
+	defer signal.Stop(interrupt)
+	go func() {
+		select {
+		case <-interrupt:
+			message("%v cancelled", crossmark)
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
 
 	c, err := initClient(s)
 	if err != nil {
@@ -115,17 +167,61 @@ func run(name, dst, lang, format string) error {
 	root := rmtool.BuildTree(items)
 	root = root.Filtered(rmtool.IsDocument, rmtool.MatchName(name))
 
-	cmp := selectComposer(format)
+	cmp := selectComposer(format, rescript.ComposeOptions{MarkUncertain: o.markUncertain})
 
-	pipeline := rescript.BuildPipeline(rescript.Dehyphenate)
+	var dict rescript.Dictionary
+	if o.dictionary != "" {
+		dict, err = loadDictionary(o.dictionary)
+		if err != nil {
+			return err
+		}
+	}
 
 	// do recognition for each matching document
 	var group errgroup.Group
-	root.Walk(func(n *rmtool.Node) error {
+	err = root.Walk(func(n *rmtool.Node) error {
 		if n.Type() == rmtool.CollectionType {
 			return nil
 		}
 
+		pipeline, err := buildPipeline(s.stages(n), format, dict)
+		if err != nil {
+			return fmt.Errorf("invalid pipeline for %q: %v", n.Name(), err)
+		}
+
+		lc, err := s.language(n, lang)
+		if err != nil {
+			return err
+		}
+
+		lx, err := s.lexicon(n)
+		if err != nil {
+			return err
+		}
+		rec := rescript.NewRecognizer(s.AppKey, s.HmacKey, "")
+		rec.SetCache(cache)
+		rec.SelectLayers(o.layers...)
+		rec.SetLexicon(lx)
+		langs := []rescript.LanguageCode{lc}
+		if lc == rescript.LangAuto {
+			langs = candidates
+		}
+		for _, l := range langs {
+			words, err := s.languageWords(l)
+			if err != nil {
+				return err
+			}
+			rec.SetLanguageLexicon(l, rescript.Lexicon{Words: words})
+		}
+		rec.SetCandidates(candidates...)
+		rec.SetWorkers(s.Workers)
+		rec.SetTimeout(timeout)
+		rec.SetRateLimiter(limiter)
+		rec.SetContentType(o.content)
+		if o.classify {
+			rec.SetRegions(rescript.ClassifyRegions)
+		}
+
 		group.Go(func() error {
 			message("%v download notebook %q", ellipsis, n.Name())
 			doc, err := rmtool.ReadDocument(r, n)
@@ -133,10 +229,14 @@ func run(name, dst, lang, format string) error {
 				return err
 			}
 
-			message("%v recognize handwriting (%v) for %q", ellipsis, lang, n.Name())
-			results, err := rec.Recognize(doc, lc)
-			if err != nil {
-				return err
+			message("%v recognize handwriting (%v) for %q", ellipsis, lc, n.Name())
+			results, recErr := rec.RecognizeContext(ctx, doc, lc)
+			if recErr != nil {
+				// the finished pages are kept in the cache in any case
+				message("%v %d of %d pages of %q finished", crossmark, len(results), len(doc.Pages()), n.Name())
+				if len(results) == 0 || dst == dstStdout {
+					return recErr
+				}
 			}
 
 			for k, node := range results {
@@ -149,29 +249,49 @@ func run(name, dst, lang, format string) error {
 				w = os.Stdout
 				path = "STDOUT"
 			} else {
-				path = filepath.Join(dst, doc.Name()+"."+format)
+				name := doc.Name()
+				if recErr != nil {
+					// do not replace a complete result from an earlier run
+					name += ".partial"
+				}
+				path = filepath.Join(dst, name+"."+format)
 				f, err := os.Create(path)
 				if err != nil {
-					return nil
+					return err
 				}
 				defer f.Close()
 				w = f
 			}
 
 			m := rescript.Metadata{
-				Title:   doc.Name(),
-				PageIDs: doc.Pages(),
+				Title:        doc.Name(),
+				PageIDs:      doc.Pages(),
+				ID:           doc.ID(),
+				Version:      doc.Version(),
+				LastModified: doc.LastModified(),
+				Folder:       strings.Join(n.Path()[1:], "/"),
+				PageCount:    doc.PageCount(),
+			}
+			if lc != rescript.LangAuto {
+				m.Language = lc
 			}
 
 			err = cmp(w, m, results)
 			if err != nil {
 				return err
 			}
+			if recErr != nil {
+				message("%v write partial result to %q", crossmark, path)
+				return recErr
+			}
 			message("%v write result to %q", checkmark, path)
 			return nil
 		})
 		return nil
 	})
+	if err != nil {
+		return err
+	}
 	return group.Wait()
 }
 
@@ -222,15 +342,89 @@ func readInput(msg string) (string, error) {
 	return reply, err
 }
 
-func selectComposer(t string) rescript.ComposeFunc {
+func selectComposer(t string, o rescript.ComposeOptions) rescript.ComposeFunc {
 	switch t {
 	case "txt":
-		return rescript.NewPlaintextComposer()
+		return rescript.NewPlaintextComposerOptions(o)
 	case "md":
-		return rescript.NewMarkdownComposer()
+		return rescript.NewMarkdownComposerOptions(o)
 	default:
-		return rescript.NewPlaintextComposer()
+		return rescript.NewPlaintextComposerOptions(o)
+	}
+}
+
+// markdownStages are added to the pipeline for markdown output,
+// unless the pipeline already contains one of them.
+var markdownStages = []string{"tasks", "lists", "headings", "emphasis"}
+
+// buildPipeline creates the pipeline for the configured stages.
+//
+// Words with alternatives are resolved with the dictionary (if any)
+// before the configured stages are applied.
+func buildPipeline(cfg []rescript.StageConfig, format string, d rescript.Dictionary) (rescript.PipelineFunc, error) {
+	if format == "md" && !hasStage(cfg, markdownStages...) {
+		// copy, the configured stages are shared between notebooks
+		cfg = append([]rescript.StageConfig{}, cfg...)
+		for _, name := range markdownStages {
+			cfg = append(cfg, rescript.StageConfig{Name: name})
+		}
+	}
+
+	p, err := rescript.NewPipeline(cfg)
+	if err != nil {
+		return nil, err
+	}
+	if d == nil {
+		return p, nil
+	}
+	return rescript.BuildPipeline(rescript.NewDictionaryFunc(d), p), nil
+}
+
+func hasStage(cfg []rescript.StageConfig, names ...string) bool {
+	for _, c := range cfg {
+		for _, name := range names {
+			if c.Name == name {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func loadLexicon(path string) ([]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	words, err := rescript.ReadLexicon(f)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read lexicon %q: %v", path, err)
 	}
+	return words, nil
+}
+
+func loadDictionary(path string) (rescript.Dictionary, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return rescript.ReadDictionary(f)
+}
+
+// splitList splits a comma separated list and drops empty entries.
+func splitList(s string) []string {
+	var items []string
+	for _, item := range strings.Split(s, ",") {
+		item = strings.TrimSpace(item)
+		if item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
 }
 
 func loadToken(path string) (string, error) {
@@ -269,16 +463,211 @@ type settings struct {
 	CacheDir string
 	AppKey   string
 	HmacKey  string
+	// CacheBackend selects how recognition results are stored:
+	// "files" (default) for one file per result,
+	// "kv" for a single file.
+	CacheBackend string
+	// CacheMaxSize is the maximum size of the recognition cache in MB.
+	CacheMaxSize int64
+	// CacheMaxAge is the time after which an unused recognition result
+	// is removed from the cache, e.g. "720h".
+	CacheMaxAge string
+	// Workers is the number of pages per notebook
+	// that are recognized at the same time.
+	Workers int
+	// Timeout is the time limit for a single call to MyScript, e.g. "90s".
+	Timeout string
+	// RateLimit is the maximum number of calls to MyScript per second,
+	// for all notebooks together.
+	RateLimit float64
+	// Language is the default language, e.g. "en" or "fr_CA".
+	Language string
+	// Candidates are the languages that are tried with "auto".
+	Candidates []string
+	// Pipeline lists the stages that process the recognized text.
+	Pipeline []rescript.StageConfig
+	// Resources are custom MyScript resources used for all notebooks.
+	Resources []string
+	// Notebooks holds settings for individual notebooks.
+	Notebooks []notebookSettings
+}
+
+// notebookSettings override the settings for the notebooks
+// that match the given path, e.g. "Work/Meetings".
+type notebookSettings struct {
+	Path string
+	// Language is the default language for the notebook.
+	Language string
+	Pipeline []rescript.StageConfig
+	// Lexicon is a file with custom words,
+	// relative to the lexicon directory.
+	Lexicon   string
+	Resources []string
+}
+
+// defaultLanguage is used if no language is configured or selected.
+const defaultLanguage = "en"
+
+// defaultCandidates are used for "auto" if no candidates are configured.
+var defaultCandidates = []string{"en", "de"}
+
+// defaultPipeline is used if no pipeline is configured.
+var defaultPipeline = []rescript.StageConfig{
+	{Name: "reflow"},
+	{Name: "dehyphenate"},
+}
+
+// notebook returns the settings for the given notebook or nil.
+// The first matching notebook setting wins.
+func (s settings) notebook(n *rmtool.Node) *notebookSettings {
+	for i := range s.Notebooks {
+		if rmtool.MatchPath(s.Notebooks[i].Path)(n) {
+			return &s.Notebooks[i]
+		}
+	}
+	return nil
+}
+
+// stages returns the pipeline stages for the given notebook.
+//
+// Notebooks without their own pipeline use the global pipeline.
+func (s settings) stages(n *rmtool.Node) []rescript.StageConfig {
+	if nb := s.notebook(n); nb != nil && len(nb.Pipeline) != 0 {
+		return nb.Pipeline
+	}
+	if len(s.Pipeline) != 0 {
+		return s.Pipeline
+	}
+	return defaultPipeline
+}
+
+// language returns the language for the given notebook.
+//
+// A language from the command line wins over the notebook settings,
+// which win over the default language from the settings.
+func (s settings) language(n *rmtool.Node, flag string) (rescript.LanguageCode, error) {
+	name := flag
+	if name == "" {
+		if nb := s.notebook(n); nb != nil {
+			name = nb.Language
+		}
+	}
+	if name == "" {
+		name = s.Language
+	}
+	if name == "" {
+		name = defaultLanguage
+	}
+
+	lc, err := rescript.ParseLanguage(name)
+	if err != nil {
+		return lc, fmt.Errorf("invalid language for %q: %v", n.Name(), err)
+	}
+	return lc, nil
+}
+
+// candidates returns the languages that are tried with "auto".
+func (s settings) candidates() ([]rescript.LanguageCode, error) {
+	names := s.Candidates
+	if len(names) == 0 {
+		names = defaultCandidates
+	}
+
+	result := make([]rescript.LanguageCode, len(names))
+	for i, name := range names {
+		lc, err := rescript.ParseLanguage(name)
+		if err != nil {
+			return nil, err
+		}
+		if lc == rescript.LangAuto {
+			return nil, fmt.Errorf("invalid candidate language %q", name)
+		}
+		result[i] = lc
+	}
+	return result, nil
+}
+
+func (s settings) lexiconDir() string {
+	return filepath.Join(s.DataDir, "lexicon")
+}
+
+// languageWords loads the custom words for a language.
+//
+// Words are read from the lexicon directory,
+// e.g. "lexicon/en_US.txt"; the file is optional.
+func (s settings) languageWords(lc rescript.LanguageCode) ([]string, error) {
+	words, err := loadLexicon(filepath.Join(s.lexiconDir(), string(lc)+".txt"))
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	return words, nil
+}
+
+// lexicon loads the custom words and resources for the given notebook,
+// which are used with all languages.
+//
+// Words from the notebook's lexicon file are added
+// to the words for the language (see languageWords).
+func (s settings) lexicon(n *rmtool.Node) (rescript.Lexicon, error) {
+	lx := rescript.Lexicon{Resources: s.Resources}
+
+	nb := s.notebook(n)
+	if nb == nil {
+		return lx, nil
+	}
+	lx = lx.Merge(rescript.Lexicon{Resources: nb.Resources})
+	if nb.Lexicon != "" {
+		path := nb.Lexicon
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(s.lexiconDir(), path)
+		}
+		words, err := loadLexicon(path)
+		if err != nil {
+			return lx, err
+		}
+		lx = lx.Merge(rescript.Lexicon{Words: words})
+	}
+
+	return lx, nil
 }
 
 func (s settings) tokenPath() string {
 	return filepath.Join(s.DataDir, "device-token")
 }
 
-func (s settings) hwrCache() string {
+// hwrCachePath is the directory or file for recognition results,
+// depending on the cache backend.
+func (s settings) hwrCachePath() string {
+	if s.CacheBackend == backendKV {
+		return filepath.Join(s.CacheDir, "hwr.kv")
+	}
 	return filepath.Join(s.CacheDir, "hwr")
 }
 
+// hwrCache creates the cache for recognition results
+// with the configured backend and limits.
+func (s settings) hwrCache() (rescript.Cache, error) {
+	limits := rescript.CacheLimits{
+		MaxSize: s.CacheMaxSize * 1024 * 1024,
+	}
+	if s.CacheMaxAge != "" {
+		d, err := time.ParseDuration(s.CacheMaxAge)
+		if err != nil {
+			return nil, fmt.Errorf("invalid cache max age %q: %v", s.CacheMaxAge, err)
+		}
+		limits.MaxAge = d
+	}
+
+	switch s.CacheBackend {
+	case "", backendFiles:
+		return rescript.NewFileCache(s.hwrCachePath(), limits), nil
+	case backendKV:
+		return rescript.OpenKVCache(s.hwrCachePath(), limits)
+	default:
+		return nil, fmt.Errorf("invalid cache backend %q", s.CacheBackend)
+	}
+}
+
 func loadSettings() (settings, error) {
 	s := settings{}
 	config, err := os.UserConfigDir()
@@ -1,7 +1,10 @@
 package rescript
 
 import (
+	"fmt"
 	"math"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/akeil/rmtool/pkg/lines"
@@ -11,17 +14,29 @@ const (
 	speedFactor int64 = 200 * 100
 	strokeGap         = 500 * 100
 	minSpeed          = 0.01
+	mmPerInch         = 25.4
 )
 
 // ConvertLayer convert a Layer from a reMarkable drawing to a MyScript stroke group.
-func ConvertLayer(tOffset int64, l lines.Layer) (StrokeGroup, int64) {
+//
+// Erasers are applied to the layer first, so erased ink is not included.
+//
+// Each stroke gets an ID that refers to its source stroke in the layer
+// with the given index. The IDs are part of the recognition result
+// and allow to map words back to strokes.
+// Strokes that were split by the eraser get one ID per part.
+func ConvertLayer(tOffset int64, layer int, l lines.Layer) (StrokeGroup, int64) {
+	l, src := l.FlattenSources()
 	t := tOffset
 	strokes := make([]Stroke, len(l.Strokes))
+	parts := make(map[int]int)
 
 	i := 0
-	for _, s := range l.Strokes {
+	for j, s := range l.Strokes {
 		if isTextStroke(s.BrushType) {
 			stroke, tx := convertStroke(t, s)
+			stroke.ID = strokeID(lines.StrokeRef{Layer: layer, Stroke: src[j]}, parts[src[j]])
+			parts[src[j]]++
 			strokes[i] = stroke
 			// add some millis to t for each new stroke
 			t = tx + strokeGap
@@ -76,6 +91,12 @@ func convertStroke(tOffset int64, s lines.Stroke) (Stroke, int64) {
 	}, ms
 }
 
+// toPixels converts a length in millimeters, as used in the recognition
+// result, back to pixels on the reMarkable page.
+func toPixels(mm float64) float64 {
+	return mm * defaultResolution / mmPerInch
+}
+
 func coercePressure(p float32) float64 {
 	return math.Max(0.0, math.Min(1.0, float64(p)))
 }
@@ -91,6 +112,47 @@ func fromMillis(n int64) time.Time {
 	return time.Unix(secs, nanos)
 }
 
+// strokeID creates the ID for a stroke in a MyScript request.
+//
+// The part is the index of the stroke among the parts
+// that the eraser left from the source stroke;
+// it is left out for the first part.
+func strokeID(ref lines.StrokeRef, part int) string {
+	if part == 0 {
+		return fmt.Sprintf("%d.%d", ref.Layer, ref.Stroke)
+	}
+	return fmt.Sprintf("%d.%d.%d", ref.Layer, ref.Stroke, part)
+}
+
+// parseStrokeID is the reverse of strokeID.
+// It returns the source stroke, without the part.
+func parseStrokeID(id string) (lines.StrokeRef, bool) {
+	var ref lines.StrokeRef
+	fields := strings.Split(id, ".")
+	if len(fields) != 2 && len(fields) != 3 {
+		return ref, false
+	}
+	n := make([]int, len(fields))
+	for i, f := range fields {
+		v, err := strconv.Atoi(f)
+		if err != nil || v < 0 {
+			return ref, false
+		}
+		n[i] = v
+	}
+	ref.Layer = n[0]
+	ref.Stroke = n[1]
+	return ref, true
+}
+
+// toRect converts a bounding box in millimeters to page coordinates.
+func toRect(b BoundingBox) lines.Rect {
+	return lines.Rect{
+		Min: lines.Point{X: float32(toPixels(b.X)), Y: float32(toPixels(b.Y))},
+		Max: lines.Point{X: float32(toPixels(b.X + b.Width)), Y: float32(toPixels(b.Y + b.Height))},
+	}
+}
+
 func isTextStroke(bt lines.BrushType) bool {
 	switch bt {
 	case lines.Eraser,
@@ -0,0 +1,188 @@
+package rescript
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// Element types in a diagram result.
+const (
+	DiagramNode = "Node"
+	DiagramEdge = "Edge"
+	DiagramText = "Text"
+)
+
+const arrowHead = "arrow-head"
+
+// DiagramResult is the JIIX response for diagram recognition.
+type DiagramResult struct {
+	ID          string           `json:"id"`
+	Version     string           `json:"version"`
+	Type        string           `json:"type"`
+	BoundingBox BoundingBox      `json:"bounding-box"`
+	Elements    []DiagramElement `json:"elements"`
+}
+
+// DiagramElement is a shape, connector or text in a diagram.
+//
+// Nodes have a Kind like "rectangle" or "circle".
+// Edges connect two elements; their ends may be decorated with an arrow head.
+// See:
+// https://developer.myscript.com/docs/interactive-ink/1.4/reference/web/jiix/#diagram-item
+type DiagramElement struct {
+	ID           ElementID   `json:"id"`
+	Type         string      `json:"type"`
+	Kind         string      `json:"kind,omitempty"`
+	Label        string      `json:"label,omitempty"`
+	Parent       ElementID   `json:"parent,omitempty"`
+	Connected    []ElementID `json:"connected,omitempty"`
+	P1Decoration string      `json:"p1Decoration,omitempty"`
+	P2Decoration string      `json:"p2Decoration,omitempty"`
+	BoundingBox  BoundingBox `json:"bounding-box,omitempty"`
+}
+
+// ElementID identifies an element within a diagram.
+//
+// The API uses numbers for IDs; strings are accepted as well.
+type ElementID string
+
+// UnmarshalJSON reads an ID from a JSON number or string.
+func (e *ElementID) UnmarshalJSON(data []byte) error {
+	var s string
+	if bytes.HasPrefix(data, []byte(`"`)) {
+		err := json.Unmarshal(data, &s)
+		if err != nil {
+			return err
+		}
+	} else {
+		var n json.Number
+		err := json.Unmarshal(data, &n)
+		if err != nil {
+			return fmt.Errorf("invalid element id %s", data)
+		}
+		s = n.String()
+	}
+	*e = ElementID(s)
+	return nil
+}
+
+// Mermaid returns the diagram as a Mermaid flowchart.
+//
+// Nodes are labeled with the text inside them. Text that does not belong
+// to a node or an edge is not included.
+// See:
+// https://mermaid-js.github.io/mermaid/#/flowchart
+func (d DiagramResult) Mermaid() string {
+	nodes := make(map[ElementID]string)
+	labels := make(map[ElementID][]string)
+	var nodeOrder []DiagramElement
+	var edges []DiagramElement
+	var texts []DiagramElement
+
+	for _, e := range d.Elements {
+		switch e.Type {
+		case DiagramNode:
+			nodes[e.ID] = fmt.Sprintf("n%d", len(nodeOrder)+1)
+			nodeOrder = append(nodeOrder, e)
+		case DiagramEdge:
+			edges = append(edges, e)
+		case DiagramText:
+			texts = append(texts, e)
+		}
+	}
+
+	// Text belongs to its parent, if given, or to the node that contains it.
+	for _, t := range texts {
+		owner := t.Parent
+		if owner == "" {
+			for _, n := range nodeOrder {
+				if contains(n.BoundingBox, t.BoundingBox) {
+					owner = n.ID
+					break
+				}
+			}
+		}
+		if owner != "" {
+			labels[owner] = append(labels[owner], t.Label)
+		}
+	}
+
+	var sb strings.Builder
+	sb.WriteString("flowchart TD\n")
+	for _, n := range nodeOrder {
+		label := n.Label
+		if l, ok := labels[n.ID]; ok {
+			label = strings.Join(l, " ")
+		}
+		open, close := mermaidShape(n.Kind)
+		sb.WriteString(fmt.Sprintf("    %v%v%v%v\n", nodes[n.ID], open, mermaidLabel(label), close))
+	}
+
+	for _, e := range edges {
+		if len(e.Connected) != 2 {
+			continue
+		}
+		a, okA := nodes[e.Connected[0]]
+		b, okB := nodes[e.Connected[1]]
+		if !okA || !okB {
+			continue
+		}
+
+		arrow := "---"
+		p1 := e.P1Decoration == arrowHead
+		p2 := e.P2Decoration == arrowHead
+		switch {
+		case p1 && p2:
+			arrow = "<-->"
+		case p2:
+			arrow = "-->"
+		case p1:
+			a, b = b, a
+			arrow = "-->"
+		}
+
+		label := e.Label
+		if l, ok := labels[e.ID]; ok {
+			label = strings.Join(l, " ")
+		}
+		if label != "" {
+			arrow += "|" + mermaidLabel(label) + "|"
+		}
+		sb.WriteString(fmt.Sprintf("    %v %v %v\n", a, arrow, b))
+	}
+
+	return sb.String()
+}
+
+// mermaidShape returns the delimiters for a node shape.
+func mermaidShape(kind string) (string, string) {
+	switch kind {
+	case "rounded-rectangle":
+		return "(", ")"
+	case "circle":
+		return "((", "))"
+	case "ellipse":
+		return "([", "])"
+	case "rhombus":
+		return "{", "}"
+	case "parallelogram":
+		return "[/", "/]"
+	case "polygon":
+		return "{{", "}}"
+	default:
+		return "[", "]"
+	}
+}
+
+// mermaidLabel quotes a label so that it can contain special characters.
+func mermaidLabel(s string) string {
+	return `"` + strings.ReplaceAll(s, `"`, "#quot;") + `"`
+}
+
+// contains tells if b is inside of a.
+func contains(a, b BoundingBox) bool {
+	return b.X >= a.X && b.Y >= a.Y &&
+		b.X+b.Width <= a.X+a.Width && b.Y+b.Height <= a.Y+a.Height
+}
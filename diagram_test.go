@@ -0,0 +1,66 @@
+package rescript
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const sampleDiagram = `{
+	"type": "Diagram",
+	"elements": [
+		{"id": 1, "type": "Node", "kind": "rectangle",
+		 "bounding-box": {"x": 10, "y": 10, "width": 30, "height": 15}},
+		{"id": 2, "type": "Node", "kind": "circle",
+		 "bounding-box": {"x": 10, "y": 50, "width": 20, "height": 20}},
+		{"id": 3, "type": "Edge", "kind": "line", "connected": [1, 2],
+		 "p2Decoration": "arrow-head"},
+		{"id": 4, "type": "Text", "label": "Start",
+		 "bounding-box": {"x": 15, "y": 12, "width": 10, "height": 5}},
+		{"id": "5", "type": "Text", "label": "End", "parent": 2}
+	]
+}`
+
+func TestDiagramResult(t *testing.T) {
+	assert := assert.New(t)
+
+	var d DiagramResult
+	err := json.Unmarshal([]byte(sampleDiagram), &d)
+	assert.Nil(err)
+	assert.Len(d.Elements, 5)
+	assert.Equal(ElementID("1"), d.Elements[0].ID)
+	assert.Equal([]ElementID{"1", "2"}, d.Elements[2].Connected)
+	assert.Equal(ElementID("5"), d.Elements[4].ID)
+	assert.Equal(ElementID("2"), d.Elements[4].Parent)
+
+	err = json.Unmarshal([]byte(`{"id": true}`), &DiagramElement{})
+	assert.NotNil(err)
+}
+
+func TestMermaid(t *testing.T) {
+	assert := assert.New(t)
+
+	var d DiagramResult
+	err := json.Unmarshal([]byte(sampleDiagram), &d)
+	assert.Nil(err)
+
+	expected := "flowchart TD\n" +
+		"    n1[\"Start\"]\n" +
+		"    n2((\"End\"))\n" +
+		"    n1 --> n2\n"
+	assert.Equal(expected, d.Mermaid())
+
+	// arrow at the start, label, unknown node
+	d = DiagramResult{Elements: []DiagramElement{
+		{ID: "a", Type: DiagramNode, Kind: "rhombus", Label: `say "hi"`},
+		{ID: "b", Type: DiagramNode, Kind: "ellipse"},
+		{ID: "c", Type: DiagramEdge, Connected: []ElementID{"a", "b"}, P1Decoration: arrowHead, Label: "no"},
+		{ID: "d", Type: DiagramEdge, Connected: []ElementID{"a", "x"}},
+	}}
+	expected = "flowchart TD\n" +
+		"    n1{\"say #quot;hi#quot;\"}\n" +
+		"    n2([\"\"])\n" +
+		"    n2 -->|\"no\"| n1\n"
+	assert.Equal(expected, d.Mermaid())
+}
@@ -0,0 +1,78 @@
+package rescript
+
+import (
+	"bufio"
+	"io"
+	"strings"
+)
+
+// Dictionary is a set of known words, e.g. names or technical terms.
+//
+// Lookups are case-insensitive.
+type Dictionary map[string]bool
+
+// NewDictionary creates a dictionary with the given words.
+func NewDictionary(words ...string) Dictionary {
+	d := make(Dictionary)
+	for _, w := range words {
+		d.Add(w)
+	}
+	return d
+}
+
+// ReadDictionary reads a dictionary with one word per line.
+//
+// Empty lines and lines starting with "#" are ignored.
+func ReadDictionary(r io.Reader) (Dictionary, error) {
+	d := make(Dictionary)
+	s := bufio.NewScanner(r)
+	for s.Scan() {
+		line := strings.TrimSpace(s.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		d.Add(line)
+	}
+	return d, s.Err()
+}
+
+// Add adds a word to the dictionary.
+func (d Dictionary) Add(word string) {
+	d[strings.ToLower(word)] = true
+}
+
+// Contains tells if the given word is in the dictionary.
+func (d Dictionary) Contains(word string) bool {
+	return d[strings.ToLower(word)]
+}
+
+// NewDictionaryFunc creates a PipelineFunc that resolves words
+// with alternative readings with the given dictionary.
+//
+// If the recognized text of a word is in the dictionary, it is kept.
+// Otherwise, the first candidate that is found in the dictionary is used.
+// In both cases, the alternatives are dropped.
+// Words without a match in the dictionary are not changed.
+func NewDictionaryFunc(d Dictionary) PipelineFunc {
+	return func(l *TokenList) *TokenList {
+		it := l.Iter()
+		for it.Next() {
+			node := it.Node()
+			t := node.Token()
+			if len(t.Alternatives()) == 0 {
+				continue
+			}
+			if d.Contains(t.String()) {
+				node.Update(t.resolve(t.String()))
+				continue
+			}
+			for _, c := range t.Candidates() {
+				if d.Contains(c) {
+					node.Update(t.resolve(c))
+					break
+				}
+			}
+		}
+		return l
+	}
+}
@@ -0,0 +1,71 @@
+package rescript
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReadDictionary(t *testing.T) {
+	assert := assert.New(t)
+
+	d, err := ReadDictionary(strings.NewReader("# names\nAlice\n\n  Bob  \n"))
+	assert.Nil(err)
+	assert.Equal(2, len(d))
+	assert.True(d.Contains("alice"))
+	assert.True(d.Contains("BOB"))
+	assert.False(d.Contains("# names"))
+}
+
+func TestDictionaryFunc(t *testing.T) {
+	assert := assert.New(t)
+
+	r := Result{
+		Words: []Word{
+			Word{Label: "Alise", Candidates: []string{"Alise", "Alice", "Alike"}},
+			Word{Label: " "},
+			Word{Label: "met", Candidates: []string{"met", "net"}},
+			Word{Label: " "},
+			Word{Label: "Bob", Candidates: []string{"Bob", "Bab"}},
+		},
+	}
+	l := NewDictionaryFunc(NewDictionary("alice", "Bob"))(ToTokenList(r))
+	assert.Equal("Alice met Bob", l.String())
+
+	n := l.First()
+	assert.Empty(n.Token().Alternatives())
+	// no match in the dictionary, the alternatives are kept
+	assert.Equal([]string{"net"}, n.Ahead(2).Token().Alternatives())
+	assert.Empty(n.Ahead(4).Token().Alternatives())
+}
+
+func TestMarkUncertain(t *testing.T) {
+	assert := assert.New(t)
+
+	r := Result{
+		Words: []Word{
+			Word{Label: "hello", Candidates: []string{"hello", "hallo", "hells"}},
+			Word{Label: " "},
+			Word{Label: "world", Candidates: []string{"world"}},
+			Word{Label: " "},
+			Word{Label: "wonld", Candidates: []string{"world", "wonld", "would"}},
+		},
+	}
+	m := Metadata{PageIDs: []string{"p1"}}
+	nodes := map[string]*TokenList{"p1": ToTokenList(r)}
+
+	var buf bytes.Buffer
+	c := NewMarkdownComposerOptions(ComposeOptions{MarkUncertain: true})
+	err := c(&buf, m, nodes)
+	assert.Nil(err)
+	// the first candidate is not uncertain, even with alternatives
+	assert.Contains(buf.String(), "hello world wonld{?world|would}\n")
+
+	buf.Reset()
+	c = NewPlaintextComposer()
+	err = c(&buf, m, nodes)
+	assert.Nil(err)
+	assert.Contains(buf.String(), "hello world wonld\n")
+}
@@ -0,0 +1,284 @@
+package rescript
+
+import (
+	"crypto/sha1"
+	"encoding/binary"
+	"encoding/hex"
+	"hash/fnv"
+	"math"
+	"strings"
+
+	"github.com/akeil/rmtool/pkg/lines"
+)
+
+// spliceMargin is the distance in pixels that new strokes must keep
+// from recognized words to be recognized on their own.
+const spliceMargin = 10
+
+// pageState is the recognition result for a page
+// together with the strokes it was created from.
+//
+// It is kept in the cache to recognize only the strokes
+// that were added to the page since.
+type pageState struct {
+	// Strokes maps stroke IDs to a hash of their points.
+	Strokes map[string]uint64 `json:"strokes"`
+	Result  Result            `json:"result"`
+}
+
+// newPageState records the strokes behind a result.
+func newPageState(groups []StrokeGroup, res Result) pageState {
+	s := pageState{
+		Strokes: make(map[string]uint64),
+		Result:  res,
+	}
+	for _, g := range groups {
+		for _, st := range g.Strokes {
+			s.Strokes[st.ID] = strokeHash(st)
+		}
+	}
+	return s
+}
+
+// added returns the strokes that are not part of the recorded state.
+//
+// It returns false if strokes were changed or removed
+// or if a new stroke overlaps a recognized word.
+// In that case, the page must be recognized again.
+func (s pageState) added(groups []StrokeGroup) ([]StrokeGroup, bool) {
+	var words []lines.Rect
+	for _, w := range s.Result.Words {
+		if strings.TrimSpace(w.Label) == "" || w.BoundingBox.IsZero() {
+			continue
+		}
+		words = append(words, grow(toRect(w.BoundingBox), spliceMargin))
+	}
+
+	found := 0
+	var added []StrokeGroup
+	for _, g := range groups {
+		var strokes []Stroke
+		for _, st := range g.Strokes {
+			h, ok := s.Strokes[st.ID]
+			if ok {
+				if h != strokeHash(st) {
+					return nil, false
+				}
+				found++
+				continue
+			}
+
+			b := strokeBounds(st)
+			for _, wb := range words {
+				if wb.Overlaps(b) {
+					return nil, false
+				}
+			}
+			strokes = append(strokes, st)
+		}
+		if len(strokes) != 0 {
+			added = append(added, StrokeGroup{PenStyle: g.PenStyle, Strokes: strokes})
+		}
+	}
+
+	if found != len(s.Strokes) {
+		// some strokes were removed
+		return nil, false
+	}
+	return added, true
+}
+
+// pageKey derives the cache key for the state of a page.
+//
+// It depends on the page and the configuration of the request,
+// but not on the strokes.
+func pageKey(pageID string, req Request) string {
+	req.StrokeGroups = nil
+	cs := sha1.New()
+	cs.Write([]byte(pageID))
+	req.checksum(cs)
+	return "page-" + hex.EncodeToString(cs.Sum(nil))
+}
+
+// strokeHash identifies a stroke by its points.
+//
+// Timestamps are not included, as they depend on the strokes before.
+func strokeHash(s Stroke) uint64 {
+	h := fnv.New64a()
+	h.Write([]byte(s.PointerType))
+	for i := range s.X {
+		binary.Write(h, binary.LittleEndian, int64(s.X[i]))
+		binary.Write(h, binary.LittleEndian, int64(s.Y[i]))
+	}
+	return h.Sum64()
+}
+
+// strokeBounds returns the bounding box of a stroke in pixels.
+func strokeBounds(s Stroke) lines.Rect {
+	var b lines.Rect
+	for i := range s.X {
+		p := lines.Point{X: float32(s.X[i]), Y: float32(s.Y[i])}
+		if i == 0 {
+			b = lines.Rect{Min: p, Max: p}
+		} else {
+			b = b.Union(lines.Rect{Min: p, Max: p})
+		}
+	}
+	return b
+}
+
+func grow(r lines.Rect, d float32) lines.Rect {
+	r.Min.X -= d
+	r.Min.Y -= d
+	r.Max.X += d
+	r.Max.Y += d
+	return r
+}
+
+// wordLine is a line of recognized words with its vertical extent in mm.
+type wordLine struct {
+	words       []Word
+	top, bottom float64
+}
+
+// splitWords splits recognized words into lines.
+//
+// Empty lines have no vertical extent; this includes the empty line
+// after a trailing newline.
+func splitWords(words []Word) []wordLine {
+	var result []wordLine
+	current := wordLine{top: math.Inf(1), bottom: math.Inf(-1)}
+	for _, w := range words {
+		if w.Label == "\n" {
+			result = append(result, current)
+			current = wordLine{top: math.Inf(1), bottom: math.Inf(-1)}
+			continue
+		}
+		if !w.BoundingBox.IsZero() {
+			current.top = math.Min(current.top, w.BoundingBox.Y)
+			current.bottom = math.Max(current.bottom, w.BoundingBox.Y+w.BoundingBox.Height)
+		}
+		current.words = append(current.words, w)
+	}
+	if len(current.words) != 0 || len(words) != 0 && words[len(words)-1].Label == "\n" {
+		result = append(result, current)
+	}
+	return result
+}
+
+// sameLine tells if two lines overlap by at least half the smaller height.
+func (l wordLine) sameLine(o wordLine) bool {
+	overlap := math.Min(l.bottom, o.bottom) - math.Max(l.top, o.top)
+	h := math.Min(l.bottom-l.top, o.bottom-o.top)
+	return overlap > 0 && overlap >= h/2
+}
+
+// left returns the leftmost position of the words in the line.
+func (l wordLine) left() float64 {
+	x := math.Inf(1)
+	for _, w := range l.words {
+		if !w.BoundingBox.IsZero() {
+			x = math.Min(x, w.BoundingBox.X)
+		}
+	}
+	return x
+}
+
+// insert adds the words from o to the line, by their horizontal position.
+func (l *wordLine) insert(o wordLine) {
+	x := o.left()
+	i := 0
+	for j, w := range l.words {
+		if strings.TrimSpace(w.Label) != "" && !w.BoundingBox.IsZero() && w.BoundingBox.X < x {
+			i = j + 1
+		}
+	}
+
+	space := Word{Label: " "}
+	words := make([]Word, 0, len(l.words)+len(o.words)+1)
+	words = append(words, l.words[:i]...)
+	if i == 0 {
+		words = append(words, o.words...)
+		words = append(words, space)
+	} else {
+		words = append(words, space)
+		words = append(words, o.words...)
+	}
+	words = append(words, l.words[i:]...)
+
+	l.words = words
+	l.top = math.Min(l.top, o.top)
+	l.bottom = math.Max(l.bottom, o.bottom)
+}
+
+// spliceResult adds the words from part to the result by their position.
+//
+// Lines from part that are level with a line in base are merged into it,
+// other lines are inserted in order from top to bottom.
+// Empty lines from part are dropped; empty lines in base,
+// including a trailing newline, are kept.
+func spliceResult(base, part Result) Result {
+	ls := splitWords(base.Words)
+	for _, pl := range splitWords(part.Words) {
+		if len(pl.words) == 0 {
+			continue
+		}
+		merged := false
+		for i := range ls {
+			if ls[i].sameLine(pl) {
+				ls[i].insert(pl)
+				merged = true
+				break
+			}
+		}
+		if merged {
+			continue
+		}
+
+		i := 0
+		for i < len(ls) && ls[i].top <= pl.top {
+			i++
+		}
+		ls = append(ls, wordLine{})
+		copy(ls[i+1:], ls[i:])
+		ls[i] = pl
+	}
+
+	res := base
+	res.Words = nil
+	var label strings.Builder
+	for i, l := range ls {
+		if i != 0 {
+			res.Words = append(res.Words, Word{Label: "\n"})
+			label.WriteString("\n")
+		}
+		for _, w := range l.words {
+			res.Words = append(res.Words, w)
+			label.WriteString(w.Label)
+		}
+	}
+	res.Label = label.String()
+	res.BoundingBox = unionBox(base.BoundingBox, part.BoundingBox)
+	// character positions refer to the original labels
+	res.Chars = nil
+	res.Linebreaks = nil
+
+	return res
+}
+
+func unionBox(a, b BoundingBox) BoundingBox {
+	if a.IsZero() {
+		return b
+	}
+	if b.IsZero() {
+		return a
+	}
+	x := math.Min(a.X, b.X)
+	y := math.Min(a.Y, b.Y)
+	return BoundingBox{
+		X:      x,
+		Y:      y,
+		Width:  math.Max(a.X+a.Width, b.X+b.Width) - x,
+		Height: math.Max(a.Y+a.Height, b.Y+b.Height) - y,
+	}
+}
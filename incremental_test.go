@@ -0,0 +1,260 @@
+package rescript
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/akeil/rmtool/pkg/lines"
+)
+
+// mm converts pixels to the millimeters used in results.
+func mm(px float64) float64 {
+	return px * mmPerInch / defaultResolution
+}
+
+func box(x, y, w, h float64) BoundingBox {
+	return BoundingBox{X: mm(x), Y: mm(y), Width: mm(w), Height: mm(h)}
+}
+
+func strokeAt(x, y float32) lines.Stroke {
+	return lines.Stroke{
+		BrushType: lines.BallpointV5,
+		Dots:      []lines.Dot{{X: x, Y: y}, {X: x + 100, Y: y + 30}},
+	}
+}
+
+func TestRecognizeIncremental(t *testing.T) {
+	backends := map[string]func(t *testing.T) Cache{
+		"file": func(t *testing.T) Cache {
+			return NewFileCache(t.TempDir(), CacheLimits{})
+		},
+		"kv": func(t *testing.T) Cache {
+			c, err := OpenKVCache(filepath.Join(t.TempDir(), "hwr.kv"), CacheLimits{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			return c
+		},
+	}
+	for name, open := range backends {
+		t.Run(name, func(t *testing.T) {
+			c := open(t)
+			defer c.Close()
+			testRecognizeIncremental(t, c)
+		})
+	}
+}
+
+func testRecognizeIncremental(t *testing.T, c Cache) {
+	assert := assert.New(t)
+
+	// all calls to the API fail
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+	}))
+	defer srv.Close()
+
+	r := NewRecognizer("", "", "")
+	r.SetCache(c)
+	r.ms.host = srv.URL
+
+	d := lines.NewDrawing()
+	d.Layers[0].Strokes = []lines.Stroke{strokeAt(100, 100)}
+	groups := r.strokeGroups(d)
+	req := prepareRequest(LangEN, Lexicon{})
+	prev := Result{
+		Label: "Hello",
+		Words: []Word{{Label: "Hello", BoundingBox: box(100, 100, 100, 30)}},
+	}
+	state := newPageState(groups, prev)
+	r.writeCache(pageKey("p", req), state)
+
+	// a new line below the existing text
+	d.Layers[0].Strokes = append(d.Layers[0].Strokes, strokeAt(100, 500))
+	added, ok := state.added(r.strokeGroups(d))
+	assert.True(ok)
+	assert.Len(added, 1)
+	assert.Len(added[0].Strokes, 1)
+
+	// the new strokes are recognized on their own, here from the cache
+	part := prepareRequest(LangEN, Lexicon{})
+	part.StrokeGroups = added
+	k, err := cacheKey(part)
+	assert.Nil(err)
+	r.writeCache(k, Result{
+		Label: "world",
+		Words: []Word{{Label: "world", BoundingBox: box(100, 500, 100, 30)}},
+	})
+
+	l, err := r.recognizePage(context.Background(), "p", d, LangEN)
+	assert.Nil(err)
+	assert.Equal("Hello\nworld", l.String())
+
+	// the page state includes the new strokes
+	var next pageState
+	assert.Nil(r.readCache(pageKey("p", req), &next))
+	assert.Len(next.Strokes, 2)
+	assert.Equal("Hello\nworld", next.Result.Label)
+
+	// the next run only recognizes the strokes added since
+	d.Layers[0].Strokes = append(d.Layers[0].Strokes, strokeAt(100, 900))
+	added, ok = next.added(r.strokeGroups(d))
+	assert.True(ok)
+	part.StrokeGroups = added
+	k, err = cacheKey(part)
+	assert.Nil(err)
+	r.writeCache(k, Result{
+		Label: "again",
+		Words: []Word{{Label: "again", BoundingBox: box(100, 900, 100, 30)}},
+	})
+
+	l, err = r.recognizePage(context.Background(), "p", d, LangEN)
+	assert.Nil(err)
+	assert.Equal("Hello\nworld\nagain", l.String())
+	assert.Nil(r.readCache(pageKey("p", req), &next))
+	assert.Len(next.Strokes, 3)
+
+	// the combined result is not stored as a result for all strokes
+	full := prepareRequest(LangEN, Lexicon{})
+	full.StrokeGroups = r.strokeGroups(d)
+	k, err = cacheKey(full)
+	assert.Nil(err)
+	var res Result
+	assert.NotNil(r.readCache(k, &res))
+
+	// without changes, the page state is used again
+	l, err = r.recognizePage(context.Background(), "p", d, LangEN)
+	assert.Nil(err)
+	assert.Equal("Hello\nworld\nagain", l.String())
+
+	// other pages have their own state
+	assert.NotEqual(pageKey("p", req), pageKey("q", req))
+	de := prepareRequest(LangDE, Lexicon{})
+	assert.NotEqual(pageKey("p", req), pageKey("p", de))
+}
+
+func TestPageStateAdded(t *testing.T) {
+	assert := assert.New(t)
+
+	r := NewRecognizer("", "", "")
+	d := lines.NewDrawing()
+	d.Layers[0].Strokes = []lines.Stroke{strokeAt(100, 100), strokeAt(100, 500)}
+	s := newPageState(r.strokeGroups(d), Result{
+		Words: []Word{{Label: "Hello", BoundingBox: box(100, 100, 100, 30)}},
+	})
+
+	// nothing changed
+	added, ok := s.added(r.strokeGroups(d))
+	assert.True(ok)
+	assert.Empty(added)
+
+	// a new stroke close to a word
+	d.Layers[0].Strokes = append(d.Layers[0].Strokes, strokeAt(205, 110))
+	_, ok = s.added(r.strokeGroups(d))
+	assert.False(ok)
+
+	// a changed stroke
+	d.Layers[0].Strokes = []lines.Stroke{strokeAt(100, 100), strokeAt(100, 510)}
+	_, ok = s.added(r.strokeGroups(d))
+	assert.False(ok)
+
+	// a removed stroke
+	d.Layers[0].Strokes = []lines.Stroke{strokeAt(100, 100)}
+	_, ok = s.added(r.strokeGroups(d))
+	assert.False(ok)
+
+	// the state can be stored
+	data, err := json.Marshal(s)
+	assert.Nil(err)
+	var loaded pageState
+	assert.Nil(json.Unmarshal(data, &loaded))
+	assert.Equal(s.Strokes, loaded.Strokes)
+}
+
+func TestPageStateErased(t *testing.T) {
+	assert := assert.New(t)
+
+	r := NewRecognizer("", "", "")
+	d := lines.NewDrawing()
+	long := lines.Stroke{
+		BrushType: lines.BallpointV5,
+		Dots:      []lines.Dot{{X: 100, Y: 100}, {X: 200, Y: 100}, {X: 300, Y: 100}},
+	}
+	eraser := lines.Stroke{
+		BrushType: lines.Eraser,
+		Dots:      []lines.Dot{{X: 200, Y: 50, Width: 10}, {X: 200, Y: 150, Width: 10}},
+	}
+	d.Layers[0].Strokes = []lines.Stroke{long, eraser}
+
+	// the parts of the erased stroke have their own IDs
+	groups := r.strokeGroups(d)
+	assert.Len(groups[0].Strokes, 2)
+	assert.NotEqual(groups[0].Strokes[0].ID, groups[0].Strokes[1].ID)
+
+	s := newPageState(groups, Result{})
+	assert.Len(s.Strokes, 2)
+	added, ok := s.added(r.strokeGroups(d))
+	assert.True(ok)
+	assert.Empty(added)
+}
+
+func TestSpliceResult(t *testing.T) {
+	assert := assert.New(t)
+
+	base := Result{
+		Words: []Word{
+			{Label: "Hello", BoundingBox: box(100, 100, 100, 30)},
+			{Label: " "},
+			{Label: "world", BoundingBox: box(400, 100, 100, 30)},
+			{Label: "\n"},
+			{Label: "bye", BoundingBox: box(100, 300, 100, 30)},
+		},
+	}
+
+	// a word in the middle of a line
+	res := spliceResult(base, Result{
+		Words: []Word{{Label: "there", BoundingBox: box(250, 105, 100, 30)}},
+	})
+	assert.Equal("Hello there world\nbye", res.Label)
+
+	// words at the start and end of lines
+	res = spliceResult(res, Result{
+		Words: []Word{
+			{Label: "Oh", BoundingBox: box(20, 100, 50, 30)},
+			{Label: "\n"},
+			{Label: "now", BoundingBox: box(250, 300, 100, 30)},
+		},
+	})
+	assert.Equal("Oh Hello there world\nbye now", res.Label)
+
+	// new lines between and after existing lines
+	res = spliceResult(res, Result{
+		Words: []Word{
+			{Label: "middle", BoundingBox: box(100, 200, 100, 30)},
+			{Label: "\n"},
+			{Label: "end", BoundingBox: box(100, 400, 100, 30)},
+		},
+	})
+	assert.Equal("Oh Hello there world\nmiddle\nbye now\nend", res.Label)
+	assert.Equal(res.Label, ToTokenList(res).String())
+
+	// a trailing newline is kept
+	res = spliceResult(Result{
+		Words: []Word{
+			{Label: "Hello", BoundingBox: box(100, 100, 100, 30)},
+			{Label: "\n"},
+		},
+	}, Result{
+		Words: []Word{
+			{Label: "world", BoundingBox: box(100, 200, 100, 30)},
+			{Label: "\n"},
+		},
+	})
+	assert.Equal("Hello\nworld\n", res.Label)
+}
@@ -0,0 +1,561 @@
+package rescript
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	kvMagic = "rskv"
+	// kvHeaderSize is magic, key length, value length and time.
+	kvHeaderSize = 4 + 4 + 4 + 8
+	// kvStatsKey is the key for the saved counters;
+	// it is not a valid cache key.
+	kvStatsKey = ""
+	// kvMaxKey and kvMaxValue limit the size of an entry,
+	// so that a damaged header cannot cause huge allocations.
+	kvMaxKey   = 1 << 10
+	kvMaxValue = 1 << 26
+	// kvScanSize is the size of the chunks that are searched
+	// for the next entry after a damaged one.
+	kvScanSize = 1 << 16
+)
+
+// KVCache is a Cache that keeps all entries in a single file.
+//
+// Entries are appended to the file, each with a checksum.
+// An index of the entries is kept in memory.
+// Damaged entries are skipped when the file is opened;
+// an incomplete entry at the end, e.g. after a crash, is dropped.
+//
+// Entries are evicted by the time they were written;
+// Prune rewrites the file without the evicted entries.
+// The file is locked while it is open,
+// so it cannot be used by more than one process at a time.
+type KVCache struct {
+	path     string
+	limits   CacheLimits
+	mx       sync.Mutex
+	f        *os.File
+	index    map[string]kvEntry
+	end      int64
+	saved    cacheCounters
+	counters cacheCounters
+	// size is the total size of the entries without the statistics.
+	size int64
+	// writes counts the writes since the last call to prune.
+	writes int
+	pruned bool
+}
+
+// kvEntry is the position of a value in the file.
+type kvEntry struct {
+	offset  int64
+	keyLen  uint32
+	valLen  uint32
+	written time.Time
+}
+
+func (e kvEntry) size() int64 {
+	return kvHeaderSize + int64(e.keyLen) + int64(e.valLen) + 4
+}
+
+// OpenKVCache opens or creates the cache file at the given path.
+//
+// It fails if the file is not a cache file
+// or if it is used by another process.
+func OpenKVCache(path string, limits CacheLimits) (*KVCache, error) {
+	err := os.MkdirAll(filepath.Dir(path), 0755)
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, err
+	}
+	err = lockFile(f)
+	if err != nil {
+		f.Close()
+		return nil, fmt.Errorf("failed to lock cache %q: %v", path, err)
+	}
+
+	c := &KVCache{
+		path:   path,
+		limits: limits,
+		f:      f,
+	}
+	err = c.load()
+	if err != nil {
+		f.Close()
+		return nil, fmt.Errorf("failed to read cache %q: %v", path, err)
+	}
+	return c, nil
+}
+
+// load builds the index from the file.
+//
+// Damaged entries are skipped up to the next valid entry.
+// If the file ends with an incomplete entry, it is truncated;
+// other damaged data is kept until the file is rewritten.
+func (c *KVCache) load() error {
+	c.index = make(map[string]kvEntry)
+	c.end = 0
+	c.size = 0
+
+	info, err := c.f.Stat()
+	if err != nil {
+		return err
+	}
+	size := info.Size()
+	head := make([]byte, len(kvMagic))
+	n, err := c.f.ReadAt(head, 0)
+	if err != nil && err != io.EOF {
+		return err
+	}
+	if !bytes.HasPrefix([]byte(kvMagic), head[:n]) {
+		return fmt.Errorf("not a cache file")
+	}
+
+	off := int64(0)
+	for off < size {
+		key, val, e, err := readKVRecord(io.NewSectionReader(c.f, off, size-off), off)
+		if err == nil {
+			if key == kvStatsKey {
+				c.saved = cacheCounters{}
+				json.Unmarshal(val, &c.saved)
+			}
+			c.add(key, e)
+			off += e.size()
+			c.end = off
+			continue
+		}
+
+		next, ok := c.resync(off+1, size)
+		if ok {
+			off = next
+			continue
+		}
+		if err == io.ErrUnexpectedEOF {
+			// an incomplete write at the end of the file
+			return c.f.Truncate(c.end)
+		}
+		c.end = size
+		break
+	}
+	return nil
+}
+
+// resync returns the offset of the next valid entry
+// at or after off, if there is one.
+func (c *KVCache) resync(off, size int64) (int64, bool) {
+	buf := make([]byte, kvScanSize)
+	for off < size {
+		n, err := c.f.ReadAt(buf, off)
+		if err != nil && err != io.EOF {
+			return 0, false
+		}
+		if n < len(kvMagic) {
+			return 0, false
+		}
+		i := bytes.Index(buf[:n], []byte(kvMagic))
+		if i < 0 {
+			// the magic may start in the last bytes
+			off += int64(n - len(kvMagic) + 1)
+			continue
+		}
+
+		at := off + int64(i)
+		_, _, _, err = readKVRecord(io.NewSectionReader(c.f, at, size-at), at)
+		if err == nil {
+			return at, true
+		}
+		off = at + 1
+	}
+	return 0, false
+}
+
+// add adds an entry to the index, replacing an entry with the same key.
+func (c *KVCache) add(key string, e kvEntry) {
+	if key != kvStatsKey {
+		if old, ok := c.index[key]; ok {
+			c.size -= old.size()
+		}
+		c.size += e.size()
+	}
+	c.index[key] = e
+}
+
+// Get reads the entry for the given key.
+func (c *KVCache) Get(key string) ([]byte, error) {
+	if !cacheKeyRe.MatchString(key) {
+		return nil, fmt.Errorf("invalid cache key %q", key)
+	}
+
+	c.mx.Lock()
+	defer c.mx.Unlock()
+
+	val, err := c.read(key)
+	switch {
+	case err == ErrCacheMiss:
+		c.counters.Misses++
+	case err != nil:
+		c.counters.Corrupt++
+	default:
+		c.counters.Hits++
+	}
+	return val, err
+}
+
+// read returns the value for the given key.
+// A damaged entry is removed from the index.
+func (c *KVCache) read(key string) ([]byte, error) {
+	e, ok := c.index[key]
+	if !ok {
+		return nil, ErrCacheMiss
+	}
+
+	_, val, _, err := readKVRecord(io.NewSectionReader(c.f, e.offset, e.size()), e.offset)
+	if err != nil {
+		delete(c.index, key)
+		c.size -= e.size()
+		return nil, fmt.Errorf("%w: %v", ErrCacheCorrupt, key)
+	}
+	return val, nil
+}
+
+// Put appends an entry to the file
+// and evicts old entries if the cache exceeds its limits.
+//
+// An existing entry is replaced by appending a new one;
+// the space of the old entry is reclaimed by Prune.
+// If the entry has the same data, Put does nothing.
+// Values larger than kvMaxValue are rejected.
+//
+// If the cache is full, entries are evicted down to a low-water mark,
+// so that the file is not rewritten with each write.
+// Expired entries are evicted with the first write
+// and then every pruneEvery writes.
+func (c *KVCache) Put(key string, data []byte) error {
+	if !cacheKeyRe.MatchString(key) {
+		return fmt.Errorf("invalid cache key %q", key)
+	}
+	if len(data) > kvMaxValue {
+		return fmt.Errorf("cache entry %q too large: %d bytes", key, len(data))
+	}
+
+	c.mx.Lock()
+	defer c.mx.Unlock()
+
+	if e, ok := c.index[key]; ok && int(e.valLen) == len(data) {
+		old, err := c.read(key)
+		if err == nil && bytes.Equal(old, data) {
+			return nil
+		}
+	}
+	err := c.append(key, data, time.Now())
+	if err != nil {
+		return fmt.Errorf("failed to write cache entry: %v", err)
+	}
+
+	c.writes++
+	if c.limits.MaxSize == 0 && c.limits.MaxAge == 0 {
+		return nil
+	}
+	full := c.limits.MaxSize > 0 && c.size > c.limits.MaxSize
+	expire := c.limits.MaxAge > 0 && c.writes >= pruneEvery
+	if c.pruned && !full && !expire {
+		return nil
+	}
+
+	limit := c.limits.MaxSize
+	if full {
+		limit = int64(float64(limit) * pruneLowWater)
+	}
+	_, err = c.prune(limit, false)
+	return err
+}
+
+func (c *KVCache) append(key string, data []byte, t time.Time) error {
+	rec := encodeKVRecord(key, data, t)
+	_, err := c.f.WriteAt(rec, c.end)
+	if err != nil {
+		return err
+	}
+	err = c.f.Sync()
+	if err != nil {
+		return err
+	}
+
+	c.add(key, kvEntry{
+		offset:  c.end,
+		keyLen:  uint32(len(key)),
+		valLen:  uint32(len(data)),
+		written: t,
+	})
+	c.end += int64(len(rec))
+	return nil
+}
+
+// Each calls f for each entry in the cache.
+// Damaged entries are skipped.
+func (c *KVCache) Each(f func(key string, data []byte) error) error {
+	for _, key := range c.keys() {
+		c.mx.Lock()
+		data, err := c.read(key)
+		c.mx.Unlock()
+		if err != nil {
+			continue
+		}
+		err = f(key, data)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Stats returns information about the entries in the cache.
+// The time of last use is the time an entry was written.
+func (c *KVCache) Stats() (CacheStats, error) {
+	c.mx.Lock()
+	defer c.mx.Unlock()
+
+	var s CacheStats
+	for key, e := range c.index {
+		if key == kvStatsKey {
+			continue
+		}
+		s.Entries++
+		s.Size += e.size()
+		if s.Oldest.IsZero() || e.written.Before(s.Oldest) {
+			s.Oldest = e.written
+		}
+		if e.written.After(s.Newest) {
+			s.Newest = e.written
+		}
+	}
+
+	counters := c.saved
+	counters.add(c.counters)
+	s.Hits = counters.Hits
+	s.Misses = counters.Misses
+	s.Corrupt = counters.Corrupt
+	s.Evicted = counters.Evicted
+
+	return s, nil
+}
+
+// Prune evicts entries that are older than the maximum age
+// and the oldest entries until the cache is within its size limit.
+//
+// The file is rewritten without the evicted entries
+// and without space from replaced or damaged entries.
+func (c *KVCache) Prune() (int, error) {
+	c.mx.Lock()
+	defer c.mx.Unlock()
+
+	return c.prune(c.limits.MaxSize, true)
+}
+
+// prune evicts expired entries and old entries
+// until the cache is within the given size; 0 means no limit.
+// The file is rewritten if entries were evicted or compact is set.
+func (c *KVCache) prune(maxSize int64, compact bool) (int, error) {
+	c.writes = 0
+	c.pruned = true
+
+	var keys []string
+	var total int64
+	for key, e := range c.index {
+		if key != kvStatsKey {
+			keys = append(keys, key)
+			total += e.size()
+		}
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return c.index[keys[i]].written.Before(c.index[keys[j]].written)
+	})
+
+	n := 0
+	for _, key := range keys {
+		e := c.index[key]
+		expired := c.limits.MaxAge > 0 && time.Since(e.written) > c.limits.MaxAge
+		full := maxSize > 0 && total > maxSize
+		if !expired && !full {
+			break
+		}
+		total -= e.size()
+		n++
+	}
+	c.counters.Evicted += int64(n)
+
+	if n == 0 && !compact {
+		return 0, nil
+	}
+	return n, c.rewrite(keys[n:])
+}
+
+// Clear removes all entries and resets the statistics.
+func (c *KVCache) Clear() error {
+	c.mx.Lock()
+	defer c.mx.Unlock()
+
+	err := c.f.Truncate(0)
+	if err != nil {
+		return err
+	}
+	c.index = make(map[string]kvEntry)
+	c.end = 0
+	c.size = 0
+	c.saved = cacheCounters{}
+	c.counters = cacheCounters{}
+
+	return nil
+}
+
+// Close saves the statistics and closes the file.
+func (c *KVCache) Close() error {
+	c.mx.Lock()
+	defer c.mx.Unlock()
+
+	if c.counters != (cacheCounters{}) {
+		c.saved.add(c.counters)
+		c.counters = cacheCounters{}
+		data, err := json.Marshal(c.saved)
+		if err != nil {
+			return err
+		}
+		err = c.append(kvStatsKey, data, time.Now())
+		if err != nil {
+			return fmt.Errorf("failed to write cache stats: %v", err)
+		}
+	}
+
+	return c.f.Close()
+}
+
+func (c *KVCache) keys() []string {
+	c.mx.Lock()
+	defer c.mx.Unlock()
+
+	keys := make([]string, 0, len(c.index))
+	for key := range c.index {
+		if key != kvStatsKey {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// rewrite replaces the file with one that contains only the given entries
+// and the statistics.
+func (c *KVCache) rewrite(keys []string) error {
+	tmp, err := ioutil.TempFile(filepath.Dir(c.path), filepath.Base(c.path)+tempPattern)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	w := bufio.NewWriter(tmp)
+	if c.saved != (cacheCounters{}) {
+		data, _ := json.Marshal(c.saved)
+		w.Write(encodeKVRecord(kvStatsKey, data, time.Now()))
+	}
+	for _, key := range keys {
+		e := c.index[key]
+		_, val, _, err := readKVRecord(io.NewSectionReader(c.f, e.offset, e.size()), e.offset)
+		if err != nil {
+			// damaged entries are dropped
+			continue
+		}
+		_, err = w.Write(encodeKVRecord(key, val, e.written))
+		if err != nil {
+			tmp.Close()
+			return err
+		}
+	}
+	err = w.Flush()
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if err == nil {
+		// the new file is locked before it replaces the old one
+		err = lockFile(tmp)
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), c.path)
+	}
+	if err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write cache: %v", err)
+	}
+
+	c.f.Close()
+	c.f = tmp
+
+	return c.load()
+}
+
+// encodeKVRecord creates the bytes for an entry in the file.
+func encodeKVRecord(key string, val []byte, t time.Time) []byte {
+	rec := make([]byte, kvHeaderSize, kvHeaderSize+len(key)+len(val)+4)
+	copy(rec, kvMagic)
+	binary.LittleEndian.PutUint32(rec[4:], uint32(len(key)))
+	binary.LittleEndian.PutUint32(rec[8:], uint32(len(val)))
+	binary.LittleEndian.PutUint64(rec[12:], uint64(t.UnixNano()))
+	rec = append(rec, key...)
+	rec = append(rec, val...)
+	sum := make([]byte, 4)
+	binary.LittleEndian.PutUint32(sum, crc32.ChecksumIEEE(rec))
+	return append(rec, sum...)
+}
+
+// readKVRecord reads and verifies the entry at the current position of r.
+func readKVRecord(r io.Reader, offset int64) (string, []byte, kvEntry, error) {
+	var e kvEntry
+	header := make([]byte, kvHeaderSize)
+	_, err := io.ReadFull(r, header)
+	if err != nil {
+		return "", nil, e, err
+	}
+	if string(header[:4]) != kvMagic {
+		return "", nil, e, fmt.Errorf("invalid entry at %d", offset)
+	}
+
+	e.offset = offset
+	e.keyLen = binary.LittleEndian.Uint32(header[4:])
+	e.valLen = binary.LittleEndian.Uint32(header[8:])
+	e.written = time.Unix(0, int64(binary.LittleEndian.Uint64(header[12:])))
+	if e.keyLen > kvMaxKey || e.valLen > kvMaxValue {
+		return "", nil, e, fmt.Errorf("invalid entry at %d", offset)
+	}
+
+	body := make([]byte, int(e.keyLen)+int(e.valLen)+4)
+	_, err = io.ReadFull(r, body)
+	if err != nil {
+		return "", nil, e, err
+	}
+
+	n := len(body) - 4
+	sum := crc32.NewIEEE()
+	sum.Write(header)
+	sum.Write(body[:n])
+	if sum.Sum32() != binary.LittleEndian.Uint32(body[n:]) {
+		return "", nil, e, fmt.Errorf("checksum mismatch at %d", offset)
+	}
+
+	key := string(body[:e.keyLen])
+	return key, body[e.keyLen:n], e, nil
+}
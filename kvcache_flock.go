@@ -0,0 +1,15 @@
+//go:build !windows
+// +build !windows
+
+package rescript
+
+import (
+	"os"
+	"syscall"
+)
+
+// lockFile takes an exclusive lock on f, without waiting.
+// The lock is released when f is closed.
+func lockFile(f *os.File) error {
+	return syscall.Flock(int(f.Fd()), syscall.LOCK_EX|syscall.LOCK_NB)
+}
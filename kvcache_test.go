@@ -0,0 +1,298 @@
+package rescript
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestKVCache(t *testing.T) {
+	assert := assert.New(t)
+
+	p := filepath.Join(t.TempDir(), "hwr.kv")
+	c, err := OpenKVCache(p, CacheLimits{})
+	assert.Nil(err)
+
+	_, err = c.Get("abc")
+	assert.True(errors.Is(err, ErrCacheMiss))
+
+	assert.Nil(c.Put("abc", []byte(`{"label": "foo"}`)))
+	assert.Nil(c.Put("def", []byte(`{"label": "bar"}`)))
+	data, err := c.Get("abc")
+	assert.Nil(err)
+	assert.Equal(`{"label": "foo"}`, string(data))
+	assert.NotNil(c.Put("", nil))
+	assert.NotNil(c.Put("big", make([]byte, kvMaxValue+1)))
+
+	// entries and counters are kept
+	assert.Nil(c.Close())
+	c, err = OpenKVCache(p, CacheLimits{})
+	assert.Nil(err)
+	data, err = c.Get("def")
+	assert.Nil(err)
+	assert.Equal(`{"label": "bar"}`, string(data))
+
+	st, err := c.Stats()
+	assert.Nil(err)
+	assert.Equal(2, st.Entries)
+	assert.Equal(int64(2), st.Hits)
+	assert.Equal(int64(1), st.Misses)
+
+	assert.Nil(c.Clear())
+	st, err = c.Stats()
+	assert.Nil(err)
+	assert.Equal(CacheStats{}, st)
+	assert.Nil(c.Close())
+}
+
+func TestKVCacheDamaged(t *testing.T) {
+	assert := assert.New(t)
+
+	p := filepath.Join(t.TempDir(), "hwr.kv")
+	c, err := OpenKVCache(p, CacheLimits{})
+	assert.Nil(err)
+	assert.Nil(c.Put("abc", []byte("first")))
+	assert.Nil(c.Put("def", []byte("second")))
+	assert.Nil(c.f.Close())
+
+	// a partial write at the end of the file
+	info, err := os.Stat(p)
+	assert.Nil(err)
+	assert.Nil(os.Truncate(p, info.Size()-3))
+
+	c, err = OpenKVCache(p, CacheLimits{})
+	assert.Nil(err)
+	data, err := c.Get("abc")
+	assert.Nil(err)
+	assert.Equal("first", string(data))
+	_, err = c.Get("def")
+	assert.True(errors.Is(err, ErrCacheMiss))
+
+	// new entries are written after the last valid entry
+	assert.Nil(c.Put("def", []byte("again")))
+	assert.Nil(c.Close())
+	c, err = OpenKVCache(p, CacheLimits{})
+	assert.Nil(err)
+	data, err = c.Get("def")
+	assert.Nil(err)
+	assert.Equal("again", string(data))
+
+	// damaged data is detected by the checksum
+	e := c.index["abc"]
+	_, err = c.f.WriteAt([]byte("X"), e.offset+kvHeaderSize+int64(e.keyLen))
+	assert.Nil(err)
+	_, err = c.Get("abc")
+	assert.True(errors.Is(err, ErrCacheCorrupt))
+	assert.Nil(c.Close())
+}
+
+func TestKVCacheDamagedMiddle(t *testing.T) {
+	assert := assert.New(t)
+
+	p := filepath.Join(t.TempDir(), "hwr.kv")
+	c, err := OpenKVCache(p, CacheLimits{})
+	assert.Nil(err)
+	for _, key := range []string{"a", "b", "c"} {
+		assert.Nil(c.Put(key, []byte("value "+key)))
+	}
+	e := c.index["b"]
+	assert.Nil(c.f.Close())
+
+	// the header and the data of an entry are damaged
+	f, err := os.OpenFile(p, os.O_RDWR, 0644)
+	assert.Nil(err)
+	_, err = f.WriteAt([]byte("XX"), e.offset)
+	assert.Nil(err)
+	_, err = f.WriteAt([]byte("X"), e.offset+kvHeaderSize)
+	assert.Nil(err)
+	assert.Nil(f.Close())
+	info, err := os.Stat(p)
+	assert.Nil(err)
+
+	// the entries after the damaged one are kept
+	c, err = OpenKVCache(p, CacheLimits{})
+	assert.Nil(err)
+	_, err = c.Get("b")
+	assert.True(errors.Is(err, ErrCacheMiss))
+	for _, key := range []string{"a", "c"} {
+		data, err := c.Get(key)
+		assert.Nil(err)
+		assert.Equal("value "+key, string(data))
+	}
+	assert.Equal(info.Size(), c.end)
+
+	// a damaged last entry is not cut off
+	e = c.index["c"]
+	_, err = c.f.WriteAt([]byte("X"), e.offset+kvHeaderSize)
+	assert.Nil(err)
+	assert.Nil(c.f.Close())
+	c, err = OpenKVCache(p, CacheLimits{})
+	assert.Nil(err)
+	assert.Equal(info.Size(), c.end)
+	_, err = c.Get("c")
+	assert.True(errors.Is(err, ErrCacheMiss))
+
+	// Prune removes the damaged data
+	_, err = c.Prune()
+	assert.Nil(err)
+	info, err = os.Stat(p)
+	assert.Nil(err)
+	assert.Equal(c.index["a"].size(), info.Size())
+	assert.Nil(c.Close())
+}
+
+func TestKVCacheForeignFile(t *testing.T) {
+	assert := assert.New(t)
+
+	p := filepath.Join(t.TempDir(), "notes.txt")
+	assert.Nil(ioutil.WriteFile(p, []byte("my notes"), 0644))
+
+	_, err := OpenKVCache(p, CacheLimits{})
+	assert.NotNil(err)
+	data, err := ioutil.ReadFile(p)
+	assert.Nil(err)
+	assert.Equal("my notes", string(data))
+}
+
+func TestKVCacheLocked(t *testing.T) {
+	assert := assert.New(t)
+
+	p := filepath.Join(t.TempDir(), "hwr.kv")
+	c, err := OpenKVCache(p, CacheLimits{})
+	assert.Nil(err)
+	_, err = OpenKVCache(p, CacheLimits{})
+	assert.NotNil(err)
+
+	// the lock is kept when the file is rewritten
+	assert.Nil(c.Put("abc", []byte("data")))
+	_, err = c.Prune()
+	assert.Nil(err)
+	_, err = OpenKVCache(p, CacheLimits{})
+	assert.NotNil(err)
+
+	assert.Nil(c.Close())
+	c, err = OpenKVCache(p, CacheLimits{})
+	assert.Nil(err)
+	assert.Nil(c.Close())
+}
+
+func TestKVCacheEviction(t *testing.T) {
+	assert := assert.New(t)
+
+	p := filepath.Join(t.TempDir(), "hwr.kv")
+	c, err := OpenKVCache(p, CacheLimits{})
+	assert.Nil(err)
+
+	data := make([]byte, 100)
+	old := time.Now().Add(-time.Hour)
+	for i, key := range []string{"a", "b", "c", "d"} {
+		assert.Nil(c.append(key, data, old.Add(time.Duration(i)*time.Minute)))
+	}
+	size := c.index["a"].size()
+
+	c.limits = CacheLimits{MaxSize: 3 * size}
+	n, err := c.Prune()
+	assert.Nil(err)
+	assert.Equal(1, n)
+	_, err = c.Get("a")
+	assert.True(errors.Is(err, ErrCacheMiss))
+
+	// the file is rewritten without the evicted entry
+	info, err := os.Stat(p)
+	assert.Nil(err)
+	assert.Equal(3*size, info.Size())
+
+	// b is older than the maximum age, c is not
+	c.limits = CacheLimits{MaxAge: time.Hour - 90*time.Second}
+	n, err = c.Prune()
+	assert.Nil(err)
+	assert.Equal(1, n)
+	_, err = c.Get("c")
+	assert.Nil(err)
+
+	// eviction on write, down to the low-water mark
+	c.limits = CacheLimits{MaxSize: 2*size + size/2}
+	assert.Nil(c.Put("e", data))
+	_, err = c.Get("c")
+	assert.True(errors.Is(err, ErrCacheMiss))
+	_, err = c.Get("d")
+	assert.Nil(err)
+	assert.Equal(2*size, c.size)
+
+	// the file is not rewritten while the cache is below its limit
+	info, err = os.Stat(p)
+	assert.Nil(err)
+	c.limits = CacheLimits{MaxSize: 4 * size}
+	assert.Nil(c.Put("f", data))
+	next, err := os.Stat(p)
+	assert.Nil(err)
+	assert.True(os.SameFile(info, next))
+
+	st, err := c.Stats()
+	assert.Nil(err)
+	assert.Equal(3, st.Entries)
+	assert.Equal(int64(3), st.Evicted)
+	assert.Nil(c.Close())
+}
+
+func TestExportImportCache(t *testing.T) {
+	assert := assert.New(t)
+
+	dir := t.TempDir()
+	src := NewFileCache(filepath.Join(dir, "hwr"), CacheLimits{})
+	assert.Nil(src.Put("abc", []byte(`{"label": "foo"}`)))
+	assert.Nil(src.Put("def", []byte(`{"label": "bar"}`)))
+
+	var buf bytes.Buffer
+	n, err := ExportCache(&buf, src)
+	assert.Nil(err)
+	assert.Equal(2, n)
+
+	dst, err := OpenKVCache(filepath.Join(dir, "hwr.kv"), CacheLimits{})
+	assert.Nil(err)
+	n, err = ImportCache(&buf, dst)
+	assert.Nil(err)
+	assert.Equal(2, n)
+
+	data, err := dst.Get("def")
+	assert.Nil(err)
+	assert.Equal(`{"label": "bar"}`, string(data))
+	assert.Nil(dst.Close())
+
+	_, err = ImportCache(bytes.NewBufferString("not an archive"), dst)
+	assert.NotNil(err)
+}
+
+func TestKVCacheReplace(t *testing.T) {
+	assert := assert.New(t)
+
+	p := filepath.Join(t.TempDir(), "hwr.kv")
+	c, err := OpenKVCache(p, CacheLimits{})
+	assert.Nil(err)
+	assert.Nil(c.Put("abc", []byte("first")))
+	assert.Nil(c.Put("abc", []byte("second")))
+	data, err := c.Get("abc")
+	assert.Nil(err)
+	assert.Equal("second", string(data))
+
+	// the same data is not written again
+	end := c.end
+	assert.Nil(c.Put("abc", []byte("second")))
+	assert.Equal(end, c.end)
+
+	// the latest entry wins when the file is read again
+	assert.Nil(c.Close())
+	c, err = OpenKVCache(p, CacheLimits{})
+	assert.Nil(err)
+	data, err = c.Get("abc")
+	assert.Nil(err)
+	assert.Equal("second", string(data))
+	assert.Equal(c.index["abc"].size(), c.size)
+	assert.Nil(c.Close())
+}
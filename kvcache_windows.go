@@ -0,0 +1,11 @@
+package rescript
+
+import (
+	"os"
+)
+
+// lockFile does nothing on Windows;
+// the cache file must not be used by more than one process at a time.
+func lockFile(f *os.File) error {
+	return nil
+}
@@ -0,0 +1,131 @@
+package rescript
+
+import (
+	"fmt"
+	"strings"
+)
+
+// LangAuto selects the language for each page from a list of candidates,
+// see Recognizer.SetCandidates.
+const LangAuto LanguageCode = "auto"
+
+// languages are the text recognition languages supported by MyScript.
+// See:
+// https://developer.myscript.com/docs/interactive-ink/1.4/overview/text-languages/
+var languages = []LanguageCode{
+	"af_ZA", "ar", "az_AZ", "be_BY", "bg_BG", "bs_BA", "ca_ES", "ceb_PH",
+	"cs_CZ", "cy_GB", "da_DK", "de_AT", "de_DE", "el_GR", "en_CA", "en_GB",
+	"en_PH", "en_US", "es_CO", "es_ES", "es_MX", "et_EE", "eu_ES", "fa_IR",
+	"fi_FI", "fil_PH", "fr_CA", "fr_FR", "ga_IE", "gl_ES", "he_IL", "hi_IN",
+	"hr_HR", "hu_HU", "hy_AM", "id_ID", "is_IS", "it_IT", "ja_JP", "ka_GE",
+	"kk_KZ", "ko_KR", "lt_LT", "lv_LV", "mg_MG", "mk_MK", "mn_MN", "ms_MY",
+	"nl_BE", "nl_NL", "no_NO", "pl_PL", "pt_BR", "pt_PT", "ro_RO", "ru_RU",
+	"sk_SK", "sl_SI", "sq_AL", "sr_Cyrl_RS", "sr_Latn_RS", "sv_SE", "sw_TZ",
+	"th_TH", "tr_TR", "tt_RU", "uk_UA", "vi_VN", "zh_CN", "zh_HK", "zh_TW",
+}
+
+// preferred is the default variant for languages with more than one region.
+var preferred = map[string]LanguageCode{
+	"de": LangDE,
+	"en": LangEN,
+	"es": "es_ES",
+	"fr": "fr_FR",
+	"nl": "nl_NL",
+	"pt": "pt_PT",
+	"sr": "sr_Latn_RS",
+	"zh": "zh_CN",
+}
+
+// aliases maps short names like "fr" to a language code.
+var aliases = buildAliases()
+
+func buildAliases() map[string]LanguageCode {
+	count := make(map[string]int)
+	for _, lc := range languages {
+		count[lc.base()]++
+	}
+
+	a := make(map[string]LanguageCode)
+	for _, lc := range languages {
+		if b := lc.base(); count[b] == 1 {
+			a[b] = lc
+		}
+	}
+	for b, lc := range preferred {
+		a[b] = lc
+	}
+	return a
+}
+
+// Languages returns all supported language codes.
+func Languages() []LanguageCode {
+	result := make([]LanguageCode, len(languages))
+	copy(result, languages)
+	return result
+}
+
+// ParseLanguage returns the language code for the given name.
+//
+// The name is either a language code like "fr_CA"
+// or a short name like "fr", which selects the language's default region.
+// Case does not matter and "-" may be used instead of "_".
+// The special name "auto" returns LangAuto.
+func ParseLanguage(s string) (LanguageCode, error) {
+	name := strings.ToLower(strings.ReplaceAll(strings.TrimSpace(s), "-", "_"))
+	if name == string(LangAuto) {
+		return LangAuto, nil
+	}
+	if lc, ok := aliases[name]; ok {
+		return lc, nil
+	}
+	for _, lc := range languages {
+		if strings.ToLower(string(lc)) == name {
+			return lc, nil
+		}
+	}
+	return "", fmt.Errorf("unsupported language %q", s)
+}
+
+// Valid tells if l is a language supported by MyScript.
+// LangAuto is not a valid language for a request.
+func (l LanguageCode) Valid() bool {
+	for _, lc := range languages {
+		if lc == l {
+			return true
+		}
+	}
+	return false
+}
+
+// base returns the language without the region, e.g. "en" for "en_US".
+func (l LanguageCode) base() string {
+	s := string(l)
+	if i := strings.Index(s, "_"); i >= 0 {
+		return s[:i]
+	}
+	return s
+}
+
+// languageScore rates how well a page was recognized.
+//
+// MyScript does not report a confidence for words,
+// so the score is the average certainty of handwritten words,
+// weighted by their number of letters.
+// Pages without handwriting have a score of zero.
+func languageScore(l *TokenList) float64 {
+	total, certain := 0, 0.0
+	it := l.Iter()
+	for it.Next() {
+		t := it.Token()
+		if len(t.Strokes()) == 0 || t.IsWhitespace() {
+			continue
+		}
+		n := len(t.runes)
+		total += n
+		certain += float64(n) * t.certainty()
+	}
+	if total == 0 {
+		return 0
+	}
+	return certain / float64(total)
+}
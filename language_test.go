@@ -0,0 +1,109 @@
+package rescript
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseLanguage(t *testing.T) {
+	assert := assert.New(t)
+
+	cases := map[string]LanguageCode{
+		"en":         LangEN,
+		"de":         LangDE,
+		"fr":         "fr_FR",
+		"it":         "it_IT",
+		"ja":         "ja_JP",
+		"fr_CA":      "fr_CA",
+		"fr-ca":      "fr_CA",
+		" EN_gb ":    "en_GB",
+		"sr_latn_rs": "sr_Latn_RS",
+		"ar":         "ar",
+		"auto":       LangAuto,
+	}
+	for s, expected := range cases {
+		lc, err := ParseLanguage(s)
+		assert.Nil(err, s)
+		assert.Equal(expected, lc, s)
+	}
+
+	for _, s := range []string{"", "xx", "en_XX", "english"} {
+		_, err := ParseLanguage(s)
+		assert.NotNil(err, s)
+	}
+}
+
+func TestValidLanguage(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.True(LangEN.Valid())
+	assert.True(LanguageCode("zh_TW").Valid())
+	assert.False(LanguageCode("en").Valid())
+	assert.False(LangAuto.Valid())
+
+	// every alias refers to a valid language
+	for name, lc := range aliases {
+		assert.True(lc.Valid(), name)
+	}
+	assert.Contains(Languages(), LangDE)
+}
+
+func TestLanguageScore(t *testing.T) {
+	assert := assert.New(t)
+
+	word := func(label string, candidates ...string) *Token {
+		tk := wordToken(Word{
+			Label:      label,
+			Candidates: candidates,
+			Items:      []Item{{ID: "0.1"}},
+		})
+		return tk
+	}
+
+	l := NewTokenList(
+		word("good", "good"),
+		NewToken(" "),
+		word("words", "words", "wards"),
+		NewToken(" "),
+		// typed text does not count
+		NewToken("typed"),
+	)
+	// "words" has one alternative
+	assert.InDelta((4.0+5.0/2)/9.0, languageScore(l), 0.001)
+
+	// a word that is not the first candidate is uncertain
+	l = NewTokenList(word("wards", "words", "wards"))
+	assert.Equal(0.0, languageScore(l))
+	assert.Equal(0.0, languageScore(NewTokenList(NewToken("typed"))))
+}
+
+func TestCheckLanguage(t *testing.T) {
+	assert := assert.New(t)
+
+	r := NewRecognizer("", "", "")
+	assert.Nil(r.checkLanguage(LangEN))
+	assert.NotNil(r.checkLanguage("xx_XX"))
+	assert.NotNil(r.checkLanguage(LangAuto))
+
+	r.SetCandidates(LangEN, "xx")
+	assert.NotNil(r.checkLanguage(LangAuto))
+	r.SetCandidates(LangEN, LangDE)
+	assert.Nil(r.checkLanguage(LangAuto))
+}
+
+func TestLanguageLexicon(t *testing.T) {
+	assert := assert.New(t)
+
+	r := NewRecognizer("", "", "")
+	r.SetLexicon(Lexicon{Words: []string{"rmtool"}, Resources: []string{"products"}})
+	r.SetLanguageLexicon(LangDE, Lexicon{Words: []string{"Besprechung"}})
+
+	x := r.languageLexicon(LangDE)
+	assert.Equal([]string{"Besprechung", "rmtool"}, x.Words)
+	assert.Equal([]string{"products"}, x.Resources)
+
+	// other languages only use the common lexicon
+	x = r.languageLexicon(LangEN)
+	assert.Equal([]string{"rmtool"}, x.Words)
+}
@@ -0,0 +1,183 @@
+package rescript
+
+import (
+	"math"
+	"sort"
+
+	"github.com/akeil/rmtool/pkg/lines"
+)
+
+// Thresholds for Reflow, as multiples of the x-height.
+const (
+	// paragraphGap is the vertical gap between lines
+	// that starts a new paragraph.
+	paragraphGap = 2.5
+	// indentWidth is the horizontal offset that counts as an indent.
+	indentWidth = 2.0
+	// wrapMargin is the distance from the right edge of the text
+	// within which a line is considered to be full.
+	wrapMargin = 6.0
+)
+
+// layoutLine is a line of tokens with its position on the page.
+type layoutLine struct {
+	first  *Node
+	last   *Node
+	bounds lines.Rect
+	// positioned is set if at least one token has a position.
+	positioned bool
+}
+
+// Reflow rebuilds lines and paragraphs from the position of the handwriting.
+//
+// The recognizer breaks the text where the handwriting breaks.
+// Reflow joins lines that were wrapped because the page was full,
+// keeps hard line breaks and separates paragraphs with an empty line.
+// Paragraphs are detected by larger vertical gaps and indented first lines.
+// Line breaks missing from the recognition result are added
+// when a word is placed below the previous one.
+//
+// Tokens without a position (e.g. typed text) are not changed.
+func Reflow(l *TokenList) *TokenList {
+	n := l.First()
+	splitLines(n)
+
+	ls := layoutLines(n)
+	unit := layoutUnit(n, ls)
+	if unit == 0 {
+		return l
+	}
+
+	right := float32(math.Inf(-1))
+	for _, l := range ls {
+		if l.positioned && l.bounds.Max.X > right {
+			right = l.bounds.Max.X
+		}
+	}
+
+	for i := 1; i < len(ls); i++ {
+		a, b := ls[i-1], ls[i]
+		// only lines separated by a single newline are changed
+		sep := a.last.Next()
+		if !a.positioned || !b.positioned || sep == nil || sep.Next() != b.first {
+			continue
+		}
+
+		gap := float64(b.bounds.Min.Y - a.bounds.Max.Y)
+		indent := float64(b.bounds.Min.X - a.bounds.Min.X)
+		full := float64(right-a.bounds.Max.X) <= wrapMargin*unit
+
+		switch {
+		case gap > paragraphGap*unit || indent > indentWidth*unit:
+			sep.InsertAfter(NewNode(NewToken("\n")))
+		case math.Abs(indent) <= indentWidth*unit && full && !endsSentence(a.last.Token()) && !startsItem(b.first):
+			sep.Update(NewToken(" "))
+		}
+	}
+
+	return l
+}
+
+// splitLines inserts a newline between two positioned words
+// if the second word is placed below the first one.
+func splitLines(n *Node) {
+	var prev *Token
+	for node := n; node != nil; node = node.Next() {
+		t := node.Token()
+		if t.IsNewline() {
+			prev = nil
+			continue
+		}
+		b, ok := t.Bounds()
+		if !ok {
+			continue
+		}
+		if prev != nil {
+			pb, _ := prev.Bounds()
+			// starts below the middle of the previous word
+			// and to the left of its end
+			if b.Min.Y > (pb.Min.Y+pb.Max.Y)/2 && b.Min.X < pb.Max.X {
+				node.InsertBefore(NewNode(NewToken("\n")))
+			}
+		}
+		prev = t
+	}
+}
+
+// layoutLines splits the token list at newlines.
+// Empty lines are skipped.
+func layoutLines(n *Node) []layoutLine {
+	result := make([]layoutLine, 0)
+	current := layoutLine{}
+	flush := func() {
+		if current.first != nil {
+			result = append(result, current)
+		}
+		current = layoutLine{}
+	}
+
+	for node := n; node != nil; node = node.Next() {
+		t := node.Token()
+		if t.IsNewline() {
+			flush()
+			continue
+		}
+		if current.first == nil {
+			current.first = node
+		}
+		current.last = node
+		if b, ok := t.Bounds(); ok {
+			if current.positioned {
+				current.bounds = current.bounds.Union(b)
+			} else {
+				current.bounds = b
+				current.positioned = true
+			}
+		}
+	}
+	flush()
+
+	return result
+}
+
+// layoutUnit determines the x-height for the text.
+//
+// If the recognizer did not report the x-height,
+// half of the typical line height is used instead.
+func layoutUnit(n *Node, ls []layoutLine) float64 {
+	var heights []float64
+	for node := n; node != nil; node = node.Next() {
+		if xh := node.Token().XHeight(); xh > 0 {
+			heights = append(heights, xh)
+		}
+	}
+	if len(heights) != 0 {
+		return median(heights)
+	}
+
+	for _, l := range ls {
+		if l.positioned {
+			heights = append(heights, float64(l.bounds.Dy()))
+		}
+	}
+	if len(heights) != 0 {
+		return median(heights) / 2
+	}
+	return 0
+}
+
+// endsSentence tells if a line ending with the given token
+// should keep its line break.
+func endsSentence(t *Token) bool {
+	switch t.String() {
+	case ".", "!", "?", ":":
+		return true
+	default:
+		return false
+	}
+}
+
+func median(v []float64) float64 {
+	sort.Float64s(v)
+	return v[len(v)/2]
+}
@@ -0,0 +1,80 @@
+package rescript
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReflow(t *testing.T) {
+	assert := assert.New(t)
+
+	// Lines are 60px high, with 20px between lines.
+	// The text is 1000px wide.
+	r := Result{
+		Words: []Word{
+			// a paragraph, soft-wrapped
+			layoutWord("This", 100, 100, 480),
+			layoutWord(" ", 0, 0, 0),
+			layoutWord("wraps", 600, 100, 500),
+			layoutWord("\n", 0, 0, 0),
+			layoutWord("around", 100, 180, 300),
+			layoutWord(".", 410, 180, 10),
+			layoutWord("\n", 0, 0, 0),
+			// hard break after a short line
+			layoutWord("Short", 100, 260, 300),
+			layoutWord("\n", 0, 0, 0),
+			// new paragraph after a larger gap
+			layoutWord("Gap", 100, 500, 200),
+			layoutWord("\n", 0, 0, 0),
+			// new paragraph with an indented first line
+			layoutWord("Indented", 300, 580, 800),
+		},
+	}
+
+	n := Reflow(ToTokenList(r))
+	assert.Equal("This wraps around.\nShort\n\nGap\n\nIndented", n.String())
+}
+
+func TestReflowSplitLines(t *testing.T) {
+	assert := assert.New(t)
+
+	// no newline from the recognizer, but the second word is below the first.
+	r := Result{
+		Words: []Word{
+			layoutWord("one", 100, 100, 200),
+			layoutWord("two", 100, 400, 200),
+		},
+	}
+
+	n := Reflow(ToTokenList(r))
+	assert.Equal("one\n\ntwo", n.String())
+}
+
+func TestReflowUnpositioned(t *testing.T) {
+	assert := assert.New(t)
+
+	n := Reflow(buildSampleList("foo", "\n", "bar"))
+	assert.Equal("foo\nbar", n.String())
+}
+
+// layoutWord creates a word 60px high with the given position in pixels.
+// The x-height is 20px.
+func layoutWord(label string, x, y, w float64) Word {
+	return sizedWord(label, x, y, w, 60)
+}
+
+// sizedWord creates a word with the given position and size in pixels.
+// The x-height is a third of the height.
+func sizedWord(label string, x, y, w, h float64) Word {
+	word := Word{Label: label}
+	if w == 0 {
+		return word
+	}
+	mm := func(px float64) float64 {
+		return px * mmPerInch / defaultResolution
+	}
+	word.BoundingBox = BoundingBox{X: mm(x), Y: mm(y), Width: mm(w), Height: mm(h)}
+	word.Items = []Item{Item{XHeight: mm(h / 3)}}
+	return word
+}
@@ -0,0 +1,64 @@
+package rescript
+
+import (
+	"bufio"
+	"io"
+	"strings"
+)
+
+// Lexicon holds custom vocabulary that is sent to MyScript
+// with each recognition request.
+//
+// Words are added to the recognizer's vocabulary, e.g. product names
+// or acronyms. Resources are the names of custom resources that were
+// uploaded to the MyScript developer account.
+type Lexicon struct {
+	Words     []string
+	Resources []string
+}
+
+// ReadLexicon reads a list of words with one word per line.
+//
+// Empty lines and lines starting with "#" are ignored,
+// duplicate words are dropped.
+func ReadLexicon(r io.Reader) ([]string, error) {
+	words := make([]string, 0)
+	seen := make(map[string]bool)
+	s := bufio.NewScanner(r)
+	for s.Scan() {
+		line := strings.TrimSpace(s.Text())
+		if line == "" || strings.HasPrefix(line, "#") || seen[line] {
+			continue
+		}
+		seen[line] = true
+		words = append(words, line)
+	}
+	return words, s.Err()
+}
+
+// Merge returns a lexicon with the words and resources from both lexicons.
+func (x Lexicon) Merge(o Lexicon) Lexicon {
+	return Lexicon{
+		Words:     mergeUnique(x.Words, o.Words),
+		Resources: mergeUnique(x.Resources, o.Resources),
+	}
+}
+
+// IsEmpty tells if the lexicon has neither words nor resources.
+func (x Lexicon) IsEmpty() bool {
+	return len(x.Words) == 0 && len(x.Resources) == 0
+}
+
+func mergeUnique(a, b []string) []string {
+	result := make([]string, 0, len(a)+len(b))
+	seen := make(map[string]bool)
+	for _, list := range [][]string{a, b} {
+		for _, s := range list {
+			if !seen[s] {
+				seen[s] = true
+				result = append(result, s)
+			}
+		}
+	}
+	return result
+}
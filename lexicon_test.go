@@ -0,0 +1,57 @@
+package rescript
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReadLexicon(t *testing.T) {
+	assert := assert.New(t)
+
+	words, err := ReadLexicon(strings.NewReader("# products\nreScript\n\n  MyScript \nreScript\nJIIX\n"))
+	assert.Nil(err)
+	assert.Equal([]string{"reScript", "MyScript", "JIIX"}, words)
+}
+
+func TestLexiconMerge(t *testing.T) {
+	assert := assert.New(t)
+
+	a := Lexicon{Words: []string{"foo", "bar"}, Resources: []string{"res"}}
+	b := Lexicon{Words: []string{"bar", "baz"}}
+
+	m := a.Merge(b)
+	assert.Equal([]string{"foo", "bar", "baz"}, m.Words)
+	assert.Equal([]string{"res"}, m.Resources)
+	assert.False(m.IsEmpty())
+	assert.True(Lexicon{}.IsEmpty())
+}
+
+func TestLexiconRequest(t *testing.T) {
+	assert := assert.New(t)
+
+	x := Lexicon{Words: []string{"reScript"}, Resources: []string{"products"}}
+	req := prepareRequest(LangEN, x)
+
+	data, err := json.Marshal(req)
+	assert.Nil(err)
+	assert.Contains(string(data), `"customLexicon":["reScript"]`)
+	assert.Contains(string(data), `"customResources":["products"]`)
+
+	// the lexicon is part of the cache key
+	plain, _ := cacheKey(prepareRequest(LangEN, Lexicon{}))
+	withLexicon, _ := cacheKey(req)
+	assert.NotEqual(plain, withLexicon)
+
+	other, _ := cacheKey(prepareRequest(LangEN, Lexicon{Words: []string{"reScript", "JIIX"}, Resources: []string{"products"}}))
+	assert.NotEqual(withLexicon, other)
+
+	// words and resources are not interchangeable
+	swapped, _ := cacheKey(prepareRequest(LangEN, Lexicon{Words: []string{"products"}, Resources: []string{"reScript"}}))
+	assert.NotEqual(withLexicon, swapped)
+
+	same, _ := cacheKey(prepareRequest(LangEN, x))
+	assert.Equal(withLexicon, same)
+}
@@ -1,10 +1,14 @@
 package rescript
 
 // Node is an element in a doubly linked list of Tokens.
+//
+// If the node belongs to a TokenList, the list is updated
+// when nodes are inserted or removed.
 type Node struct {
 	prev *Node
 	next *Node
 	data *Token
+	list *TokenList
 }
 
 // NewNode creates a new Node wrapping the given Token.
@@ -66,6 +70,14 @@ func (n *Node) IsTail() bool {
 // Remove drops this token from the list
 // and directly links the previous and next nodes.
 func (n *Node) Remove() {
+	if n.list != nil {
+		if n.list.first == n {
+			n.list.first = n.next
+		}
+		if n.list.last == n {
+			n.list.last = n.prev
+		}
+	}
 	if n.prev != nil {
 		n.prev.next = n.next
 	}
@@ -75,6 +87,7 @@ func (n *Node) Remove() {
 
 	n.prev = nil
 	n.next = nil
+	n.list = nil
 }
 
 // InsertAfter adds the given not after this one
@@ -83,6 +96,10 @@ func (n *Node) InsertAfter(o *Node) {
 	n.next = o
 	o.prev = n
 	o.next = next
+	o.list = n.list
+	if n.list != nil && n.list.last == n {
+		n.list.last = o
+	}
 
 	if next != nil {
 		next.prev = o
@@ -99,6 +116,10 @@ func (n *Node) InsertBefore(o *Node) {
 	n.prev = o
 	o.next = n
 	o.prev = prev
+	o.list = n.list
+	if n.list != nil && n.list.first == n {
+		n.list.first = o
+	}
 
 	if prev != nil {
 		prev.next = o
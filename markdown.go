@@ -3,11 +3,22 @@ package rescript
 import (
 	"fmt"
 	"io"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v2"
 )
 
 // NewMarkdownComposer creates a new composer which generates output in markdown format.
 func NewMarkdownComposer() ComposeFunc {
-	return composeMarkdown
+	return NewMarkdownComposerOptions(ComposeOptions{})
+}
+
+// NewMarkdownComposerOptions creates a markdown composer with the given options.
+func NewMarkdownComposerOptions(o ComposeOptions) ComposeFunc {
+	return func(w io.Writer, m Metadata, r map[string]*TokenList) error {
+		return composeMarkdown(w, m, r, o)
+	}
 }
 
 type stringWriter struct {
@@ -18,11 +29,15 @@ func (sw stringWriter) WriteString(s string) (int, error) {
 	return sw.Write([]byte(s))
 }
 
-func composeMarkdown(w io.Writer, m Metadata, r map[string]*Node) error {
+func composeMarkdown(w io.Writer, m Metadata, r map[string]*TokenList, o ComposeOptions) error {
 	var err error
 	sw := stringWriter{w}
 
-	// TODO: we might write a yaml frontmatter here
+	err = writeFrontMatter(sw, m)
+	if err != nil {
+		return err
+	}
+
 	sw.WriteString(fmt.Sprintf("# %v\n\n", m.Title))
 
 	for i, pageID := range m.PageIDs {
@@ -34,9 +49,9 @@ func composeMarkdown(w io.Writer, m Metadata, r map[string]*Node) error {
 			}
 		}
 
-		tail, ok := r[pageID]
+		l, ok := r[pageID]
 		if ok {
-			err = markdownPage(sw, i, tail)
+			err = markdownPage(sw, i, l, o)
 			if err != nil {
 				return err
 			}
@@ -53,14 +68,47 @@ func composeMarkdown(w io.Writer, m Metadata, r map[string]*Node) error {
 	return nil
 }
 
-// "Improve" the result
-// recognize lists:
-// lines starting with "-" or "*"
-// in some cases, add missing space
-// add a newline before the *first* and after the *last* line
-// of consecutive list entries
+// frontMatter is the YAML front matter for a markdown document.
+//
+// The field names are understood by static site generators like Hugo;
+// the ID allows to identify a note independent of its file name.
+type frontMatter struct {
+	Title        string       `yaml:"title"`
+	ID           string       `yaml:"id,omitempty"`
+	Version      uint         `yaml:"version,omitempty"`
+	LastModified string       `yaml:"lastmod,omitempty"`
+	Folder       string       `yaml:"folder,omitempty"`
+	Language     LanguageCode `yaml:"language,omitempty"`
+	Pages        int          `yaml:"pages"`
+}
+
+func writeFrontMatter(sw io.StringWriter, m Metadata) error {
+	fm := frontMatter{
+		Title:    m.Title,
+		ID:       m.ID,
+		Version:  m.Version,
+		Folder:   m.Folder,
+		Language: m.Language,
+		Pages:    m.pageCount(),
+	}
+	if !m.LastModified.IsZero() {
+		fm.LastModified = m.LastModified.UTC().Format(time.RFC3339)
+	}
 
-func markdownPage(sw io.StringWriter, idx int, n *Node) error {
+	data, err := yaml.Marshal(fm)
+	if err != nil {
+		return fmt.Errorf("failed to write front matter: %v", err)
+	}
+
+	_, err = sw.WriteString("---\n" + string(data) + "---\n\n")
+	return err
+}
+
+// markdownPage writes the tokens for a single page.
+//
+// Markdown structure like lists or headings is added by pipeline functions,
+// see DetectLists and friends.
+func markdownPage(sw io.StringWriter, idx int, l *TokenList, o ComposeOptions) error {
 	var err error
 
 	_, err = sw.WriteString(fmt.Sprintf("**Page %d**\n\n", idx+1))
@@ -68,9 +116,14 @@ func markdownPage(sw io.StringWriter, idx int, n *Node) error {
 		return err
 	}
 
-	for node := n; node != nil; node = node.Next() {
-		// TODO: we might attempt to "guess" markdown here,
-		_, err = sw.WriteString(node.Token().String())
+	it := l.Iter()
+	for it.Next() {
+		t := it.Token()
+		s := o.tokenText(t)
+		if t.IsBlock() {
+			s = markdownBlock(t)
+		}
+		_, err = sw.WriteString(s)
 		if err != nil {
 			return err
 		}
@@ -78,3 +131,18 @@ func markdownPage(sw io.StringWriter, idx int, n *Node) error {
 
 	return nil
 }
+
+// markdownBlock formats math as a LaTeX display block,
+// diagrams as a Mermaid code block and drawings as an embedded image.
+func markdownBlock(t *Token) string {
+	if m := t.Math(); m != nil {
+		return "$$\n" + strings.TrimSpace(m.LaTeX) + "\n$$"
+	}
+	if d := t.Diagram(); d != nil {
+		return "```mermaid\n" + d.Mermaid() + "```"
+	}
+	if sk := t.Sketch(); sk != nil {
+		return "![Sketch](" + sk.DataURI() + ")"
+	}
+	return ""
+}
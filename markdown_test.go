@@ -3,6 +3,7 @@ package rescript
 import (
 	"bytes"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -12,48 +13,70 @@ func TestMarkdownPage(t *testing.T) {
 
 	var buf bytes.Buffer
 
-	append := func(n *Node, s string) {
-		head := n
-		for node := n; node != nil; node = node.Next() {
-			head = node
-		}
-		head.InsertAfter(NewNode(NewToken(s)))
-	}
-
-	node := NewNode(NewToken("foo"))
-	append(node, " ")
-	append(node, "bar")
-	append(node, " ")
-	append(node, "baz")
-	append(node, "\n")
-	append(node, "newline")
-
-	node1 := NewNode(NewToken("second page"))
+	page0 := buildSampleList("foo", " ", "bar", " ", "baz", "\n", "newline")
+	page1 := buildSampleList("second page")
 
 	m := Metadata{
 		Title:   "My Title",
 		PageIDs: []string{"page0", "page1"},
 	}
 
-	nodes := map[string]*Node{
-		"page0": node,
-		"page1": node1,
+	nodes := map[string]*TokenList{
+		"page0": page0,
+		"page1": page1,
 	}
 
 	c := NewMarkdownComposer()
 	err := c(&buf, m, nodes)
 	assert.Nil(err)
 
-	expected := "# My Title\n\n**Page 1**\n\nfoo bar baz\nnewline\n\n---\n\n**Page 2**\n\nsecond page\n"
+	expected := "---\ntitle: My Title\npages: 2\n---\n\n# My Title\n\n**Page 1**\n\nfoo bar baz\nnewline\n\n---\n\n**Page 2**\n\nsecond page\n"
+	assert.Equal(expected, buf.String())
+}
+
+func TestMarkdownFrontMatter(t *testing.T) {
+	assert := assert.New(t)
+
+	var buf bytes.Buffer
+
+	m := Metadata{
+		Title:        "Notes: Meeting",
+		PageIDs:      []string{"page0"},
+		ID:           "0f2e8f1a-6b9e-4e0c-9a43-2c1b0f3d4e5a",
+		Version:      7,
+		LastModified: time.Date(2021, 1, 9, 13, 23, 42, 0, time.UTC),
+		Folder:       "Work/Projects",
+		Language:     LangDE,
+		PageCount:    3,
+	}
+
+	c := NewMarkdownComposer()
+	err := c(&buf, m, map[string]*TokenList{})
+	assert.Nil(err)
+
+	expected := `---
+title: 'Notes: Meeting'
+id: 0f2e8f1a-6b9e-4e0c-9a43-2c1b0f3d4e5a
+version: 7
+lastmod: "2021-01-09T13:23:42Z"
+folder: Work/Projects
+language: de_DE
+pages: 3
+---
+
+# Notes: Meeting
+
+
+`
 	assert.Equal(expected, buf.String())
 }
 
 func TestMarkdownError(t *testing.T) {
 	assert := assert.New(t)
 
-	node := NewNode(NewToken("foo"))
+	l := buildSampleList("foo")
 	w := failWriter{}
 
-	err := markdownPage(w, 2, node)
+	err := markdownPage(w, 2, l, ComposeOptions{})
 	assert.Error(err)
 }
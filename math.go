@@ -0,0 +1,67 @@
+package rescript
+
+import (
+	"encoding/binary"
+	"hash"
+)
+
+// Export formats for math recognition, see MyScript.Export.
+const (
+	MimeLaTeX  = "application/x-latex"
+	MimeMathML = "application/mathml+xml"
+)
+
+// MathResult is the response for math recognition.
+//
+// The expressions are taken from the JIIX result.
+// LaTeX and MathML are separate exports from the API;
+// MyScript.BatchMath only requests LaTeX.
+type MathResult struct {
+	ID          string           `json:"id"`
+	Version     string           `json:"version"`
+	Type        string           `json:"type"`
+	BoundingBox BoundingBox      `json:"bounding-box"`
+	Expressions []MathExpression `json:"expressions"`
+	LaTeX       string           `json:"latex,omitempty"`
+	MathML      string           `json:"mathml,omitempty"`
+}
+
+// MathExpression is a node in the expression tree of a math result.
+//
+// The Type is either an operator like "+" or "=",
+// or a structure like "number", "symbol", "fraction" or "square root".
+// See:
+// https://developer.myscript.com/docs/interactive-ink/1.4/reference/web/jiix/#math-item
+type MathExpression struct {
+	Type        string           `json:"type"`
+	ID          string           `json:"id,omitempty"`
+	Label       string           `json:"label,omitempty"`
+	Value       float64          `json:"value,omitempty"`
+	BoundingBox BoundingBox      `json:"bounding-box,omitempty"`
+	Operands    []MathExpression `json:"operands,omitempty"`
+	Items       []Item           `json:"items,omitempty"`
+}
+
+// MathConfiguration holds settings for math recognition.
+type MathConfiguration struct {
+	Solver SolverConfiguration `json:"solver"`
+}
+
+// SolverConfiguration controls whether recognized expressions are solved.
+type SolverConfiguration struct {
+	Enable bool `json:"enable"`
+}
+
+// NewMathConfiguration creates a math configuration.
+//
+// The solver is disabled; we want to transcribe what was written
+// rather than adding results.
+func NewMathConfiguration() *MathConfiguration {
+	return &MathConfiguration{
+		Solver: SolverConfiguration{Enable: false},
+	}
+}
+
+func (m *MathConfiguration) checksum(h hash.Hash) {
+	binary.Write(h, binary.LittleEndian, m.Solver.Enable)
+}
@@ -0,0 +1,166 @@
+package rescript
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/akeil/rmtool/pkg/lines"
+)
+
+func TestMathResult(t *testing.T) {
+	assert := assert.New(t)
+
+	data := `{
+		"type": "Math",
+		"expressions": [{
+			"type": "=",
+			"operands": [
+				{"type": "symbol", "label": "x"},
+				{"type": "number", "label": "2", "value": 2}
+			]
+		}]
+	}`
+	var m MathResult
+	err := json.Unmarshal([]byte(data), &m)
+	assert.Nil(err)
+	assert.Len(m.Expressions, 1)
+	assert.Equal("=", m.Expressions[0].Type)
+	assert.Equal(2.0, m.Expressions[0].Operands[1].Value)
+}
+
+func TestBlockTokens(t *testing.T) {
+	assert := assert.New(t)
+
+	m := NewMathToken(MathResult{LaTeX: "x^2 = 4\n"})
+	assert.True(m.IsBlock())
+	assert.NotNil(m.Math())
+	assert.Nil(m.Diagram())
+	assert.False(m.IsWord())
+	assert.False(m.IsWhitespace())
+	_, ok := m.Bounds()
+	assert.False(ok)
+
+	d := NewDiagramToken(DiagramResult{Elements: []DiagramElement{
+		{ID: "1", Type: DiagramNode, Label: "A"},
+	}})
+	assert.True(d.IsBlock())
+	assert.False(NewToken("foo").IsBlock())
+
+	l := buildSampleList("Solve", ":", "\n")
+	l.Append(m, NewToken("\n"), d)
+
+	var buf bytes.Buffer
+	err := NewMarkdownComposer()(&buf, Metadata{PageIDs: []string{"p"}}, map[string]*TokenList{"p": l})
+	assert.Nil(err)
+	assert.Contains(buf.String(), "Solve:\n$$\nx^2 = 4\n$$\n```mermaid\nflowchart TD\n    n1[\"A\"]\n```\n")
+
+	buf.Reset()
+	err = NewPlaintextComposer()(&buf, Metadata{PageIDs: []string{"p"}}, map[string]*TokenList{"p": l})
+	assert.Nil(err)
+	assert.Contains(buf.String(), "Solve:\nx^2 = 4\nflowchart TD\n    n1[\"A\"]\n")
+
+	// stages do not touch the blocks
+	l = BuildPipeline(Reflow, NormalizeQuotes, CapitalizeSentences, DetectHeadings)(l)
+	assert.Equal(m, l.First().Next().Next().Next().Token())
+	f, err := NewReplaceFunc(`^$`, "empty")
+	assert.Nil(err)
+	assert.Equal(6, f(l).Len())
+}
+
+func TestSplitRegions(t *testing.T) {
+	assert := assert.New(t)
+
+	stroke := func(x, y int) Stroke {
+		s := NewStroke()
+		s.X = []int{x - 5, x + 5}
+		s.Y = []int{y - 5, y + 5}
+		return s
+	}
+	groups := []StrokeGroup{
+		{Strokes: []Stroke{stroke(50, 50), stroke(50, 500)}},
+		{Strokes: []Stroke{stroke(50, 900)}},
+	}
+	regions := []Region{
+		{Bounds: lines.Rect{Min: lines.Point{X: 0, Y: 400}, Max: lines.Point{X: 200, Y: 600}}, Type: ContentMath},
+		{Bounds: pageBounds(), Type: ContentDiagram},
+	}
+
+	parts := splitRegions(groups, regions)
+	assert.Len(parts, 3)
+	assert.Len(parts[0], 1)
+	assert.Equal([]int{45, 55}, parts[0][0].Strokes[0].X)
+	assert.Equal([]int{495, 505}, parts[0][0].Strokes[0].Y)
+	// both layers, the stroke at the top and the one at the bottom
+	assert.Len(parts[1], 2)
+	assert.Empty(parts[2])
+
+	parts = splitRegions(groups, nil)
+	assert.Len(parts, 1)
+	assert.Len(parts[0], 2)
+
+	f := PageContentTypes(map[string]ContentType{"p1": ContentMath})
+	assert.Equal([]Region{{Bounds: pageBounds(), Type: ContentMath}}, f("p1", nil))
+	assert.Nil(f("p2", nil))
+}
+
+func TestContentTypeChecksum(t *testing.T) {
+	assert := assert.New(t)
+
+	sum := func(r Request) string {
+		k, err := cacheKey(r)
+		assert.Nil(err)
+		return k
+	}
+
+	text := prepareRequest(LangEN, Lexicon{})
+
+	math := prepareRequest(LangEN, Lexicon{})
+	math.ContentType = ContentMath
+	assert.NotEqual(sum(text), sum(math))
+
+	solver := math
+	solver.Configuration.Math = NewMathConfiguration()
+	solver.Configuration.Math.Solver.Enable = true
+	assert.NotEqual(sum(math), sum(solver))
+
+	// a text request still ignores the content type field
+	plain := text
+	plain.ContentType = defaultContentType
+	assert.Equal(sum(text), sum(plain))
+}
+
+func TestStrokeIDChecksum(t *testing.T) {
+	assert := assert.New(t)
+
+	req := prepareRequest(LangEN, Lexicon{})
+	s := NewStroke()
+	s.X, s.Y = []int{1, 2}, []int{3, 4}
+	s.Timestamp, s.Pressure = []int64{0, 10}, []float64{0.5, 0.5}
+	req.StrokeGroups = []StrokeGroup{{Strokes: []Stroke{s}}}
+	plain, err := cacheKey(req)
+	assert.Nil(err)
+
+	// stroke IDs do not change the key
+	req.StrokeGroups[0].Strokes[0].ID = "0.12"
+	withID, err := cacheKey(req)
+	assert.Nil(err)
+	assert.Equal(plain, withID)
+}
+
+func TestRecognizeEmptyRegions(t *testing.T) {
+	assert := assert.New(t)
+
+	// no strokes - no need to call the API
+	r := NewRecognizer("", "", "")
+	r.SetContentType(ContentMath)
+	r.SetRegions(func(pageID string, d *lines.Drawing) []Region {
+		return []Region{{Bounds: pageBounds(), Type: ContentDiagram}}
+	})
+	l, err := r.recognizePage(context.Background(), "p", lines.NewDrawing(), LangEN)
+	assert.Nil(err)
+	assert.Equal(0, l.Len())
+}
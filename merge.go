@@ -0,0 +1,152 @@
+package rescript
+
+import (
+	"math"
+	"unicode"
+
+	"github.com/akeil/rmtool/pkg/lines"
+)
+
+// textLine is a single line of text with its vertical position.
+type textLine struct {
+	y      float64
+	tokens []*Token
+}
+
+// MergeText combines the recognition result for a page with the typed text
+// from the same page.
+//
+// Lines of handwriting and paragraphs of typed text are put in reading order,
+// based on their vertical position on the page.
+func MergeText(r Result, t *lines.Text) *TokenList {
+	if t == nil || len(t.Paragraphs) == 0 {
+		return ToTokenList(r)
+	}
+
+	return joinLines(mergeLines(handwrittenLines(r), typedLines(t)))
+}
+
+// mergeLines combines two lists of lines ordered by their position.
+// Lines from a come first if both have the same position.
+func mergeLines(a, b []textLine) []textLine {
+	merged := make([]textLine, 0, len(a)+len(b))
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		if j == len(b) || (i < len(a) && a[i].y <= b[j].y) {
+			merged = append(merged, a[i])
+			i++
+		} else {
+			merged = append(merged, b[j])
+			j++
+		}
+	}
+	return merged
+}
+
+// joinLines creates a token list from the given lines,
+// separated by newlines.
+func joinLines(ls []textLine) *TokenList {
+	result := NewTokenList()
+	for k, l := range ls {
+		if k != 0 {
+			result.Append(NewToken("\n"))
+		}
+		result.Append(l.tokens...)
+	}
+
+	return result
+}
+
+// handwrittenLines splits the recognized words into lines.
+//
+// The position of a line is the top of the highest word.
+// Lines without a bounding box take the position of the previous line.
+func handwrittenLines(r Result) []textLine {
+	result := make([]textLine, 0)
+	y := 0.0
+	current := textLine{y: math.Inf(1)}
+	flush := func() {
+		if math.IsInf(current.y, 1) {
+			current.y = y
+		}
+		y = current.y
+		result = append(result, current)
+		current = textLine{y: math.Inf(1)}
+	}
+
+	for _, w := range r.Words {
+		if w.Label == "\n" {
+			flush()
+			continue
+		}
+		if !w.BoundingBox.IsZero() {
+			current.y = math.Min(current.y, toPixels(w.BoundingBox.Y))
+		}
+		current.tokens = append(current.tokens, wordToken(w))
+	}
+	if len(current.tokens) != 0 {
+		flush()
+	}
+
+	return result
+}
+
+// typedLines converts paragraphs of typed text into lines.
+//
+// Bullets and checkboxes are prefixed with a dash
+// and a box for checkboxes.
+// Headings are prefixed with "#" and bold paragraphs are wrapped in "**",
+// so that the style is kept in the output.
+func typedLines(t *lines.Text) []textLine {
+	if t == nil {
+		return nil
+	}
+	result := make([]textLine, len(t.Paragraphs))
+	for i, p := range t.Paragraphs {
+		s := p.Text
+		switch p.Style {
+		case lines.StyleHeading:
+			s = "# " + s
+		case lines.StyleBold:
+			s = "**" + s + "**"
+		case lines.StyleBullet, lines.StyleBullet2:
+			s = "- " + s
+		case lines.StyleCheckbox:
+			s = "- [ ] " + s
+		case lines.StyleCheckboxChecked:
+			s = "- [x] " + s
+		}
+		result[i] = textLine{
+			y:      float64(p.Y),
+			tokens: tokenize(s),
+		}
+	}
+	return result
+}
+
+// tokenize splits a string into tokens.
+//
+// Each whitespace and each punctuation character is a separate token,
+// everything else is combined into words.
+func tokenize(s string) []*Token {
+	tokens := make([]*Token, 0)
+	word := make([]rune, 0)
+	flush := func() {
+		if len(word) != 0 {
+			tokens = append(tokens, NewToken(string(word)))
+			word = word[:0]
+		}
+	}
+
+	for _, r := range s {
+		if unicode.IsSpace(r) || unicode.IsPunct(r) {
+			flush()
+			tokens = append(tokens, NewToken(string(r)))
+		} else {
+			word = append(word, r)
+		}
+	}
+	flush()
+
+	return tokens
+}
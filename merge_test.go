@@ -0,0 +1,62 @@
+package rescript
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/akeil/rmtool/pkg/lines"
+)
+
+func TestMergeText(t *testing.T) {
+	assert := assert.New(t)
+
+	// 10mm ~ 38px, 50mm ~ 189px
+	r := Result{
+		Words: []Word{
+			Word{Label: "first", BoundingBox: BoundingBox{X: 5, Y: 10, Width: 20, Height: 5}},
+			Word{Label: "\n"},
+			Word{Label: "second", BoundingBox: BoundingBox{X: 5, Y: 50, Width: 20, Height: 5}},
+		},
+	}
+	text := &lines.Text{
+		Paragraphs: []lines.Paragraph{
+			lines.Paragraph{Text: "typed, text", Style: lines.StylePlain, Y: 100},
+			lines.Paragraph{Text: "item", Style: lines.StyleBullet, Y: 300},
+			lines.Paragraph{Text: "Title", Style: lines.StyleHeading, Y: 400},
+			lines.Paragraph{Text: "important", Style: lines.StyleBold, Y: 500},
+		},
+	}
+
+	l := MergeText(r, text)
+	assert.Equal("first\ntyped, text\nsecond\n- item\n# Title\n**important**", l.String())
+
+	// punctuation and whitespace are separate tokens
+	n := l.First()
+	assert.Equal("typed", n.Ahead(2).Token().String())
+	assert.Equal(",", n.Ahead(3).Token().String())
+}
+
+func TestMergeNoText(t *testing.T) {
+	assert := assert.New(t)
+
+	r := Result{
+		Words: []Word{
+			Word{Label: "foo"},
+			Word{Label: " "},
+			Word{Label: "bar"},
+		},
+	}
+
+	n := MergeText(r, nil).First()
+	assert.Equal("foo", n.Token().String())
+	assert.Equal("bar", n.Ahead(2).Token().String())
+	assert.True(n.Ahead(2).IsHead())
+
+	// typed text only
+	n = MergeText(Result{}, &lines.Text{
+		Paragraphs: []lines.Paragraph{lines.Paragraph{Text: "typed"}},
+	}).First()
+	assert.Equal("typed", n.Token().String())
+	assert.True(n.IsHead())
+}
@@ -2,25 +2,44 @@ package rescript
 
 import (
 	"bytes"
+	"context"
 	"crypto/hmac"
 	"crypto/sha512"
 	"encoding/hex"
 	"encoding/json"
-	"fmt"
+	"io/ioutil"
+	"math/rand"
 	"net/http"
 	"net/url"
+	"sync"
+	"time"
 )
 
 const (
 	batchEndpoint = "/api/v4.0/iink/batch"
+	// DefaultTimeout is the time limit for a single call to the API.
+	DefaultTimeout = 60 * time.Second
+	// DefaultRetries is the number of times a failed call is repeated.
+	DefaultRetries = 3
+	// retryWait is the delay before the first retry,
+	// maxRetryWait is the longest delay between retries.
+	retryWait    = time.Second
+	maxRetryWait = 30 * time.Second
 )
 
 // MyScript is the client for the MyScript ReST API.
 type MyScript struct {
-	appKey string
-	host   string
-	client *http.Client
-	sign   func(data []byte) string
+	appKey    string
+	host      string
+	client    *http.Client
+	timeout   time.Duration
+	retries   int
+	retryWait time.Duration
+	limiter   *RateLimiter
+	sign      func(data []byte) string
+	// rnd adds a random part to the delay between retries
+	rndMx sync.Mutex
+	rnd   *rand.Rand
 }
 
 // NewMyScript sets up a new client.
@@ -28,9 +47,13 @@ type MyScript struct {
 // It requires the application key and the HMAC key from ypur MyScript account.
 func NewMyScript(appKey, hmacKey string) *MyScript {
 	return &MyScript{
-		appKey: appKey,
-		host:   "https://cloud.myscript.com",
-		client: &http.Client{},
+		appKey:    appKey,
+		host:      "https://cloud.myscript.com",
+		client:    &http.Client{},
+		timeout:   DefaultTimeout,
+		retries:   DefaultRetries,
+		retryWait: retryWait,
+		rnd:       rand.New(rand.NewSource(time.Now().UnixNano())),
 		sign: func(data []byte) string {
 			// see:
 			// https://developer.myscript.com/support/account/registering-myscript-cloud/#computing-the-hmac-value
@@ -48,24 +71,161 @@ func NewMyScript(appKey, hmacKey string) *MyScript {
 	}
 }
 
+// SetTimeout sets the time limit for a single call to the API,
+// including reading the response.
+// Each retry has its own time limit.
+// A value of zero disables the limit.
+func (m *MyScript) SetTimeout(d time.Duration) {
+	m.timeout = d
+}
+
+// SetRetries sets how often a call is repeated if it fails
+// because of too many requests or an error on the server.
+// The default is DefaultRetries; zero disables retries.
+func (m *MyScript) SetRetries(n int) {
+	if n < 0 {
+		n = 0
+	}
+	m.retries = n
+}
+
+// SetRateLimiter restricts the rate of calls to the API.
+// The limiter can be shared by several clients.
+// If l is nil, there is no limit.
+func (m *MyScript) SetRateLimiter(l *RateLimiter) {
+	m.limiter = l
+}
+
 // Batch is the single endpoint fif the ReST API.
 // It performs handwriting recognition.
 func (m *MyScript) Batch(r Request) (Result, error) {
+	return m.BatchContext(context.Background(), r)
+}
+
+// BatchContext is like Batch, but the call is cancelled with ctx.
+func (m *MyScript) BatchContext(ctx context.Context, r Request) (Result, error) {
 	var result Result
+	err := m.batchJiix(ctx, r, &result)
+	return result, err
+}
+
+// BatchMath performs math recognition.
+//
+// The request must have the content type "Math".
+// The result includes the expression tree and the LaTeX export,
+// which requires a second call to the API.
+func (m *MyScript) BatchMath(r Request) (MathResult, error) {
+	return m.BatchMathContext(context.Background(), r)
+}
+
+// BatchMathContext is like BatchMath, but the calls are cancelled with ctx.
+func (m *MyScript) BatchMathContext(ctx context.Context, r Request) (MathResult, error) {
+	var result MathResult
+	err := m.batchJiix(ctx, r, &result)
+	if err != nil {
+		return result, err
+	}
+
+	latex, err := m.ExportContext(ctx, r, MimeLaTeX)
+	if err != nil {
+		return result, err
+	}
+	result.LaTeX = string(latex)
+
+	return result, nil
+}
+
+// BatchDiagram performs diagram recognition.
+//
+// The request must have the content type "Diagram" or "Raw Content";
+// both return a list of elements.
+func (m *MyScript) BatchDiagram(r Request) (DiagramResult, error) {
+	return m.BatchDiagramContext(context.Background(), r)
+}
+
+// BatchDiagramContext is like BatchDiagram, but the call is cancelled with ctx.
+func (m *MyScript) BatchDiagramContext(ctx context.Context, r Request) (DiagramResult, error) {
+	var result DiagramResult
+	err := m.batchJiix(ctx, r, &result)
+	return result, err
+}
+
+// Export calls the batch endpoint and returns the result in the given format,
+// e.g. MimeLaTeX or MimeMathML.
+func (m *MyScript) Export(r Request, mime string) ([]byte, error) {
+	return m.ExportContext(context.Background(), r, mime)
+}
+
+// ExportContext is like Export, but the call is cancelled with ctx.
+func (m *MyScript) ExportContext(ctx context.Context, r Request, mime string) ([]byte, error) {
+	return m.post(ctx, r, mime)
+}
+
+// batchJiix calls the batch endpoint and decodes the JIIX result into v.
+func (m *MyScript) batchJiix(ctx context.Context, r Request, v interface{}) error {
+	data, err := m.post(ctx, r, "application/json", "application/vnd.myscript.jiix")
+	if err != nil {
+		return err
+	}
+
+	return json.Unmarshal(data, v)
+}
+
+// withTimeout applies the time limit for a single call to ctx.
+func (m *MyScript) withTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	if m.timeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, m.timeout)
+}
+
+// post sends the request to the batch endpoint and returns the response body.
+//
+// Requests that fail with a status that allows a retry
+// are repeated after a delay, see SetRetries.
+// If the server asks to wait longer than maxRetryWait,
+// the error is returned instead.
+func (m *MyScript) post(ctx context.Context, r Request, accept ...string) ([]byte, error) {
 	// We need the JSON body as []byte because we need to create a signature over it.
 	payload, err := json.Marshal(r)
 	if err != nil {
-		return result, err
+		return nil, err
 	}
 
 	u, err := m.resolveEndpoint(batchEndpoint)
 	if err != nil {
-		return result, err
+		return nil, err
 	}
 
-	req, err := http.NewRequest("POST", u.String(), bytes.NewBuffer(payload))
+	for attempt := 0; ; attempt++ {
+		data, err := m.send(ctx, u.String(), payload, accept)
+		apiErr, ok := err.(*APIError)
+		if !ok || !apiErr.Temporary() || attempt >= m.retries || apiErr.RetryAfter > maxRetryWait {
+			return data, err
+		}
+
+		err = sleep(ctx, m.backoff(attempt, apiErr.RetryAfter))
+		if err != nil {
+			return nil, err
+		}
+	}
+}
+
+// send makes a single call to the API.
+func (m *MyScript) send(ctx context.Context, u string, payload []byte, accept []string) ([]byte, error) {
+	if m.limiter != nil {
+		err := m.limiter.Wait(ctx)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	ctx, cancel := m.withTimeout(ctx)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, "POST", u, bytes.NewBuffer(payload))
 	if err != nil {
-		return result, err
+		return nil, err
 	}
 
 	// MyScript custom headers
@@ -73,32 +233,62 @@ func (m *MyScript) Batch(r Request) (Result, error) {
 	req.Header.Add("hmac", m.sign(payload))
 	// Standard headers
 	req.Header.Add("Content-Type", "application/json")
-	req.Header.Add("Accept", "application/json")
-	req.Header.Add("Accept", "application/vnd.myscript.jiix")
+	for _, a := range accept {
+		req.Header.Add("Accept", a)
+	}
 
 	res, err := m.client.Do(req)
 	if err != nil {
-		return result, err
+		return nil, err
 	}
 	defer res.Body.Close()
 
+	data, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return nil, err
+	}
+
 	if res.StatusCode != http.StatusOK {
-		// TODO: Error Model
-		e := make(map[string]interface{})
-		err = json.NewDecoder(res.Body).Decode(&e)
-		if err != nil {
-			return result, err
-		}
-		fmt.Println(e)
-		return result, fmt.Errorf("bad status code %v", res.StatusCode)
+		return nil, newAPIError(res, data)
 	}
 
-	err = json.NewDecoder(res.Body).Decode(&result)
-	if err != nil {
-		return result, err
+	return data, nil
+}
+
+// backoff returns the delay before the next attempt.
+//
+// The delay doubles with each attempt, with a random part
+// so that parallel requests do not retry at the same time.
+// If the server asked for a delay, that delay is used, up to maxRetryWait.
+func (m *MyScript) backoff(attempt int, retryAfter time.Duration) time.Duration {
+	if retryAfter > maxRetryWait {
+		return maxRetryWait
+	}
+	if retryAfter > 0 {
+		return retryAfter
 	}
 
-	return result, nil
+	d := m.retryWait << uint(attempt)
+	if d <= 0 || d > maxRetryWait {
+		d = maxRetryWait
+	}
+	// between half and the full delay
+	m.rndMx.Lock()
+	defer m.rndMx.Unlock()
+	return d/2 + time.Duration(m.rnd.Int63n(int64(d/2)+1))
+}
+
+// sleep waits for the given time or until ctx is cancelled.
+func sleep(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
 }
 
 func (m *MyScript) resolveEndpoint(ep string) (*url.URL, error) {
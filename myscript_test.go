@@ -0,0 +1,231 @@
+package rescript
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha512"
+	"encoding/hex"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const (
+	testAppKey  = "app-key"
+	testHmacKey = "hmac-key"
+)
+
+// testServer stands in for the MyScript API.
+//
+// It checks the credentials of each request
+// and responds with the given failures before it returns a result.
+type testServer struct {
+	*httptest.Server
+	mx       sync.Mutex
+	calls    int
+	failures []func(w http.ResponseWriter)
+}
+
+func newTestServer(failures ...func(w http.ResponseWriter)) *testServer {
+	s := &testServer{failures: failures}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.handle))
+	return s
+}
+
+func (s *testServer) handle(w http.ResponseWriter, req *http.Request) {
+	s.mx.Lock()
+	n := s.calls
+	s.calls++
+	s.mx.Unlock()
+
+	body, _ := ioutil.ReadAll(req.Body)
+	mac := hmac.New(sha512.New, []byte(testAppKey+testHmacKey))
+	mac.Write(body)
+	if req.Header.Get("applicationKey") != testAppKey ||
+		req.Header.Get("hmac") != hex.EncodeToString(mac.Sum(nil)) {
+		w.WriteHeader(http.StatusUnauthorized)
+		w.Write([]byte(`{"code": "access.not.granted", "message": "Access not granted"}`))
+		return
+	}
+
+	if n < len(s.failures) {
+		s.failures[n](w)
+		return
+	}
+	w.Write([]byte(`{"label": "foo", "words": [{"label": "foo"}]}`))
+}
+
+func (s *testServer) client(appKey, hmacKey string) *MyScript {
+	m := NewMyScript(appKey, hmacKey)
+	m.host = s.URL
+	m.retryWait = time.Millisecond
+	return m
+}
+
+func status(code int, body string) func(w http.ResponseWriter) {
+	return func(w http.ResponseWriter) {
+		w.WriteHeader(code)
+		w.Write([]byte(body))
+	}
+}
+
+func TestMyScriptBatch(t *testing.T) {
+	assert := assert.New(t)
+
+	srv := newTestServer()
+	defer srv.Close()
+
+	res, err := srv.client(testAppKey, testHmacKey).Batch(NewRequest())
+	assert.Nil(err)
+	assert.Equal("foo", res.Label)
+
+	// a wrong key is not retried
+	_, err = srv.client(testAppKey, "wrong").Batch(NewRequest())
+	apiErr, ok := err.(*APIError)
+	assert.True(ok)
+	assert.Equal(http.StatusUnauthorized, apiErr.StatusCode)
+	assert.Equal("access.not.granted", apiErr.Code)
+	assert.Equal("Access not granted", apiErr.Message)
+	assert.False(apiErr.Temporary())
+	assert.Equal(2, srv.calls)
+}
+
+func TestMyScriptRetry(t *testing.T) {
+	assert := assert.New(t)
+
+	srv := newTestServer(
+		status(http.StatusServiceUnavailable, "down"),
+		status(http.StatusBadGateway, ""),
+	)
+	defer srv.Close()
+
+	res, err := srv.client(testAppKey, testHmacKey).Batch(NewRequest())
+	assert.Nil(err)
+	assert.Equal("foo", res.Label)
+	assert.Equal(3, srv.calls)
+
+	// the server asks to wait
+	srv = newTestServer(func(w http.ResponseWriter) {
+		w.Header().Set("Retry-After", "1")
+		w.WriteHeader(http.StatusTooManyRequests)
+	})
+	defer srv.Close()
+
+	start := time.Now()
+	_, err = srv.client(testAppKey, testHmacKey).Batch(NewRequest())
+	assert.Nil(err)
+	assert.True(time.Since(start) >= time.Second)
+
+	// the server asks to wait too long
+	srv = newTestServer(func(w http.ResponseWriter) {
+		w.Header().Set("Retry-After", "3600")
+		w.WriteHeader(http.StatusTooManyRequests)
+	})
+	defer srv.Close()
+
+	start = time.Now()
+	_, err = srv.client(testAppKey, testHmacKey).Batch(NewRequest())
+	apiErr, ok := err.(*APIError)
+	assert.True(ok)
+	assert.Equal(http.StatusTooManyRequests, apiErr.StatusCode)
+	assert.Equal(time.Hour, apiErr.RetryAfter)
+	assert.Equal(1, srv.calls)
+	assert.True(time.Since(start) < time.Second)
+
+	// too many failures
+	fail := status(http.StatusInternalServerError, "<html>Internal Error</html>")
+	srv = newTestServer(fail, fail, fail, fail, fail)
+	defer srv.Close()
+
+	m := srv.client(testAppKey, testHmacKey)
+	m.SetRetries(2)
+	_, err = m.Batch(NewRequest())
+	apiErr, ok = err.(*APIError)
+	assert.True(ok)
+	assert.Equal(http.StatusInternalServerError, apiErr.StatusCode)
+	assert.Equal("<html>Internal Error</html>", apiErr.Message)
+	assert.True(apiErr.Temporary())
+	assert.Equal(3, srv.calls)
+
+	// retries stop when the context is cancelled
+	srv = newTestServer(fail, fail, fail, fail, fail)
+	defer srv.Close()
+
+	m = srv.client(testAppKey, testHmacKey)
+	m.retryWait = time.Hour
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	_, err = m.BatchContext(ctx, NewRequest())
+	assert.Equal(context.DeadlineExceeded, err)
+	assert.Equal(1, srv.calls)
+}
+
+func TestBackoff(t *testing.T) {
+	assert := assert.New(t)
+
+	m := NewMyScript("", "")
+	for attempt := 0; attempt < 3; attempt++ {
+		d := m.backoff(attempt, 0)
+		limit := retryWait << uint(attempt)
+		assert.True(d >= limit/2 && d <= limit, d)
+	}
+	assert.True(m.backoff(20, 0) <= maxRetryWait)
+	assert.Equal(5*time.Second, m.backoff(0, 5*time.Second))
+	assert.Equal(maxRetryWait, m.backoff(0, time.Hour))
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	assert := assert.New(t)
+
+	now := time.Date(2021, 1, 9, 13, 0, 0, 0, time.UTC)
+	assert.Equal(120*time.Second, parseRetryAfter("120", now))
+	assert.Equal(30*time.Second, parseRetryAfter("Sat, 09 Jan 2021 13:00:30 GMT", now))
+	assert.Equal(time.Duration(0), parseRetryAfter("Sat, 09 Jan 2021 12:00:00 GMT", now))
+	assert.Equal(time.Duration(0), parseRetryAfter("", now))
+	assert.Equal(time.Duration(0), parseRetryAfter("soon", now))
+	assert.Equal(time.Duration(0), parseRetryAfter("-1", now))
+}
+
+func TestRateLimiter(t *testing.T) {
+	assert := assert.New(t)
+
+	l := NewRateLimiter(10, 2)
+	now := l.last
+	assert.Equal(time.Duration(0), l.reserve(now))
+	assert.Equal(time.Duration(0), l.reserve(now))
+	assert.Equal(100*time.Millisecond, l.reserve(now))
+	assert.Equal(200*time.Millisecond, l.reserve(now))
+
+	// the bucket is refilled, up to the burst size
+	now = now.Add(time.Minute)
+	assert.Equal(time.Duration(0), l.reserve(now))
+	assert.Equal(time.Duration(0), l.reserve(now))
+	assert.Equal(100*time.Millisecond, l.reserve(now))
+
+	// a cancelled wait returns the token
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	tokens := l.tokens
+	assert.NotNil(l.Wait(ctx))
+	assert.True(l.tokens >= tokens)
+
+	assert.Equal(time.Duration(0), NewRateLimiter(0, 1).reserve(time.Now()))
+}
+
+func TestAPIErrorMessage(t *testing.T) {
+	assert := assert.New(t)
+
+	e := &APIError{StatusCode: 401, Code: "access.not.granted", Message: "Access not granted"}
+	assert.Equal("myscript: 401 Unauthorized: access.not.granted: Access not granted", e.Error())
+
+	res := &http.Response{StatusCode: 503, Header: http.Header{}}
+	e = newAPIError(res, []byte(strings.Repeat("x", 300)))
+	assert.Equal(503, e.StatusCode)
+	assert.Len(e.Message, maxErrorBody+3)
+}
@@ -4,25 +4,35 @@ package rescript
 //
 // The output is the modified set of tokens. A PipelineFunc may change, remove
 // or insert tokens.
-type PipelineFunc func(n *Node) *Node
+type PipelineFunc func(l *TokenList) *TokenList
 
 // BuildPipeline combines several pipeline functions into one.
 func BuildPipeline(p ...PipelineFunc) PipelineFunc {
-	return func(n *Node) *Node {
+	return func(l *TokenList) *TokenList {
 		for _, f := range p {
-			n = f(n)
+			l = f(l)
 		}
-		return n
+		return l
+	}
+}
+
+// NodeFunc adapts a function that works on a chain of nodes to a PipelineFunc.
+//
+// The function receives the first node of the list
+// and returns the first node of the result.
+func NodeFunc(f func(n *Node) *Node) PipelineFunc {
+	return func(l *TokenList) *TokenList {
+		return TokenListFromNode(f(l.First()))
 	}
 }
 
 // Dehyphenate merges words that are separated by a hyphen.
-func Dehyphenate(n *Node) *Node {
+func Dehyphenate(l *TokenList) *TokenList {
 	count := 0
 	state := 0
 	var t *Token
 
-	for node := n; node != nil; node = node.Next() {
+	for node := l.First(); node != nil; node = node.Next() {
 		t = node.Token()
 		switch state {
 		case 0:
@@ -54,9 +64,6 @@ func Dehyphenate(n *Node) *Node {
 		//
 		// Current node is the last part of the word
 		// We need to merge `count` preceeding nodes
-		//
-		// We update the start node (not the current)
-		// because the start node might be the return value of this function
 		if state == 3 {
 			// go back to the start of the hyphenated word
 			start := node.Behind(count)
@@ -83,5 +90,5 @@ func Dehyphenate(n *Node) *Node {
 		}
 	}
 
-	return n
+	return l
 }
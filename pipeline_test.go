@@ -8,15 +8,11 @@ import (
 
 func TestDehyphenate(t *testing.T) {
 	assert := assert.New(t)
-	var ta *Node
-	var tb *Node
+	var ta *TokenList
+	var tb *TokenList
 
-	head := func(n *Node) *Node {
-		nn := n
-		for node := n; node != nil; node = node.Next() {
-			nn = node
-		}
-		return nn
+	head := func(l *TokenList) *Node {
+		return l.Last()
 	}
 
 	str := func(n *Node) string {
@@ -26,7 +22,7 @@ func TestDehyphenate(t *testing.T) {
 	// basic, unchanged
 	ta = buildSampleList("foo", " ", "bar")
 	tb = Dehyphenate(ta)
-	assert.Equal(str(ta), str(tb))
+	assert.Equal(str(ta.First()), str(tb.First()))
 	assert.Equal(str(head(ta)), str(head(tb)))
 
 	// hyphenated word should be merged
@@ -35,37 +31,37 @@ func TestDehyphenate(t *testing.T) {
 	// bar
 	ta = buildSampleList("foo", "-", "\n", "bar")
 	tb = Dehyphenate(ta)
-	assert.Equal("foobar", str(tb), "Hyphenated words should be merged")
+	assert.Equal("foobar", str(tb.First()), "Hyphenated words should be merged")
 
 	// hyphenated word should be merged
 	//
 	// foo- bar
 	ta = buildSampleList("foo", "-", " ", "bar")
 	tb = Dehyphenate(ta)
-	assert.Equal("foobar", str(tb), "Hyphenated words should be merged")
+	assert.Equal("foobar", str(tb.First()), "Hyphenated words should be merged")
 
 	// subsequent hyphenations should also be merged
 	//
 	// foo- bar
 	ta = buildSampleList("foo", "-", " ", "bar", " ", "abc", "-", " ", "def")
 	tb = Dehyphenate(ta)
-	assert.Equal("foobar", str(tb), "Hyphenated words should be merged")
-	assert.Equal(" ", str(tb.Next()), "Hyphenated words should be merged")
-	assert.Equal("abcdef", str(tb.Next().Next()), "Hyphenated words should be merged")
+	assert.Equal("foobar", str(tb.First()), "Hyphenated words should be merged")
+	assert.Equal(" ", str(tb.First().Next()), "Hyphenated words should be merged")
+	assert.Equal("abcdef", str(tb.First().Next().Next()), "Hyphenated words should be merged")
 
 	// hyphenated word should be merged
 	//
 	// foo-bar
 	ta = buildSampleList("foo", "-", "bar")
 	tb = Dehyphenate(ta)
-	assert.Equal("foobar", str(tb), "Hyphenated words should be merged")
+	assert.Equal("foobar", str(tb.First()), "Hyphenated words should be merged")
 
 	// two words separated by dash should NOT be merged
 	//
 	// foo - bar
 	ta = buildSampleList("foo", " ", "-", " ", "bar")
 	tb = Dehyphenate(ta)
-	assert.Equal("foo", str(tb), "Words separated by dash should NOT be merged")
+	assert.Equal("foo", str(tb.First()), "Words separated by dash should NOT be merged")
 	assert.Equal("bar", str(head(tb)), "Words separated by dash should NOT be merged")
 
 	// List elements are not hyphenated words
@@ -74,7 +70,7 @@ func TestDehyphenate(t *testing.T) {
 	// - item
 	ta = buildSampleList("foo", "\n", "-", " ", "item")
 	tb = Dehyphenate(ta)
-	assert.Equal("foo", str(tb), "Words separated by dash should NOT be merged")
+	assert.Equal("foo", str(tb.First()), "Words separated by dash should NOT be merged")
 	assert.Equal("item", str(head(tb)), "Words separated by dash should NOT be merged")
 
 	// List elements are not hyphenated words (even if the list is not properly recognized)
@@ -83,22 +79,14 @@ func TestDehyphenate(t *testing.T) {
 	// -item
 	ta = buildSampleList("foo", "\n", "-", "item")
 	tb = Dehyphenate(ta)
-	assert.Equal("foo", str(tb), "Words separated by dash should NOT be merged")
+	assert.Equal("foo", str(tb.First()), "Words separated by dash should NOT be merged")
 	assert.Equal("item", str(head(tb)), "Words separated by dash should NOT be merged")
 }
 
-func buildSampleList(s ...string) *Node {
-	var tail *Node
-	var head *Node
+func buildSampleList(s ...string) *TokenList {
+	l := NewTokenList()
 	for _, w := range s {
-		n := NewNode(NewToken(w))
-		if head != nil {
-			head.InsertAfter(n)
-		} else {
-			tail = n
-		}
-		head = n
+		l.Append(NewToken(w))
 	}
-
-	return tail
+	return l
 }
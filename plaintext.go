@@ -9,10 +9,17 @@ import (
 // NewPlaintextComposer creates a new composer which creates plain text output
 // for a regicnition result.
 func NewPlaintextComposer() ComposeFunc {
-	return composePlain
+	return NewPlaintextComposerOptions(ComposeOptions{})
 }
 
-func composePlain(w io.Writer, m Metadata, r map[string]*Node) error {
+// NewPlaintextComposerOptions creates a plain text composer with the given options.
+func NewPlaintextComposerOptions(o ComposeOptions) ComposeFunc {
+	return func(w io.Writer, m Metadata, r map[string]*TokenList) error {
+		return composePlain(w, m, r, o)
+	}
+}
+
+func composePlain(w io.Writer, m Metadata, r map[string]*TokenList, o ComposeOptions) error {
 	var err error
 	sw := stringWriter{w}
 
@@ -27,9 +34,9 @@ func composePlain(w io.Writer, m Metadata, r map[string]*Node) error {
 
 	// Output the text body from all pages
 	for i, pageID := range m.PageIDs {
-		tail, ok := r[pageID]
+		l, ok := r[pageID]
 		if ok {
-			err = plaintextPage(sw, i, tail)
+			err = plaintextPage(sw, i, l, o)
 			if err != nil {
 				return err
 			}
@@ -40,7 +47,7 @@ func composePlain(w io.Writer, m Metadata, r map[string]*Node) error {
 	return nil
 }
 
-func plaintextPage(sw io.StringWriter, idx int, n *Node) error {
+func plaintextPage(sw io.StringWriter, idx int, l *TokenList, o ComposeOptions) error {
 	var err error
 
 	_, err = sw.WriteString(fmt.Sprintf("\n[Page %d]\n\n", idx+1))
@@ -48,8 +55,14 @@ func plaintextPage(sw io.StringWriter, idx int, n *Node) error {
 		return err
 	}
 
-	for node := n; node != nil; node = node.Next() {
-		_, err = sw.WriteString(node.Token().String())
+	it := l.Iter()
+	for it.Next() {
+		t := it.Token()
+		s := o.tokenText(t)
+		if t.IsBlock() {
+			s = plaintextBlock(t)
+		}
+		_, err = sw.WriteString(s)
 		if err != nil {
 			return err
 		}
@@ -62,3 +75,19 @@ func plaintextPage(sw io.StringWriter, idx int, n *Node) error {
 
 	return nil
 }
+
+// plaintextBlock writes math as LaTeX and diagrams as Mermaid source,
+// which are both readable as text.
+// Drawings are replaced with a placeholder.
+func plaintextBlock(t *Token) string {
+	if m := t.Math(); m != nil {
+		return strings.TrimSpace(m.LaTeX)
+	}
+	if d := t.Diagram(); d != nil {
+		return strings.TrimSpace(d.Mermaid())
+	}
+	if t.Sketch() != nil {
+		return "[Sketch]"
+	}
+	return ""
+}
@@ -13,32 +13,17 @@ func TestComposePlaintext(t *testing.T) {
 
 	var buf bytes.Buffer
 
-	append := func(n *Node, s string) {
-		head := n
-		for node := n; node != nil; node = node.Next() {
-			head = node
-		}
-		head.InsertAfter(NewNode(NewToken(s)))
-	}
-
-	node := NewNode(NewToken("foo"))
-	append(node, " ")
-	append(node, "bar")
-	append(node, " ")
-	append(node, "baz")
-	append(node, "\n")
-	append(node, "newline")
-
-	node1 := NewNode(NewToken("second page"))
+	page0 := buildSampleList("foo", " ", "bar", " ", "baz", "\n", "newline")
+	page1 := buildSampleList("second page")
 
 	m := Metadata{
 		Title:   "My Title",
 		PageIDs: []string{"page0", "page1"},
 	}
 
-	nodes := map[string]*Node{
-		"page0": node,
-		"page1": node1,
+	nodes := map[string]*TokenList{
+		"page0": page0,
+		"page1": page1,
 	}
 
 	c := NewPlaintextComposer()
@@ -52,10 +37,10 @@ func TestComposePlaintext(t *testing.T) {
 func TestPlaintextError(t *testing.T) {
 	assert := assert.New(t)
 
-	node := NewNode(NewToken("foo"))
+	l := buildSampleList("foo")
 	w := failWriter{}
 
-	err := plaintextPage(w, 2, node)
+	err := plaintextPage(w, 2, l, ComposeOptions{})
 	assert.Error(err)
 }
 
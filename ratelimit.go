@@ -0,0 +1,75 @@
+package rescript
+
+import (
+	"context"
+	"math"
+	"sync"
+	"time"
+)
+
+// RateLimiter limits the rate of calls to the MyScript API
+// with a token bucket.
+//
+// The bucket holds up to burst tokens and is refilled at the given rate.
+// Each call takes one token and waits if the bucket is empty.
+type RateLimiter struct {
+	mx     sync.Mutex
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+// NewRateLimiter creates a limiter that allows perSecond calls per second
+// and up to burst calls at once.
+// A rate of zero or less does not limit the calls.
+func NewRateLimiter(perSecond float64, burst int) *RateLimiter {
+	if burst < 1 {
+		burst = 1
+	}
+	return &RateLimiter{
+		rate:   perSecond,
+		burst:  float64(burst),
+		tokens: float64(burst),
+		last:   time.Now(),
+	}
+}
+
+// Wait takes a token from the bucket,
+// waiting until one is available or ctx is cancelled.
+func (l *RateLimiter) Wait(ctx context.Context) error {
+	d := l.reserve(time.Now())
+	if d == 0 {
+		return nil
+	}
+
+	err := sleep(ctx, d)
+	if err != nil {
+		// the token was not used
+		l.mx.Lock()
+		l.tokens++
+		l.mx.Unlock()
+	}
+	return err
+}
+
+// reserve takes a token and returns the time until it is available.
+func (l *RateLimiter) reserve(now time.Time) time.Duration {
+	l.mx.Lock()
+	defer l.mx.Unlock()
+
+	if l.rate <= 0 {
+		return 0
+	}
+
+	elapsed := now.Sub(l.last).Seconds()
+	if elapsed > 0 {
+		l.tokens = math.Min(l.burst, l.tokens+elapsed*l.rate)
+		l.last = now
+	}
+	l.tokens--
+	if l.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-l.tokens / l.rate * float64(time.Second))
+}
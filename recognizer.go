@@ -1,13 +1,14 @@
 package rescript
 
 import (
+	"context"
 	"crypto/sha1"
 	"encoding/hex"
 	"encoding/json"
 	"fmt"
-	"os"
-	"path/filepath"
+	"sort"
 	"sync"
+	"time"
 
 	"golang.org/x/sync/errgroup"
 
@@ -15,55 +16,242 @@ import (
 	"github.com/akeil/rmtool/pkg/lines"
 )
 
+// DefaultWorkers is the number of pages that are recognized at the same time.
+const DefaultWorkers = 4
+
 // The Recognizer organizes calls to the MyScript API to convert notbooks
 // from handwriting to a recognize Result.
 //
 // The recognizer also manages caching to avoid repeated calls to the API
 // if a page has not changed.
 type Recognizer struct {
-	ms       *MyScript
-	cacheDir string
-	cacheMx  sync.RWMutex
+	ms      *MyScript
+	cache   ResultCache
+	layers  []string
+	lexicon Lexicon
+	// lexicons hold additional words for individual languages
+	lexicons map[LanguageCode]Lexicon
+	content  ContentType
+	regions  RegionFunc
+	workers  int
+	// candidates are the languages for LangAuto
+	candidates []LanguageCode
+}
+
+// Region is an area on a page that is recognized with the given content type.
+//
+// The bounds are in pixels, like the strokes in a drawing.
+type Region struct {
+	Bounds lines.Rect
+	Type   ContentType
+	// Strokes optionally lists the strokes in the region.
+	// If it is set, strokes are assigned to the region by reference
+	// rather than by their position.
+	Strokes []lines.StrokeRef
+}
+
+// RegionFunc returns the regions of a page that should be recognized
+// with their own content type.
+type RegionFunc func(pageID string, d *lines.Drawing) []Region
+
+// PageContentTypes creates a RegionFunc that selects the content type
+// for whole pages.
+// Pages that are not in the map are recognized with the default type.
+func PageContentTypes(types map[string]ContentType) RegionFunc {
+	return func(pageID string, d *lines.Drawing) []Region {
+		ct, ok := types[pageID]
+		if !ok {
+			return nil
+		}
+		return []Region{{Bounds: pageBounds(), Type: ct}}
+	}
 }
 
 // NewRecognizer creates a recognizer withthe given credentials for the
 // MyScript API.
 //
-// If cacheDir is non-empty, it will be used to cache responses from the API.
+// If cacheDir is non-empty, it will be used to cache responses from the API,
+// without limits for the size of the cache (see SetCache).
 // If it is empty, caching is disabled.
 func NewRecognizer(appKey, hmacKey, cacheDir string) *Recognizer {
-	return &Recognizer{
-		ms:       NewMyScript(appKey, hmacKey),
-		cacheDir: cacheDir,
+	r := &Recognizer{
+		ms:      NewMyScript(appKey, hmacKey),
+		workers: DefaultWorkers,
 	}
+	if cacheDir != "" {
+		r.cache = NewFileCache(cacheDir, CacheLimits{})
+	}
+	return r
+}
+
+// SetCache sets the cache for responses from the API,
+// e.g. a FileCache or a KVCache.
+// Several recognizers can share the same cache.
+// If c is nil, caching is disabled.
+func (r *Recognizer) SetCache(c ResultCache) {
+	r.cache = c
+}
+
+// SelectLayers restricts recognition to the layers with the given names.
+//
+// Layers without a name are matched by their default name,
+// i.e. "Layer 1" for the first layer.
+// If no names are given, all layers are recognized.
+func (r *Recognizer) SelectLayers(names ...string) {
+	r.layers = names
+}
+
+// SetLexicon sets custom words and resources for recognition.
+//
+// The lexicon is part of the cache key;
+// results that were recognized with a different lexicon are not reused.
+func (r *Recognizer) SetLexicon(x Lexicon) {
+	r.lexicon = x
+}
+
+// SetLanguageLexicon sets custom words and resources
+// that are only used when recognizing in the given language.
+//
+// With LangAuto, each candidate uses its own lexicon;
+// the lexicon from SetLexicon is added to all languages.
+func (r *Recognizer) SetLanguageLexicon(l LanguageCode, x Lexicon) {
+	if r.lexicons == nil {
+		r.lexicons = make(map[LanguageCode]Lexicon)
+	}
+	r.lexicons[l] = x
+}
+
+// languageLexicon returns the lexicon for recognition in the given language.
+func (r *Recognizer) languageLexicon(l LanguageCode) Lexicon {
+	x, ok := r.lexicons[l]
+	if !ok {
+		return r.lexicon
+	}
+	return x.Merge(r.lexicon)
+}
+
+// SetContentType sets the content type for all pages, e.g. ContentMath.
+//
+// Strokes that are not in a region (see SetRegions) are recognized
+// with this type. The default is ContentText.
+func (r *Recognizer) SetContentType(ct ContentType) {
+	r.content = ct
+}
+
+// SetRegions sets a function that selects regions of a page
+// to be recognized with their own content type.
+//
+// A stroke belongs to the region that lists it
+// or to the first region that contains its center.
+// Math, diagram and drawing regions become a single block token
+// which is placed between the lines of text by its vertical position.
+// Drawings are not recognized; they are included as an image.
+// Strokes in a region with ContentIgnore are dropped.
+//
+// ClassifyRegions can be used to detect regions automatically.
+func (r *Recognizer) SetRegions(f RegionFunc) {
+	r.regions = f
+}
+
+// SetCandidates sets the languages that are tried for each page
+// when recognizing with LangAuto.
+//
+// Each page is recognized once per candidate;
+// the result with the best score is kept.
+// If several results have the same score, the first candidate wins.
+func (r *Recognizer) SetCandidates(langs ...LanguageCode) {
+	r.candidates = langs
+}
+
+// SetWorkers sets the number of pages that are recognized at the same time.
+// Values below one select DefaultWorkers.
+func (r *Recognizer) SetWorkers(n int) {
+	if n < 1 {
+		n = DefaultWorkers
+	}
+	r.workers = n
+}
+
+// SetTimeout sets the time limit for a single call to the MyScript API.
+// The default is DefaultTimeout; zero disables the limit.
+func (r *Recognizer) SetTimeout(d time.Duration) {
+	r.ms.SetTimeout(d)
+}
+
+// SetRetries sets how often a call to the MyScript API is repeated
+// if it fails with a temporary error.
+// The default is DefaultRetries.
+func (r *Recognizer) SetRetries(n int) {
+	r.ms.SetRetries(n)
+}
+
+// SetRateLimiter restricts the rate of calls to the MyScript API.
+// Several recognizers can share the same limiter.
+func (r *Recognizer) SetRateLimiter(l *RateLimiter) {
+	r.ms.SetRateLimiter(l)
 }
 
 // Recognize performs handwriting recognition on all pages of the given document.
 // It resturns a map of page-IDs and recognition results.
-func (r *Recognizer) Recognize(doc *rmtool.Document, l LanguageCode) (map[string]*Node, error) {
+//
+// With LangAuto, the language is selected for each page,
+// see SetCandidates.
+func (r *Recognizer) Recognize(doc *rmtool.Document, l LanguageCode) (map[string]*TokenList, error) {
+	return r.RecognizeContext(context.Background(), doc, l)
+}
+
+// RecognizeContext is like Recognize, but stops when ctx is cancelled.
+//
+// Pages are recognized in parallel, up to the limit set with SetWorkers.
+// If ctx is cancelled or a page fails, the pages that are in progress
+// are stopped and no more pages are started.
+// The results for the pages that were finished are returned with the error.
+func (r *Recognizer) RecognizeContext(ctx context.Context, doc *rmtool.Document, l LanguageCode) (map[string]*TokenList, error) {
+	err := r.checkLanguage(l)
+	if err != nil {
+		return nil, err
+	}
+
 	var resultsMx sync.Mutex
-	results := make(map[string]*Node)
+	results := make(map[string]*TokenList)
 
-	var group errgroup.Group
+	group, ctx := errgroup.WithContext(ctx)
+	workers := make(chan struct{}, r.workers)
 	for _, p := range doc.Pages() {
 		pageID := p
 		group.Go(func() error {
+			select {
+			case workers <- struct{}{}:
+				defer func() { <-workers }()
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+
 			d, err := doc.Drawing(pageID)
-			if err != nil {
+			// Damaged drawings are recognized as far as they could be read.
+			if err != nil && !lines.IsDecodeError(err) {
 				return err
 			}
-			res, err := r.RecognizeDrawing(d, l)
+			var res *TokenList
+			if l == LangAuto {
+				res, err = r.recognizeAuto(ctx, pageID, d)
+			} else {
+				res, err = r.recognizePage(ctx, pageID, d, l)
+			}
 			if err != nil {
 				return err
 			}
 			resultsMx.Lock()
-			results[pageID] = ToTokens(res)
+			results[pageID] = res
 			resultsMx.Unlock()
 			return nil
 		})
 	}
 
-	err := group.Wait()
+	err = group.Wait()
 	if err != nil {
 		return results, err
 	}
@@ -71,88 +259,432 @@ func (r *Recognizer) Recognize(doc *rmtool.Document, l LanguageCode) (map[string
 	return results, nil
 }
 
+// RecognizeDrawing performs handwriting recognition for a single drawing.
+//
+// If the drawing contains no handwriting, an empty result is returned
+// without calling the API.
 func (r *Recognizer) RecognizeDrawing(d *lines.Drawing, l LanguageCode) (Result, error) {
-	groups := make([]StrokeGroup, len(d.Layers))
+	return r.RecognizeDrawingContext(context.Background(), d, l)
+}
+
+// RecognizeDrawingContext is like RecognizeDrawing,
+// but the call to the API is cancelled with ctx.
+func (r *Recognizer) RecognizeDrawingContext(ctx context.Context, d *lines.Drawing, l LanguageCode) (Result, error) {
+	return r.recognizeText(ctx, r.strokeGroups(d), l)
+}
+
+// recognizePage recognizes a page with text, math and diagrams.
+func (r *Recognizer) recognizePage(ctx context.Context, pageID string, d *lines.Drawing, l LanguageCode) (*TokenList, error) {
+	var regions []Region
+	if r.regions != nil {
+		regions = r.regions(pageID, d)
+	}
+	if len(regions) == 0 && r.contentType() == ContentText {
+		res, err := r.recognizePageText(ctx, pageID, r.strokeGroups(d), l)
+		if err != nil {
+			return nil, err
+		}
+		return MergeText(res, d.Text), nil
+	}
+
+	// the last part holds the strokes outside of all regions
+	parts := splitRegions(r.strokeGroups(d), regions)
+	var text []StrokeGroup
+	var blocks []textLine
+	for i, groups := range parts {
+		ct := r.contentType()
+		if i < len(regions) {
+			ct = regions[i].Type
+		}
+		switch ct {
+		case ContentText:
+			text = append(text, groups...)
+			continue
+		case ContentIgnore:
+			continue
+		}
+
+		t, y, err := r.recognizeBlock(ctx, groups, ct, l)
+		if err != nil {
+			return nil, err
+		}
+		if t == nil {
+			continue
+		}
+		if i < len(regions) && y == 0 {
+			y = float64(regions[i].Bounds.Min.Y)
+		}
+		blocks = append(blocks, textLine{y: y, tokens: []*Token{t}})
+	}
+	sort.SliceStable(blocks, func(i, j int) bool {
+		return blocks[i].y < blocks[j].y
+	})
+
+	res, err := r.recognizePageText(ctx, pageID, text, l)
+	if err != nil {
+		return nil, err
+	}
+
+	ls := mergeLines(handwrittenLines(res), typedLines(d.Text))
+	return joinLines(mergeLines(ls, blocks)), nil
+}
+
+// recognizeAuto recognizes a page in each of the candidate languages
+// and keeps the result with the best score.
+func (r *Recognizer) recognizeAuto(ctx context.Context, pageID string, d *lines.Drawing) (*TokenList, error) {
+	var best *TokenList
+	score := -1.0
+	for _, lc := range r.candidates {
+		res, err := r.recognizePage(ctx, pageID, d, lc)
+		if err != nil {
+			return nil, err
+		}
+		if s := languageScore(res); s > score {
+			best = res
+			score = s
+		}
+	}
+	return best, nil
+}
+
+// checkLanguage tells if the recognizer can be used with the given language.
+func (r *Recognizer) checkLanguage(l LanguageCode) error {
+	if l != LangAuto {
+		if !l.Valid() {
+			return fmt.Errorf("unsupported language %q", l)
+		}
+		return nil
+	}
+
+	if len(r.candidates) == 0 {
+		return fmt.Errorf("no candidate languages for %q", l)
+	}
+	for _, c := range r.candidates {
+		if !c.Valid() {
+			return fmt.Errorf("unsupported language %q", c)
+		}
+	}
+	return nil
+}
+
+// strokeGroups converts the selected layers of a drawing.
+func (r *Recognizer) strokeGroups(d *lines.Drawing) []StrokeGroup {
+	groups := make([]StrokeGroup, 0, len(d.Layers))
 	t := int64(0)
 	for i, l := range d.Layers {
-		g, tx := ConvertLayer(t, l)
+		if !r.selected(i, l) {
+			continue
+		}
+		g, tx := ConvertLayer(t, i, l)
 		t = tx
-		groups[i] = g
+		groups = append(groups, g)
+	}
+	return groups
+}
+
+// recognizeText performs text recognition for the given strokes.
+func (r *Recognizer) recognizeText(ctx context.Context, groups []StrokeGroup, l LanguageCode) (Result, error) {
+	if countStrokes(groups) == 0 {
+		return Result{}, nil
 	}
 
-	req := prepareRequest(l)
+	req := prepareRequest(l, r.languageLexicon(l))
 	req.StrokeGroups = groups
 
 	k, err := cacheKey(req)
 	if err == nil {
-		cached, err := r.readCache(k)
+		var cached Result
+		err = r.readCache(k, &cached)
 		if err == nil {
 			return cached, nil
 		}
 	}
 
-	res, err := r.ms.Batch(req)
+	res, err := r.ms.BatchContext(ctx, req)
 	if err != nil {
 		return res, err
 	}
 
 	if k != "" {
-		go r.writeCache(k, res)
+		r.writeCache(k, res)
 	}
 
 	return res, err
 }
 
-func (r *Recognizer) readCache(key string) (Result, error) {
-	var res Result
-
-	if r.cacheDir == "" {
-		return res, fmt.Errorf("cache dir not set")
+// recognizePageText performs text recognition for the strokes on a page.
+//
+// If the page was recognized before and strokes were only added,
+// in an area apart from the recognized words,
+// only the new strokes are recognized
+// and their words are added to the previous result.
+// Otherwise, all strokes are recognized.
+//
+// Results combined from earlier ones are only stored in the page state,
+// not under the cache key of the full request,
+// so that the key only refers to results of a full recognition.
+func (r *Recognizer) recognizePageText(ctx context.Context, pageID string, groups []StrokeGroup, l LanguageCode) (Result, error) {
+	if r.cache == nil || countStrokes(groups) == 0 {
+		return r.recognizeText(ctx, groups, l)
 	}
 
-	r.cacheMx.RLock()
-	defer r.cacheMx.RUnlock()
+	req := prepareRequest(l, r.languageLexicon(l))
+	req.StrokeGroups = groups
 
-	p := filepath.Join(r.cacheDir, key+".cache.json")
-	f, err := os.Open(p)
+	k, err := cacheKey(req)
 	if err != nil {
-		return res, err
+		return r.recognizeText(ctx, groups, l)
+	}
+	var res Result
+	err = r.readCache(k, &res)
+	if err == nil {
+		return res, nil
 	}
-	defer f.Close()
 
-	err = json.NewDecoder(f).Decode(&res)
-	if err != nil {
-		return res, err
+	pk := pageKey(pageID, req)
+	var prev pageState
+	var added []StrokeGroup
+	ok := false
+	if r.readCache(pk, &prev) == nil {
+		added, ok = prev.added(groups)
+	}
+
+	if ok {
+		if countStrokes(added) == 0 {
+			return prev.Result, nil
+		}
+		part, err := r.recognizeText(ctx, added, l)
+		if err != nil {
+			return part, err
+		}
+		res = spliceResult(prev.Result, part)
+	} else {
+		res, err = r.ms.BatchContext(ctx, req)
+		if err != nil {
+			return res, err
+		}
+		r.writeCache(k, res)
 	}
 
+	r.writeCache(pk, newPageState(groups, res))
+
 	return res, nil
 }
 
-func (r *Recognizer) writeCache(key string, res Result) error {
-	if r.cacheDir == "" {
-		return fmt.Errorf("cache dir not set")
+// recognizeBlock performs math or diagram recognition for the given strokes
+// or creates an image for a drawing.
+//
+// It returns a block token and its vertical position in pixels,
+// or nil if there are no strokes.
+func (r *Recognizer) recognizeBlock(ctx context.Context, groups []StrokeGroup, ct ContentType, l LanguageCode) (*Token, float64, error) {
+	if countStrokes(groups) == 0 {
+		return nil, 0, nil
+	}
+
+	if ct == ContentDrawing {
+		sk, err := renderSketch(groups)
+		if err != nil {
+			return nil, 0, err
+		}
+		return NewSketchToken(sk), float64(sk.Bounds.Min.Y), nil
 	}
 
-	r.cacheMx.Lock()
-	defer r.cacheMx.Unlock()
+	req := prepareRequest(l, r.languageLexicon(l))
+	req.ContentType = ct
+	req.StrokeGroups = groups
 
-	err := os.MkdirAll(r.cacheDir, 0755)
-	if err != nil {
-		if !os.IsExist(err) {
-			return err
+	switch ct {
+	case ContentMath:
+		req.Configuration.Math = NewMathConfiguration()
+		var res MathResult
+		k, err := cacheKey(req)
+		if err == nil {
+			err = r.readCache(k, &res)
+		}
+		if err != nil {
+			res, err = r.ms.BatchMathContext(ctx, req)
+			if err != nil {
+				return nil, 0, err
+			}
+			r.writeCache(k, res)
+		}
+		return NewMathToken(res), blockY(res.BoundingBox), nil
+	case ContentDiagram, ContentRawContent:
+		var res DiagramResult
+		k, err := cacheKey(req)
+		if err == nil {
+			err = r.readCache(k, &res)
+		}
+		if err != nil {
+			res, err = r.ms.BatchDiagramContext(ctx, req)
+			if err != nil {
+				return nil, 0, err
+			}
+			r.writeCache(k, res)
+		}
+		return NewDiagramToken(res), blockY(res.BoundingBox), nil
+	default:
+		return nil, 0, fmt.Errorf("unsupported content type %q", ct)
+	}
+}
+
+func (r *Recognizer) contentType() ContentType {
+	if r.content == "" {
+		return ContentText
+	}
+	return r.content
+}
+
+// splitRegions assigns each stroke to the region that lists it
+// or to the first region that contains the center of the stroke.
+//
+// The result has one entry per region
+// and a last entry with the strokes outside of all regions.
+func splitRegions(groups []StrokeGroup, regions []Region) [][]StrokeGroup {
+	listed := make(map[lines.StrokeRef]int)
+	for j, rg := range regions {
+		for _, ref := range rg.Strokes {
+			if _, ok := listed[ref]; !ok {
+				listed[ref] = j
+			}
+		}
+	}
+
+	parts := make([][]StrokeGroup, len(regions)+1)
+	for _, g := range groups {
+		split := make([]StrokeGroup, len(parts))
+		for _, s := range g.Strokes {
+			i := regionOf(s, regions, listed)
+			if split[i].Strokes == nil {
+				split[i] = StrokeGroup{PenStyle: g.PenStyle}
+			}
+			split[i].Strokes = append(split[i].Strokes, s)
+		}
+		for i, sg := range split {
+			if len(sg.Strokes) != 0 {
+				parts[i] = append(parts[i], sg)
+			}
+		}
+	}
+	return parts
+}
+
+// regionOf returns the index of the region for the given stroke,
+// or len(regions) if it is not in any region.
+func regionOf(s Stroke, regions []Region, listed map[lines.StrokeRef]int) int {
+	if ref, ok := parseStrokeID(s.ID); ok {
+		if i, ok := listed[ref]; ok {
+			return i
+		}
+	}
+
+	c := strokeCenter(s)
+	for i, rg := range regions {
+		if len(rg.Strokes) == 0 && rg.Bounds.Contains(c) {
+			return i
+		}
+	}
+	return len(regions)
+}
+
+func strokeCenter(s Stroke) lines.Point {
+	if len(s.X) == 0 {
+		return lines.Point{}
+	}
+	minX, maxX := s.X[0], s.X[0]
+	minY, maxY := s.Y[0], s.Y[0]
+	for i := range s.X {
+		if s.X[i] < minX {
+			minX = s.X[i]
+		}
+		if s.X[i] > maxX {
+			maxX = s.X[i]
+		}
+		if s.Y[i] < minY {
+			minY = s.Y[i]
+		}
+		if s.Y[i] > maxY {
+			maxY = s.Y[i]
+		}
+	}
+	return lines.Point{
+		X: float32(minX+maxX) / 2,
+		Y: float32(minY+maxY) / 2,
+	}
+}
+
+func countStrokes(groups []StrokeGroup) int {
+	n := 0
+	for _, g := range groups {
+		n += len(g.Strokes)
+	}
+	return n
+}
+
+// blockY returns the top of a bounding box in pixels.
+func blockY(b BoundingBox) float64 {
+	if b.IsZero() {
+		return 0
+	}
+	return toPixels(b.Y)
+}
+
+// pageBounds returns the bounds of a full page.
+func pageBounds() lines.Rect {
+	return lines.Rect{
+		Max: lines.Point{X: float32(lines.MaxWidth), Y: float32(lines.MaxHeight)},
+	}
+}
+
+// selected tells if the layer with index i should be recognized.
+func (r *Recognizer) selected(i int, l lines.Layer) bool {
+	if len(r.layers) == 0 {
+		return true
+	}
+
+	name := l.Name
+	if name == "" {
+		name = fmt.Sprintf("Layer %d", i+1)
+	}
+	for _, s := range r.layers {
+		if s == name {
+			return true
 		}
 	}
-	p := filepath.Join(r.cacheDir, key+".cache.json")
-	f, err := os.Create(p)
+	return false
+}
+
+// readCache decodes the cached result for the given key into v.
+func (r *Recognizer) readCache(key string, v interface{}) error {
+	if r.cache == nil {
+		return fmt.Errorf("cache not set")
+	}
+
+	data, err := r.cache.Get(key)
 	if err != nil {
 		return err
 	}
-	defer f.Close()
 
-	return json.NewEncoder(f).Encode(res)
+	return json.Unmarshal(data, v)
+}
+
+// writeCache stores a result in the cache.
+//
+// Errors are ignored, as they only mean that the page
+// will be recognized again.
+func (r *Recognizer) writeCache(key string, v interface{}) {
+	if r.cache == nil {
+		return
+	}
+
+	data, err := json.Marshal(v)
+	if err != nil {
+		return
+	}
+	r.cache.Put(key, data)
 }
 
-func prepareRequest(l LanguageCode) Request {
+func prepareRequest(l LanguageCode, x Lexicon) Request {
 	req := NewRequest()
 	req.Width = lines.MaxWidth
 	req.Height = lines.MaxHeight
@@ -161,32 +693,37 @@ func prepareRequest(l LanguageCode) Request {
 	chars := false
 	words := true
 	req.Configuration = NewConfiguration(l, guides, bbox, chars, words)
+	req.Configuration.Text.Configuration.CustomLexicon = x.Words
+	req.Configuration.Text.Configuration.CustomResources = x.Resources
 
 	return req
 }
 
+// cacheKey derives the key for a result from the request.
+// Requests with the same strokes and configuration have the same key,
+// so a cache can be shared between machines.
 func cacheKey(req Request) (string, error) {
 	cs := sha1.New()
 	req.checksum(cs)
 	return hex.EncodeToString(cs.Sum(nil)), nil
 }
 
-func ToTokens(r Result) *Node {
+// ToTokenList creates a list of tokens from the recognized words.
+func ToTokenList(r Result) *TokenList {
 	// this assumes the the MmyScript "words" are exactly the same concept
 	// as our "tokens".
 	// Seems to be the case, AFAIK
-	var head *Node
-	var tail *Node
-	var curr *Node
+	l := NewTokenList()
 	for _, w := range r.Words {
-		curr = NewNode(NewToken(w.Label))
-		if head != nil {
-			head.InsertAfter(curr)
-			head = curr
-		} else {
-			head = curr
-			tail = curr
-		}
+		l.Append(wordToken(w))
 	}
-	return tail
+	return l
+}
+
+// ToTokens creates a chain of nodes from the recognized words
+// and returns the first one, or nil if there are no words.
+//
+// Use ToTokenList instead.
+func ToTokens(r Result) *Node {
+	return ToTokenList(r).First()
 }
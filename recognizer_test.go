@@ -1,9 +1,19 @@
 package rescript
 
 import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
+
+	"github.com/akeil/rmtool"
+	"github.com/akeil/rmtool/pkg/lines"
 )
 
 func TestWordsToTokens(t *testing.T) {
@@ -34,3 +44,119 @@ func TestWordsToTokens(t *testing.T) {
 
 	assert.True(n.IsHead())
 }
+
+func TestSelectLayers(t *testing.T) {
+	assert := assert.New(t)
+
+	r := NewRecognizer("", "", "")
+	assert.True(r.selected(0, lines.Layer{Name: "Sketch"}))
+
+	r.SelectLayers("Layer 1", "Notes")
+	assert.True(r.selected(0, lines.Layer{}))
+	assert.False(r.selected(1, lines.Layer{}))
+	assert.True(r.selected(1, lines.Layer{Name: "Notes"}))
+	assert.False(r.selected(0, lines.Layer{Name: "Sketch"}))
+
+	// nothing selected - no need to call the API
+	d := lines.NewDrawing()
+	d.AddLayer("Sketch")
+	d.Layers[1].Strokes = []lines.Stroke{
+		{BrushType: lines.BallpointV5, Dots: []lines.Dot{{X: 1, Y: 1}, {X: 2, Y: 2}}},
+	}
+	res, err := r.RecognizeDrawing(d, LangEN)
+	assert.Nil(err)
+	assert.Empty(res.Words)
+}
+
+// testNotebook creates a notebook with an empty first page
+// and n more pages with handwriting.
+func testNotebook(n int) *rmtool.Document {
+	doc := rmtool.NewNotebook("Test", "")
+	for i := 0; i < n; i++ {
+		d, _ := doc.Drawing(doc.CreatePage())
+		d.Layers[0].Strokes = []lines.Stroke{
+			{BrushType: lines.BallpointV5, Dots: []lines.Dot{{X: 1, Y: 1}, {X: 20, Y: 20}}},
+		}
+	}
+	return doc
+}
+
+// blockingServer creates a server that does not respond
+// until the client gives up.
+func blockingServer() *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		// the request is cancelled when the client disconnects,
+		// which is only noticed after the body was read
+		ioutil.ReadAll(req.Body)
+		<-req.Context().Done()
+	}))
+}
+
+func TestRecognizeWorkers(t *testing.T) {
+	assert := assert.New(t)
+
+	var mx sync.Mutex
+	active, peak := 0, 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		mx.Lock()
+		active++
+		if active > peak {
+			peak = active
+		}
+		mx.Unlock()
+
+		time.Sleep(20 * time.Millisecond)
+		w.Write([]byte(`{"label": "foo", "words": [{"label": "foo"}]}`))
+
+		mx.Lock()
+		active--
+		mx.Unlock()
+	}))
+	defer srv.Close()
+
+	r := NewRecognizer("", "", "")
+	r.ms.host = srv.URL
+	r.SetWorkers(2)
+
+	results, err := r.Recognize(testNotebook(5), LangEN)
+	assert.Nil(err)
+	assert.Len(results, 6)
+	assert.Equal(2, peak)
+}
+
+func TestRecognizeCancel(t *testing.T) {
+	assert := assert.New(t)
+
+	srv := blockingServer()
+	defer srv.Close()
+
+	r := NewRecognizer("", "", "")
+	r.ms.host = srv.URL
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(50*time.Millisecond, cancel)
+
+	doc := testNotebook(3)
+	results, err := r.RecognizeContext(ctx, doc, LangEN)
+	assert.True(errors.Is(err, context.Canceled))
+	// the empty page is finished without a call to the API
+	assert.Len(results, 1)
+	assert.Contains(results, doc.Pages()[0])
+}
+
+func TestRecognizeTimeout(t *testing.T) {
+	assert := assert.New(t)
+
+	srv := blockingServer()
+	defer srv.Close()
+
+	r := NewRecognizer("", "", "")
+	r.ms.host = srv.URL
+	r.SetTimeout(50 * time.Millisecond)
+
+	doc := testNotebook(1)
+	d, err := doc.Drawing(doc.Pages()[1])
+	assert.Nil(err)
+	_, err = r.RecognizeDrawing(d, LangEN)
+	assert.True(errors.Is(err, context.DeadlineExceeded))
+}
@@ -9,6 +9,9 @@ type LanguageCode string
 
 type PointerType string
 
+// ContentType is the recognition type for the MyScript API.
+type ContentType string
+
 const (
 	LangEN LanguageCode = "en_US"
 	LangDE LanguageCode = "de_DE"
@@ -17,7 +20,13 @@ const (
 	Touch  PointerType = "TOUCH"
 	Eraser PointerType = "ERASER"
 
-	defaultContentType = "Text"
+	ContentText         ContentType = "Text"
+	ContentMath         ContentType = "Math"
+	ContentDiagram      ContentType = "Diagram"
+	ContentRawContent   ContentType = "Raw Content"
+	ContentTextDocument ContentType = "Text Document"
+
+	defaultContentType = ContentText
 	defaultConversion  = "DIGITAL_EDIT"
 	defaultPenStyle    = "color: #000000; -myscript-pen-width: ;"
 	defaultResolution  = 96
@@ -30,7 +39,7 @@ type Request struct {
 	Height int64 `json:"height"`
 	// ContentType controls the "recognition type" of the MyScript API.
 	// It must be one of Text, Diagram, Math, Raw Content, Text Document
-	ContentType string `json:"contentType"`
+	ContentType ContentType `json:"contentType"`
 	// Must be DIGITAL_EDIT when the ReST API is used.
 	ConversionState string        `json:"conversionState"`
 	XDpi            int64         `json:"xDPI"`
@@ -55,7 +64,10 @@ func (r Request) checksum(h hash.Hash) {
 	binary.Write(h, binary.LittleEndian, r.Width)
 	binary.Write(h, binary.LittleEndian, r.Height)
 	binary.Write(h, binary.LittleEndian, r.ConversionState)
-	binary.Write(h, binary.LittleEndian, r.ContentType)
+	// text requests keep their checksum
+	if r.ContentType != defaultContentType {
+		h.Write([]byte(r.ContentType))
+	}
 	binary.Write(h, binary.LittleEndian, r.XDpi)
 	binary.Write(h, binary.LittleEndian, r.YDpi)
 	r.Configuration.checksum(h)
@@ -115,6 +127,9 @@ func NewStroke() Stroke {
 }
 
 func (s Stroke) checksum(h hash.Hash) {
+	// The ID is left out, so that cache keys from earlier versions stay valid.
+	// It is derived from the position of the stroke in the layer,
+	// not from its content.
 	h.Write([]byte(s.PointerType))
 	for i := 0; i < len(s.X); i++ {
 		binary.Write(h, binary.LittleEndian, int64(s.X[i]))
@@ -132,6 +147,7 @@ type Configuration struct {
 	Text       *TextConfiguration       `json:"text,omitempty"`
 	Export     *ExportConfiguration     `json:"export,omitempty"`
 	RawContent *RawContentConfiguration `json:"raw-content,omitempty"`
+	Math       *MathConfiguration       `json:"math,omitempty"`
 }
 
 // NewConfiguration creates a new configuration object with the given values.
@@ -149,6 +165,9 @@ func (c Configuration) checksum(h hash.Hash) {
 	c.Text.checksum(h)
 	c.Export.checksum(h)
 	c.RawContent.checksum(h)
+	if c.Math != nil {
+		c.Math.checksum(h)
+	}
 }
 
 // TextConfiguration holds settings holds settings for text recognition.
@@ -176,7 +195,7 @@ func NewTextConfiguration(guides bool) *TextConfiguration {
 
 func (t *TextConfiguration) checksum(h hash.Hash) {
 	binary.Write(h, binary.LittleEndian, t.Guides.Enable)
-	binary.Write(h, binary.LittleEndian, t.Configuration.AddLKText)
+	t.Configuration.checksum(h)
 	binary.Write(h, binary.LittleEndian, t.Margin.Top)
 	binary.Write(h, binary.LittleEndian, t.Margin.Left)
 	binary.Write(h, binary.LittleEndian, t.Margin.Right)
@@ -274,7 +293,7 @@ func NewRawContentConfiguration() *RawContentConfiguration {
 func (r *RawContentConfiguration) checksum(h hash.Hash) {
 	binary.Write(h, binary.LittleEndian, r.Recognition.Text)
 	binary.Write(h, binary.LittleEndian, r.Recognition.Shape)
-	binary.Write(h, binary.LittleEndian, r.Text.AddLKText)
+	r.Text.checksum(h)
 }
 
 type RawRecognitionConfiguration struct {
@@ -287,3 +306,18 @@ type RawTextConfiguration struct {
 	CustomLexicon   []string `json:"customLexicon,omitempty"`
 	AddLKText       bool     `json:"addLKText"`
 }
+
+func (c RawTextConfiguration) checksum(h hash.Hash) {
+	binary.Write(h, binary.LittleEndian, c.AddLKText)
+	// requests without custom vocabulary keep their checksum
+	if len(c.CustomResources) == 0 && len(c.CustomLexicon) == 0 {
+		return
+	}
+	for _, list := range [][]string{c.CustomResources, c.CustomLexicon} {
+		binary.Write(h, binary.LittleEndian, int64(len(list)))
+		for _, s := range list {
+			binary.Write(h, binary.LittleEndian, int64(len(s)))
+			h.Write([]byte(s))
+		}
+	}
+}
@@ -2,14 +2,53 @@ package rescript
 
 import (
 	"io"
+	"strings"
+	"time"
 )
 
 // Metadata holds information about a document.
 type Metadata struct {
 	Title   string
 	PageIDs []string
+	// ID is the document ID on the tablet.
+	ID string
+	// Version is the document version on the tablet.
+	Version uint
+	// LastModified is the time the document was last changed.
+	LastModified time.Time
+	// Folder is the path of the folder that contains the document,
+	// with "/" as the separator.
+	Folder string
+	// Language is the language used for recognition.
+	Language LanguageCode
+	// PageCount is the number of pages in the document.
+	// If it is not set, the number of PageIDs is used.
+	PageCount int
+}
+
+// pageCount returns the number of pages in the document.
+func (m Metadata) pageCount() int {
+	if m.PageCount != 0 {
+		return m.PageCount
+	}
+	return len(m.PageIDs)
 }
 
 // ComposeFunc is a function that generates an output document from the given
 // set of tokens. THe result is written to the given writer.
-type ComposeFunc func(w io.Writer, m Metadata, r map[string]*Node) error
+type ComposeFunc func(w io.Writer, m Metadata, r map[string]*TokenList) error
+
+// ComposeOptions control the output of a composer.
+type ComposeOptions struct {
+	// MarkUncertain adds the alternatives to words for which the recognizer
+	// was not sure, e.g. "word{?alt1|alt2}"; see Token.IsUncertain.
+	MarkUncertain bool
+}
+
+// tokenText returns the output text for a token.
+func (o ComposeOptions) tokenText(t *Token) string {
+	if !o.MarkUncertain || !t.IsUncertain() {
+		return t.String()
+	}
+	return t.String() + "{?" + strings.Join(t.Alternatives(), "|") + "}"
+}
@@ -25,6 +25,7 @@ type Document struct {
 	pages            map[string]*Page
 	pagesMx          sync.Mutex
 	drawings         map[string]*lines.Drawing
+	drawingErrs      map[string]error
 	drawingsMx       sync.Mutex
 	attachmentReader AttachmentReader
 	repo             Repository
@@ -268,7 +269,8 @@ func (d *Document) CreatePage() string {
 	pgMeta := &PageMetadata{
 		Layers: []LayerMetadata{
 			LayerMetadata{
-				Name: "Layer 1",
+				Name:    "Layer 1",
+				Visible: true,
 			},
 		},
 	}
@@ -280,7 +282,9 @@ func (d *Document) CreatePage() string {
 	if d.drawings == nil {
 		d.drawings = make(map[string]*lines.Drawing)
 	}
-	d.drawings[pageID] = lines.NewDrawing()
+	dr := lines.NewDrawing()
+	dr.Layers[0].Name = pgMeta.Layers[0].Name
+	d.drawings[pageID] = dr
 
 	return pageID
 }
@@ -446,6 +450,10 @@ func (d *Document) Page(pageID string) (*Page, error) {
 // Note that not all pages have associated drawings.
 // If a page has no drawing, an error of type "Not Found" is returned
 // (use IsNotFound(err) to check for this).
+//
+// Corrupt drawings are read in lenient mode. In that case, the recovered
+// part of the drawing is returned together with a *lines.DecodeError
+// (use lines.IsDecodeError(err) to check for this).
 func (d *Document) Drawing(pageID string) (*lines.Drawing, error) {
 	d.drawingsMx.Lock()
 	defer d.drawingsMx.Unlock()
@@ -453,9 +461,12 @@ func (d *Document) Drawing(pageID string) (*lines.Drawing, error) {
 	if d.drawings == nil {
 		d.drawings = make(map[string]*lines.Drawing)
 	}
+	if d.drawingErrs == nil {
+		d.drawingErrs = make(map[string]error)
+	}
 	cached := d.drawings[pageID]
 	if cached != nil {
-		return cached, nil
+		return cached, d.drawingErrs[pageID]
 	}
 
 	idx, err := d.pageIndex(pageID)
@@ -471,14 +482,39 @@ func (d *Document) Drawing(pageID string) (*lines.Drawing, error) {
 	}
 	defer dr.Close()
 
-	drawing, err := lines.ReadDrawing(dr)
+	drawing, err := lines.NewDecoderOptions(dr, lines.ReadOptions{Lenient: true}).Decode()
 	if err != nil {
-		return nil, err
+		if !lines.IsDecodeError(err) {
+			return nil, err
+		}
+		logging.Warning("Drawing for page %v is damaged: %v", pageID, err)
+		d.drawingErrs[pageID] = err
+	}
+
+	// v3 and v5 drawings keep layer names and visibility in the page metadata
+	if drawing.Version != lines.V6 {
+		p, perr := d.Page(pageID)
+		if perr != nil {
+			logging.Debug("No layer metadata for page %v: %v", pageID, perr)
+		} else {
+			applyLayerMetadata(drawing, p.Layers())
+		}
 	}
 
 	d.drawings[pageID] = drawing
 
-	return drawing, nil
+	return drawing, err
+}
+
+// applyLayerMetadata sets the names and visibility of the layers in the drawing.
+func applyLayerMetadata(d *lines.Drawing, meta []LayerMetadata) {
+	for i, lm := range meta {
+		if i >= len(d.Layers) {
+			break
+		}
+		d.Layers[i].Name = lm.Name
+		d.Layers[i].Hidden = !lm.Visible
+	}
 }
 
 // AttachmentReader returns a reader for an associated PDF or EPUB files
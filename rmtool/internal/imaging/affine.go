@@ -4,7 +4,8 @@ import (
 	"math"
 )
 
-func identity() []float64 {
+// Identity Matrix
+func Identity() []float64 {
 	return []float64{
 		1, 0, 0,
 		0, 1, 0,
@@ -18,8 +19,8 @@ func identity() []float64 {
 //  sin(angle)    cos(angle)    0
 //  0             0             1
 //
-func rotation(angle float64) []float64 {
-	m := identity()
+func Rotation(angle float64) []float64 {
+	m := Identity()
 	m[0] = math.Cos(angle)
 	m[1] = math.Sin(angle) * -1
 
@@ -35,8 +36,8 @@ func rotation(angle float64) []float64 {
 //  0  1  dy
 //  0  0  1
 //
-func translation(dx, dy float64) []float64 {
-	m := identity()
+func Translation(dx, dy float64) []float64 {
+	m := Identity()
 
 	m[2] = dx
 	m[5] = dy
@@ -44,8 +45,37 @@ func translation(dx, dy float64) []float64 {
 	return m
 }
 
-// transform applies an affine transform to the given x,y point.
-func transform(m []float64, x, y float64) (float64, float64) {
+// Scaling Matrix:
+//
+//  sx 0   0
+//  0  sy  0
+//  0  0   1
+//
+func Scaling(sx, sy float64) []float64 {
+	m := Identity()
+
+	m[0] = sx
+	m[4] = sy
+
+	return m
+}
+
+// Multiply combines two transformations.
+// The result applies b first, then a.
+func Multiply(a, b []float64) []float64 {
+	m := make([]float64, 9)
+	for row := 0; row < 3; row++ {
+		for col := 0; col < 3; col++ {
+			for k := 0; k < 3; k++ {
+				m[row*3+col] += a[row*3+k] * b[k*3+col]
+			}
+		}
+	}
+	return m
+}
+
+// Transform applies an affine transform to the given x,y point.
+func Transform(m []float64, x, y float64) (float64, float64) {
 	tx := m[0]*x + m[1]*y + m[2]
 	ty := m[3]*x + m[4]*y + m[5]
 	return tx, ty
@@ -10,8 +10,8 @@ func TestRotation(t *testing.T) {
 	y := 2
 	rad := 90 * math.Pi / 180
 
-	rot := rotation(rad)
-	tx, ty := transform(rot, float64(x), float64(y))
+	rot := Rotation(rad)
+	tx, ty := Transform(rot, float64(x), float64(y))
 
 	if math.Round(tx) != -2 {
 		t.Errorf("unexpected value for transformed x: %v", tx)
@@ -21,9 +21,9 @@ func TestRotation(t *testing.T) {
 	}
 
 	// translating around the center should result in the same point
-	t0 := translation(float64(-x), float64(-y))
-	tx, ty = transform(t0, float64(x), float64(y))
-	tx, ty = transform(rot, float64(tx), float64(ty))
+	t0 := Translation(float64(-x), float64(-y))
+	tx, ty = Transform(t0, float64(x), float64(y))
+	tx, ty = Transform(rot, float64(tx), float64(ty))
 
 	if math.Round(tx) != 0 {
 		t.Errorf("unexpected value for transformed x: %v", tx)
@@ -32,3 +32,22 @@ func TestRotation(t *testing.T) {
 		t.Errorf("unexpected value for transformed y: %v", ty)
 	}
 }
+
+func TestMultiply(t *testing.T) {
+	// translate first, then scale
+	m := Multiply(Scaling(2, 3), Translation(1, 1))
+	tx, ty := Transform(m, 1, 2)
+
+	if tx != 4 {
+		t.Errorf("unexpected value for transformed x: %v", tx)
+	}
+	if ty != 9 {
+		t.Errorf("unexpected value for transformed y: %v", ty)
+	}
+
+	m = Multiply(Identity(), Rotation(math.Pi/2))
+	tx, ty = Transform(m, 1, 2)
+	if math.Round(tx) != -2 || math.Round(ty) != 1 {
+		t.Errorf("unexpected transformed point: %v, %v", tx, ty)
+	}
+}
@@ -76,18 +76,18 @@ func Rotate(angle float64, i image.Image) image.Image {
 
 	// Rotation around center instead of origin
 	// means: Translate - Rotate - Translate
-	t0 := translation(-a/2, -b/2)
-	rot := rotation(angle)
-	t1 := translation(a/2, b/2)
+	t0 := Translation(-a/2, -b/2)
+	rot := Rotation(angle)
+	t1 := Translation(a/2, b/2)
 
 	// Transform each pixel and set it on the destination image.
 	var tx, ty float64
 	for x := 0; x < xMax; x++ {
 		for y := 0; y < yMax; y++ {
 			tx, ty = float64(x), float64(y)
-			tx, ty = transform(t0, tx, ty)
-			tx, ty = transform(rot, tx, ty)
-			tx, ty = transform(t1, tx, ty)
+			tx, ty = Transform(t0, tx, ty)
+			tx, ty = Transform(rot, tx, ty)
+			tx, ty = Transform(t1, tx, ty)
 
 			tx = math.Round(tx)
 			ty = math.Round(ty)
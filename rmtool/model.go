@@ -208,7 +208,21 @@ func (p PageMetadata) Validate() error {
 type LayerMetadata struct {
 	// Name is the display name for this layer.
 	Name string `json:"name"`
-	// TODO: visible y/n?
+	// Visible tells if the layer is shown on the tablet.
+	// Layers are visible if the metadata does not say otherwise.
+	Visible bool `json:"visible"`
+}
+
+func (l *LayerMetadata) UnmarshalJSON(b []byte) error {
+	// use an alias type to avoid recursion
+	type layerMetadata LayerMetadata
+	lm := layerMetadata{Visible: true}
+	err := json.Unmarshal(b, &lm)
+	if err != nil {
+		return err
+	}
+	*l = LayerMetadata(lm)
+	return nil
 }
 
 func (l LayerMetadata) Validate() error {
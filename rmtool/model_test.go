@@ -103,6 +103,25 @@ func TestReadPageMetadata(t *testing.T) {
 	}
 }
 
+func TestLayerVisibility(t *testing.T) {
+	s := `{"layers": [{"name": "Layer 1"}, {"name": "Sketch", "visible": false}]}`
+	var p PageMetadata
+	err := json.Unmarshal([]byte(s), &p)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(p.Layers) != 2 {
+		t.Fatalf("unexpected number of layers")
+	}
+	if !p.Layers[0].Visible {
+		t.Errorf("layers should be visible by default")
+	}
+	if p.Layers[1].Visible || p.Layers[1].Name != "Sketch" {
+		t.Errorf("unexpected layer %v", p.Layers[1])
+	}
+}
+
 func TestReadPagedata(t *testing.T) {
 	s := "P Lines medium\nP Lines medium\nP Lines medium"
 	r := strings.NewReader(s)
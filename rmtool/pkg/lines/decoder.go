@@ -0,0 +1,245 @@
+package lines
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+)
+
+// Sizes of the fixed-size records in the v3 and v5 formats.
+const (
+	strokeHeaderSizeV3 = 20
+	strokeHeaderSizeV5 = 24
+	dotSize            = 24
+	// maxPrealloc limits the number of dots that are allocated up front,
+	// in case the dot count is corrupt.
+	maxPrealloc = 4096
+)
+
+// A Decoder reads drawings from an input stream.
+//
+// Unlike ReadDrawing, the decoder reads through a buffer and decodes values
+// without reflection. It can also be used to visit strokes one by one,
+// without building the complete Drawing.
+type Decoder struct {
+	r       *bufio.Reader
+	opts    ReadOptions
+	offset  int64
+	scratch [strokeHeaderSizeV5]byte
+	dots    []Dot
+}
+
+// NewDecoder creates a decoder that reads from r.
+func NewDecoder(r io.Reader) *Decoder {
+	return NewDecoderOptions(r, ReadOptions{})
+}
+
+// NewDecoderOptions creates a decoder that reads from r, using the given options.
+//
+// If the data is corrupt, Decode and Visit return a *DecodeError.
+// In lenient mode, Decode returns everything that could be recovered.
+func NewDecoderOptions(r io.Reader, o ReadOptions) *Decoder {
+	return &Decoder{
+		r:    bufio.NewReader(r),
+		opts: o,
+	}
+}
+
+// Decode reads the complete drawing.
+func (dec *Decoder) Decode() (*Drawing, error) {
+	d := &Drawing{}
+
+	version, err := dec.readHeader()
+	if err != nil {
+		return d, err
+	}
+	d.Version = version
+
+	if version == V6 {
+		err = readV6(dec.r, d, dec.opts)
+		return d, err
+	}
+
+	err = dec.walk(version, func(n uint32) {
+		d.Layers = make([]Layer, 0, prealloc(n))
+	}, func(layer int, n uint32) {
+		d.Layers = append(d.Layers, Layer{Strokes: make([]Stroke, 0, prealloc(n))})
+	}, func(layer int, s *Stroke) error {
+		// the stroke shares the scratch space for dots - copy them.
+		dots := make([]Dot, len(s.Dots))
+		copy(dots, s.Dots)
+		s.Dots = dots
+		d.Layers[layer].Strokes = append(d.Layers[layer].Strokes, *s)
+		return nil
+	})
+
+	if err != nil && dec.opts.Lenient {
+		if de, ok := err.(*DecodeError); ok {
+			d.trim(de.Layer, de.Stroke)
+		}
+	}
+
+	return d, err
+}
+
+// Visit reads the drawing and calls f for each stroke, in order.
+//
+// The stroke and its dots are only valid during the call to f;
+// the decoder reuses them for the next stroke.
+// If f returns an error, decoding stops and the error is returned.
+func (dec *Decoder) Visit(f func(layer int, s *Stroke) error) error {
+	version, err := dec.readHeader()
+	if err != nil {
+		return err
+	}
+
+	// v6 must be read completely to resolve the order of strokes.
+	if version == V6 {
+		d := &Drawing{}
+		decodeErr := readV6(dec.r, d, dec.opts)
+		if decodeErr != nil && !dec.opts.Lenient {
+			return decodeErr
+		}
+		for i, l := range d.Layers {
+			for j := range l.Strokes {
+				err = f(i, &l.Strokes[j])
+				if err != nil {
+					return err
+				}
+			}
+		}
+		return decodeErr
+	}
+
+	return dec.walk(version, nil, nil, f)
+}
+
+// walk reads layers and strokes and reports them through the given callbacks.
+// The callbacks for the number of layers and strokes are optional.
+func (dec *Decoder) walk(v Version, layers func(n uint32), strokes func(layer int, n uint32), f func(layer int, s *Stroke) error) error {
+	fail := func(err error, layer, stroke int) error {
+		return &DecodeError{Offset: dec.offset, Layer: layer, Stroke: stroke, Err: err}
+	}
+
+	nLayers, err := dec.uint32()
+	if err != nil {
+		return fail(fmt.Errorf("failed to read number of layers"), -1, -1)
+	}
+	if layers != nil {
+		layers(nLayers)
+	}
+
+	var s Stroke
+	for i := 0; i < int(nLayers); i++ {
+		nStrokes, err := dec.uint32()
+		if err != nil {
+			return fail(fmt.Errorf("failed to read number of strokes"), i, -1)
+		}
+		if strokes != nil {
+			strokes(i, nStrokes)
+		}
+
+		for j := 0; j < int(nStrokes); j++ {
+			err = dec.readStroke(v, &s)
+			if err != nil {
+				return fail(err, i, j)
+			}
+			// Unknown brushes mean that we have lost track of the structure.
+			if dec.opts.Lenient && validateBrushType(s.BrushType) != nil {
+				return fail(fmt.Errorf("invalid brush type %v", s.BrushType), i, j)
+			}
+			err = f(i, &s)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+func (dec *Decoder) readHeader() (Version, error) {
+	buf := make([]byte, headerLen)
+	err := dec.readFull(buf)
+	if err != nil {
+		return V3, fmt.Errorf("unexpected header size")
+	}
+	return parseHeader(string(buf))
+}
+
+// readStroke reads a stroke into s, reusing the scratch space for dots.
+func (dec *Decoder) readStroke(v Version, s *Stroke) error {
+	size := strokeHeaderSizeV3
+	if v == V5 {
+		size = strokeHeaderSizeV5
+	}
+	buf := dec.scratch[:size]
+	err := dec.readFull(buf)
+	if err != nil {
+		return fmt.Errorf("failed to read stroke")
+	}
+
+	s.BrushType = BrushType(endianess.Uint32(buf[0:]))
+	s.BrushColor = BrushColor(endianess.Uint32(buf[4:]))
+	s.Padding = endianess.Uint32(buf[8:])
+	s.BrushSize = BrushSize(math.Float32frombits(endianess.Uint32(buf[12:])))
+	s.Unknown = 0
+	if v == V5 {
+		s.Unknown = math.Float32frombits(endianess.Uint32(buf[16:]))
+	}
+	nDots := endianess.Uint32(buf[size-4:])
+
+	dec.dots = dec.dots[:0]
+	for i := uint32(0); i < nDots; i++ {
+		d, err := dec.readDot()
+		if err != nil {
+			return err
+		}
+		dec.dots = append(dec.dots, d)
+	}
+	s.Dots = dec.dots
+
+	return nil
+}
+
+func (dec *Decoder) readDot() (Dot, error) {
+	var d Dot
+	buf := dec.scratch[:dotSize]
+	err := dec.readFull(buf)
+	if err != nil {
+		return d, fmt.Errorf("failed to read dot")
+	}
+
+	d.X = math.Float32frombits(endianess.Uint32(buf[0:]))
+	d.Y = math.Float32frombits(endianess.Uint32(buf[4:]))
+	d.Speed = math.Float32frombits(endianess.Uint32(buf[8:]))
+	d.Tilt = math.Float32frombits(endianess.Uint32(buf[12:]))
+	d.Width = math.Float32frombits(endianess.Uint32(buf[16:]))
+	d.Pressure = math.Float32frombits(endianess.Uint32(buf[20:]))
+
+	return d, nil
+}
+
+func (dec *Decoder) uint32() (uint32, error) {
+	buf := dec.scratch[:4]
+	err := dec.readFull(buf)
+	if err != nil {
+		return 0, err
+	}
+	return endianess.Uint32(buf), nil
+}
+
+// readFull fills buf and keeps track of the offset.
+func (dec *Decoder) readFull(buf []byte) error {
+	n, err := io.ReadFull(dec.r, buf)
+	dec.offset += int64(n)
+	return err
+}
+
+func prealloc(n uint32) int {
+	if n > maxPrealloc {
+		return maxPrealloc
+	}
+	return int(n)
+}
@@ -0,0 +1,202 @@
+package lines
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+func TestDecode(t *testing.T) {
+	for _, v := range []Version{V3, V5} {
+		d := sampleDrawing(v, 3, 20, 10)
+		data, err := d.MarshalBinary()
+		if err != nil {
+			t.Fatal(err)
+		}
+		expected, err := ReadDrawing(bytes.NewReader(data))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		x, err := NewDecoder(bytes.NewReader(data)).Decode()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if x.Version != v {
+			t.Errorf("wrong version number")
+		}
+		if len(x.Layers) != len(d.Layers) {
+			t.Fatalf("wrong layer count (%v != %v)", len(x.Layers), len(d.Layers))
+		}
+		for i, l := range x.Layers {
+			if len(l.Strokes) != len(d.Layers[i].Strokes) {
+				t.Fatalf("wrong stroke count (%v != %v)", len(l.Strokes), len(d.Layers[i].Strokes))
+			}
+			for j, s := range l.Strokes {
+				if !strokeEqual(s, expected.Layers[i].Strokes[j]) {
+					t.Errorf("stroke %v/%v differs from ReadDrawing", i, j)
+				}
+				if !dotsEqual(s.Dots, d.Layers[i].Strokes[j].Dots) {
+					t.Errorf("dots mismatch for stroke %v/%v", i, j)
+				}
+			}
+		}
+	}
+}
+
+func TestVisit(t *testing.T) {
+	d := sampleDrawing(V5, 2, 5, 4)
+	data, err := d.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	count := 0
+	err = NewDecoder(bytes.NewReader(data)).Visit(func(layer int, s *Stroke) error {
+		expected := d.Layers[layer].Strokes[count%5]
+		if !strokeEqual(*s, expected) {
+			t.Errorf("stroke mismatch at %v/%v", layer, count%5)
+		}
+		count++
+		return nil
+	})
+	if err != nil {
+		t.Error(err)
+	}
+	if count != 10 {
+		t.Errorf("wrong number of visited strokes (%v != %v)", count, 10)
+	}
+
+	// errors from the callback stop decoding
+	stop := errors.New("stop")
+	count = 0
+	err = NewDecoder(bytes.NewReader(data)).Visit(func(layer int, s *Stroke) error {
+		count++
+		return stop
+	})
+	if err != stop {
+		t.Errorf("expected error from callback, got %v", err)
+	}
+	if count != 1 {
+		t.Errorf("decoding should stop after an error")
+	}
+}
+
+func TestDecodeTruncated(t *testing.T) {
+	d := sampleDrawing(V5, 1, 2, 2)
+	data, err := d.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = NewDecoder(bytes.NewReader(data[:len(data)-3])).Decode()
+	if err == nil {
+		t.Errorf("truncated data should not be accepted")
+	}
+
+	_, err = NewDecoder(bytes.NewReader(data[:10])).Decode()
+	if err == nil {
+		t.Errorf("truncated header should not be accepted")
+	}
+}
+
+func BenchmarkReadDrawing(b *testing.B) {
+	data := benchmarkData(b)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		_, err := ReadDrawing(bytes.NewReader(data))
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkDecode(b *testing.B) {
+	data := benchmarkData(b)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		_, err := NewDecoder(bytes.NewReader(data)).Decode()
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkVisit(b *testing.B) {
+	data := benchmarkData(b)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		err := NewDecoder(bytes.NewReader(data)).Visit(func(layer int, s *Stroke) error {
+			return nil
+		})
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// benchmarkData creates a large sketch page.
+func benchmarkData(b *testing.B) []byte {
+	d := sampleDrawing(V5, 2, 1000, 200)
+	data, err := d.MarshalBinary()
+	if err != nil {
+		b.Fatal(err)
+	}
+	return data
+}
+
+// sampleDrawing creates a drawing with the given number of layers, strokes and dots.
+func sampleDrawing(v Version, layers, strokes, dots int) *Drawing {
+	d := &Drawing{Version: v}
+	for i := 0; i < layers; i++ {
+		var l Layer
+		for j := 0; j < strokes; j++ {
+			s := Stroke{
+				BrushType:  BallpointV5,
+				BrushColor: Black,
+				BrushSize:  Medium,
+			}
+			if v == V3 {
+				s.BrushType = Ballpoint
+			}
+			for k := 0; k < dots; k++ {
+				s.Dots = append(s.Dots, Dot{
+					X:        float32(i*100 + k),
+					Y:        float32(j),
+					Speed:    0.5,
+					Tilt:     0.3,
+					Width:    2.5,
+					Pressure: 0.8,
+				})
+			}
+			l.Strokes = append(l.Strokes, s)
+		}
+		d.Layers = append(d.Layers, l)
+	}
+	return d
+}
+
+func strokeEqual(a, b Stroke) bool {
+	return a.BrushType == b.BrushType &&
+		a.BrushColor == b.BrushColor &&
+		a.Padding == b.Padding &&
+		a.BrushSize == b.BrushSize &&
+		a.Unknown == b.Unknown &&
+		dotsEqual(a.Dots, b.Dots)
+}
+
+func dotsEqual(a, b []Dot) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
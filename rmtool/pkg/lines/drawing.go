@@ -1,9 +1,14 @@
 package lines
 
+import (
+	"fmt"
+)
+
 // Header starting a .rm binary file. This can help recognizing a .rm file.
 const (
 	headerV3  = "reMarkable .lines file, version=3          "
 	headerV5  = "reMarkable .lines file, version=5          "
+	headerV6  = "reMarkable .lines file, version=6          "
 	headerLen = 43
 )
 
@@ -13,6 +18,7 @@ type Version int
 const (
 	V3 Version = iota
 	V5
+	V6
 )
 
 // BrushColor defines the color of the brush (black, gray, white).
@@ -48,6 +54,31 @@ const (
 	CalligraphyV5      BrushType = 21
 )
 
+// Brush types that differ between v3 and v5.
+// Eraser and EraseArea are the same in both versions.
+var (
+	brushesV3toV5 = map[BrushType]BrushType{
+		PaintBrush:       PaintBrushV5,
+		Pencil:           PencilV5,
+		Ballpoint:        BallpointV5,
+		Marker:           MarkerV5,
+		Fineliner:        FinelinerV5,
+		Highlighter:      HighlighterV5,
+		MechanicalPencil: MechanicalPencilV5,
+	}
+	brushesV5toV3 = map[BrushType]BrushType{
+		PaintBrushV5:       PaintBrush,
+		PencilV5:           Pencil,
+		BallpointV5:        Ballpoint,
+		MarkerV5:           Marker,
+		FinelinerV5:        Fineliner,
+		HighlighterV5:      Highlighter,
+		MechanicalPencilV5: MechanicalPencil,
+		// no calligraphy pen in v3
+		CalligraphyV5: PaintBrush,
+	}
+)
+
 // BrushSize represents the base brush sizes.
 type BrushSize float32
 
@@ -70,6 +101,8 @@ const (
 type Drawing struct {
 	Version Version
 	Layers  []Layer
+	// Text is the typed text on the page, or nil if there is none.
+	Text *Text
 }
 
 // NewDrawing creates an empty drawing.
@@ -90,11 +123,61 @@ func (d *Drawing) NumLayers() int {
 
 // AddLayer adds a new layer with the given name.
 func (d *Drawing) AddLayer(name string) {
-	d.Layers = append(d.Layers, Layer{})
+	d.Layers = append(d.Layers, Layer{Name: name})
+}
+
+// Layer returns the first layer with the given name, or nil.
+func (d *Drawing) Layer(name string) *Layer {
+	for i := range d.Layers {
+		if d.Layers[i].Name == name {
+			return &d.Layers[i]
+		}
+	}
+	return nil
+}
+
+// ConvertTo changes the version of this drawing to v.
+//
+// Brush types are remapped between the v3 and v5 tables.
+// Brushes that do not exist in v3 are replaced by the closest match.
+//
+// v6 drawings can be read but not written,
+// so conversion to v6 is not supported.
+func (d *Drawing) ConvertTo(v Version) error {
+	var table map[BrushType]BrushType
+	switch v {
+	case V3:
+		table = brushesV5toV3
+	case V5:
+		table = brushesV3toV5
+	case V6:
+		return fmt.Errorf("converting to version %v is not supported", v)
+	default:
+		return fmt.Errorf("invalid version %v", v)
+	}
+
+	for i := range d.Layers {
+		for j := range d.Layers[i].Strokes {
+			s := &d.Layers[i].Strokes[j]
+			if bt, ok := table[s.BrushType]; ok {
+				s.BrushType = bt
+			}
+		}
+	}
+	d.Version = v
+
+	return nil
 }
 
 // Layer is one layer in a drawing.
 type Layer struct {
+	// Name is the display name of the layer.
+	//
+	// The v3 and v5 formats do not contain names; they are stored in the
+	// page metadata instead.
+	Name string
+	// Hidden is set if the layer is not shown on the tablet.
+	Hidden  bool
 	Strokes []Stroke
 }
 
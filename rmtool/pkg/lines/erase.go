@@ -0,0 +1,246 @@
+package lines
+
+// defaultEraserWidth is used for eraser dots that do not record a width.
+const defaultEraserWidth = 10
+
+// Flatten returns a copy of the drawing with the eraser strokes applied.
+//
+// The reMarkable records eraser strokes, but keeps the erased ink.
+// Flatten removes the parts of strokes that were erased
+// and splits strokes where an eraser crossed them.
+// The result contains no eraser strokes.
+func (d *Drawing) Flatten() *Drawing {
+	res := &Drawing{
+		Version: d.Version,
+		Layers:  make([]Layer, len(d.Layers)),
+		Text:    d.Text,
+	}
+	for i := range d.Layers {
+		res.Layers[i] = d.Layers[i].Flatten()
+	}
+	return res
+}
+
+// Flatten returns a copy of the layer with the eraser strokes applied.
+//
+// Erasers affect only those strokes on the same layer
+// which were drawn before the eraser.
+// See Drawing.Flatten.
+func (l *Layer) Flatten() Layer {
+	res, _ := l.FlattenSources()
+	return res
+}
+
+// FlattenSources works like Flatten and additionally returns,
+// for each stroke in the result, the index of the stroke in l
+// that it was cut from.
+func (l *Layer) FlattenSources() (Layer, []int) {
+	res := Layer{Name: l.Name, Hidden: l.Hidden, Strokes: make([]Stroke, 0, len(l.Strokes))}
+	src := make([]int, 0, len(l.Strokes))
+	for i := range l.Strokes {
+		s := &l.Strokes[i]
+		switch s.BrushType {
+		case Eraser:
+			res.Strokes, src = eraseStrokes(res.Strokes, src, newPathEraser(s))
+		case EraseArea:
+			res.Strokes, src = eraseStrokes(res.Strokes, src, newAreaEraser(s))
+		default:
+			c := *s
+			c.Dots = append([]Dot(nil), s.Dots...)
+			res.Strokes = append(res.Strokes, c)
+			src = append(src, i)
+		}
+	}
+	return res, src
+}
+
+// eraser decides which parts of a stroke are erased.
+type eraser interface {
+	// bounds is the area that is affected by the eraser.
+	bounds() Rect
+	// erasesDot tells if the given dot is erased.
+	erasesDot(d Dot) bool
+	// erasesSegment tells if the connection between two remaining dots is erased.
+	erasesSegment(a, b Dot) bool
+}
+
+// eraseStrokes applies the eraser to the given strokes.
+// src holds the source index for each stroke and is updated accordingly.
+func eraseStrokes(strokes []Stroke, src []int, e eraser) ([]Stroke, []int) {
+	area := e.bounds()
+	res := make([]Stroke, 0, len(strokes))
+	resSrc := make([]int, 0, len(src))
+	for i, s := range strokes {
+		if !s.Bounds().Overlaps(area) {
+			res = append(res, s)
+			resSrc = append(resSrc, src[i])
+			continue
+		}
+		for _, part := range splitStroke(s, e) {
+			res = append(res, part)
+			resSrc = append(resSrc, src[i])
+		}
+	}
+	return res, resSrc
+}
+
+// splitStroke removes the erased dots from s.
+// The remaining parts are returned as separate strokes.
+func splitStroke(s Stroke, e eraser) []Stroke {
+	var parts []Stroke
+	var current []Dot
+	flush := func() {
+		if len(current) > 0 {
+			p := s
+			p.Dots = current
+			parts = append(parts, p)
+		}
+		current = nil
+	}
+
+	for _, d := range s.Dots {
+		if e.erasesDot(d) {
+			flush()
+			continue
+		}
+		if len(current) > 0 && e.erasesSegment(current[len(current)-1], d) {
+			flush()
+		}
+		current = append(current, d)
+	}
+	flush()
+
+	return parts
+}
+
+// pathEraser erases everything within its width around the eraser path.
+type pathEraser struct {
+	dots []Dot
+	area Rect
+}
+
+func newPathEraser(s *Stroke) *pathEraser {
+	e := &pathEraser{dots: s.Dots}
+	e.area = s.Bounds()
+	if !e.area.Empty() {
+		r := float32(e.maxRadius())
+		e.area.Min.X -= r
+		e.area.Min.Y -= r
+		e.area.Max.X += r
+		e.area.Max.Y += r
+	}
+	return e
+}
+
+func (e *pathEraser) bounds() Rect {
+	return e.area
+}
+
+func (e *pathEraser) erasesDot(d Dot) bool {
+	if len(e.dots) == 1 {
+		return d.Distance(e.dots[0]) <= radius(e.dots[0])
+	}
+	for i := 1; i < len(e.dots); i++ {
+		a, b := e.dots[i-1], e.dots[i]
+		r := (radius(a) + radius(b)) / 2
+		if segmentDistance(d, a, b) <= r {
+			return true
+		}
+	}
+	return false
+}
+
+func (e *pathEraser) erasesSegment(a, b Dot) bool {
+	for i := 1; i < len(e.dots); i++ {
+		if segmentsCross(a.Point(), b.Point(), e.dots[i-1].Point(), e.dots[i].Point()) {
+			return true
+		}
+	}
+	return false
+}
+
+func (e *pathEraser) maxRadius() float64 {
+	r := 0.0
+	for _, d := range e.dots {
+		if rd := radius(d); rd > r {
+			r = rd
+		}
+	}
+	return r
+}
+
+// radius returns the radius of the eraser at the given dot.
+func radius(d Dot) float64 {
+	if d.Width <= 0 {
+		return defaultEraserWidth / 2
+	}
+	return float64(d.Width) / 2
+}
+
+// areaEraser erases everything within the polygon formed by its path.
+type areaEraser struct {
+	polygon []Point
+	area    Rect
+}
+
+func newAreaEraser(s *Stroke) *areaEraser {
+	e := &areaEraser{area: s.Bounds()}
+	for _, d := range s.Dots {
+		e.polygon = append(e.polygon, d.Point())
+	}
+	return e
+}
+
+func (e *areaEraser) bounds() Rect {
+	return e.area
+}
+
+// erasesDot uses the even-odd rule to check if d is inside the polygon.
+func (e *areaEraser) erasesDot(d Dot) bool {
+	if len(e.polygon) < 3 {
+		return false
+	}
+
+	inside := false
+	j := len(e.polygon) - 1
+	for i, p := range e.polygon {
+		q := e.polygon[j]
+		if (p.Y > d.Y) != (q.Y > d.Y) &&
+			d.X < (q.X-p.X)*(d.Y-p.Y)/(q.Y-p.Y)+p.X {
+			inside = !inside
+		}
+		j = i
+	}
+	return inside
+}
+
+// erasesSegment checks if the segment passes through the polygon.
+func (e *areaEraser) erasesSegment(a, b Dot) bool {
+	if len(e.polygon) < 3 {
+		return false
+	}
+
+	j := len(e.polygon) - 1
+	for i, p := range e.polygon {
+		if segmentsCross(a.Point(), b.Point(), e.polygon[j], p) {
+			return true
+		}
+		j = i
+	}
+	return false
+}
+
+// segmentsCross tells if the line segments a-b and c-d intersect.
+func segmentsCross(a, b, c, d Point) bool {
+	d1 := orientation(c, d, a)
+	d2 := orientation(c, d, b)
+	d3 := orientation(a, b, c)
+	d4 := orientation(a, b, d)
+	return ((d1 > 0 && d2 < 0) || (d1 < 0 && d2 > 0)) &&
+		((d3 > 0 && d4 < 0) || (d3 < 0 && d4 > 0))
+}
+
+// orientation is the cross product of (b-a) and (c-a).
+func orientation(a, b, c Point) float64 {
+	return float64(b.X-a.X)*float64(c.Y-a.Y) - float64(b.Y-a.Y)*float64(c.X-a.X)
+}
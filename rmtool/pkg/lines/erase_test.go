@@ -0,0 +1,104 @@
+package lines
+
+import (
+	"testing"
+)
+
+func TestFlatten(t *testing.T) {
+	// horizontal line, 11 dots
+	ink := geometryStroke(0, 10, 1, 10, 2, 10, 3, 10, 4, 10, 5, 10, 6, 10, 7, 10, 8, 10, 9, 10, 10, 10)
+	// vertical eraser through x=5
+	eraser := geometryStroke(5, 0, 5, 20)
+	eraser.BrushType = Eraser
+	for i := range eraser.Dots {
+		eraser.Dots[i].Width = 2
+	}
+	// drawn after the eraser, must not be affected
+	later := geometryStroke(5, 5, 5, 15)
+
+	d := &Drawing{
+		Version: V5,
+		Layers:  []Layer{{Strokes: []Stroke{ink, eraser, later}}},
+	}
+	res := d.Flatten()
+
+	s := res.Layers[0].Strokes
+	if len(s) != 3 {
+		t.Fatalf("wrong stroke count (%v != %v)", len(s), 3)
+	}
+	// dots 4, 5 and 6 are within the eraser width
+	if len(s[0].Dots) != 4 || s[0].Dots[3].X != 3 {
+		t.Errorf("wrong left part %v", s[0].Dots)
+	}
+	if len(s[1].Dots) != 4 || s[1].Dots[0].X != 7 {
+		t.Errorf("wrong right part %v", s[1].Dots)
+	}
+	if !dotsEqual(s[2].Dots, later.Dots) {
+		t.Errorf("later stroke was modified")
+	}
+
+	// the original is unchanged
+	if len(d.Layers[0].Strokes) != 3 || len(d.Layers[0].Strokes[0].Dots) != 11 {
+		t.Errorf("original drawing was modified")
+	}
+}
+
+func TestFlattenCrossing(t *testing.T) {
+	// the eraser crosses the line between two dots
+	ink := geometryStroke(0, 10, 100, 10)
+	eraser := geometryStroke(50, 0, 50, 20)
+	eraser.BrushType = Eraser
+
+	l := Layer{Strokes: []Stroke{ink, eraser}}
+	res := l.Flatten()
+	if len(res.Strokes) != 2 {
+		t.Fatalf("wrong stroke count (%v != %v)", len(res.Strokes), 2)
+	}
+	if len(res.Strokes[0].Dots) != 1 || len(res.Strokes[1].Dots) != 1 {
+		t.Errorf("stroke not split: %v", res.Strokes)
+	}
+}
+
+func TestFlattenSources(t *testing.T) {
+	a := geometryStroke(0, 10, 100, 10)
+	b := geometryStroke(0, 50, 10, 50)
+	eraser := geometryStroke(50, 0, 50, 20)
+	eraser.BrushType = Eraser
+	c := geometryStroke(0, 80, 10, 80)
+
+	l := Layer{Strokes: []Stroke{a, b, eraser, c}}
+	res, src := l.FlattenSources()
+	if len(res.Strokes) != len(src) {
+		t.Fatalf("sources do not match strokes (%v != %v)", len(src), len(res.Strokes))
+	}
+
+	want := []int{0, 0, 1, 3}
+	for i := range want {
+		if src[i] != want[i] {
+			t.Errorf("wrong sources %v, want %v", src, want)
+			break
+		}
+	}
+}
+
+func TestFlattenArea(t *testing.T) {
+	ink := geometryStroke(0, 0, 10, 10, 20, 20, 30, 30)
+	area := geometryStroke(5, 5, 25, 5, 25, 25, 5, 25)
+	area.BrushType = EraseArea
+	other := geometryStroke(100, 100, 110, 110)
+
+	l := Layer{Strokes: []Stroke{ink, other, area}}
+	res := l.Flatten()
+	if len(res.Strokes) != 3 {
+		t.Fatalf("wrong stroke count (%v != %v)", len(res.Strokes), 3)
+	}
+	if len(res.Strokes[0].Dots) != 1 || res.Strokes[0].Dots[0].X != 0 {
+		t.Errorf("wrong first part %v", res.Strokes[0].Dots)
+	}
+	if len(res.Strokes[1].Dots) != 1 || res.Strokes[1].Dots[0].X != 30 {
+		t.Errorf("wrong second part %v", res.Strokes[1].Dots)
+	}
+	if !dotsEqual(res.Strokes[2].Dots, other.Dots) {
+		t.Errorf("unrelated stroke was modified")
+	}
+}
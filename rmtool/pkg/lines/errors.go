@@ -0,0 +1,79 @@
+package lines
+
+import (
+	"errors"
+	"fmt"
+	"io"
+)
+
+// ReadOptions control how drawings are decoded.
+type ReadOptions struct {
+	// Lenient mode recovers as much as possible from corrupt or truncated data.
+	//
+	// The drawing keeps all complete layers and strokes up to the point where
+	// the data went bad. For v6, blocks that cannot be decoded are skipped.
+	// Decoding still reports a *DecodeError in that case.
+	Lenient bool
+}
+
+// DecodeError describes where the data for a drawing went bad.
+type DecodeError struct {
+	// Offset is the byte offset (from the start of the file)
+	// at which the error was detected.
+	Offset int64
+	// Layer is the index of the affected layer, -1 if unknown.
+	Layer int
+	// Stroke is the index of the affected stroke within the layer,
+	// -1 if unknown.
+	Stroke int
+	// Err is the underlying error.
+	Err error
+}
+
+func (e *DecodeError) Error() string {
+	return fmt.Sprintf("decode error at offset %v (layer %v, stroke %v): %v", e.Offset, e.Layer, e.Stroke, e.Err)
+}
+
+// Unwrap returns the underlying error.
+func (e *DecodeError) Unwrap() error {
+	return e.Err
+}
+
+// IsDecodeError checks if the given error is or wraps a *DecodeError.
+func IsDecodeError(err error) bool {
+	var de *DecodeError
+	return errors.As(err, &de)
+}
+
+// trim drops the incomplete parts of the drawing.
+//
+// The given layer and stroke are the ones that could not be read;
+// the stroke is -1 if the layer could not be read at all.
+func (d *Drawing) trim(layer, stroke int) {
+	switch {
+	case layer < 0:
+		d.Layers = d.Layers[:0]
+	case stroke < 0:
+		d.Layers = d.Layers[:layer]
+	default:
+		d.Layers = d.Layers[:layer+1]
+		d.Layers[layer].Strokes = d.Layers[layer].Strokes[:stroke]
+	}
+
+	// A single empty layer is the minimum requirement for a valid drawing
+	if len(d.Layers) == 0 {
+		d.Layers = append(d.Layers, Layer{})
+	}
+}
+
+// countingReader keeps track of the number of bytes read.
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
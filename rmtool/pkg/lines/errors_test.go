@@ -0,0 +1,119 @@
+package lines
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func TestReadLenient(t *testing.T) {
+	// 2 layers with 3 strokes of 4 dots; each stroke is 24 + 4*24 bytes.
+	// The second stroke in the second layer starts at offset 535.
+	d := sampleDrawing(V5, 2, 3, 4)
+	data, err := d.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	data = data[:600]
+
+	read := map[string]func(o ReadOptions) (*Drawing, error){
+		"ReadDrawing": func(o ReadOptions) (*Drawing, error) {
+			return ReadDrawingOptions(bytes.NewReader(data), o)
+		},
+		"Decoder": func(o ReadOptions) (*Drawing, error) {
+			return NewDecoderOptions(bytes.NewReader(data), o).Decode()
+		},
+	}
+
+	for name, f := range read {
+		_, err = f(ReadOptions{})
+		if !IsDecodeError(err) {
+			t.Errorf("%v: expected a DecodeError in strict mode, got %v", name, err)
+		}
+		if !IsDecodeError(fmt.Errorf("wrapped: %w", err)) {
+			t.Errorf("%v: expected a wrapped DecodeError to be detected", name)
+		}
+
+		r, err := f(ReadOptions{Lenient: true})
+		var de *DecodeError
+		if !errors.As(err, &de) {
+			t.Fatalf("%v: expected a DecodeError in lenient mode, got %v", name, err)
+		}
+		if de.Offset != 600 || de.Layer != 1 || de.Stroke != 1 {
+			t.Errorf("%v: wrong error location: %v", name, de)
+		}
+
+		if r.NumLayers() != 2 {
+			t.Fatalf("%v: wrong layer count (%v != %v)", name, r.NumLayers(), 2)
+		}
+		if len(r.Layers[0].Strokes) != 3 || len(r.Layers[1].Strokes) != 1 {
+			t.Fatalf("%v: wrong stroke count (%v, %v)", name, len(r.Layers[0].Strokes), len(r.Layers[1].Strokes))
+		}
+		if !strokeEqual(r.Layers[1].Strokes[0], d.Layers[1].Strokes[0]) {
+			t.Errorf("%v: recovered stroke differs", name)
+		}
+		if err := r.Validate(); err != nil {
+			t.Errorf("%v: recovered drawing is invalid: %v", name, err)
+		}
+	}
+}
+
+func TestReadLenientGarbage(t *testing.T) {
+	d := sampleDrawing(V5, 1, 2, 1)
+	data, err := d.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// overwrite the brush type of the second stroke
+	data[43+4+4+48] = 0xff
+
+	r, err := ReadDrawingOptions(bytes.NewReader(data), ReadOptions{Lenient: true})
+	if !IsDecodeError(err) {
+		t.Fatalf("expected a DecodeError, got %v", err)
+	}
+	if len(r.Layers[0].Strokes) != 1 {
+		t.Errorf("wrong stroke count (%v != %v)", len(r.Layers[0].Strokes), 1)
+	}
+
+	// strict mode does not check the content
+	_, err = ReadDrawing(bytes.NewReader(data))
+	if err != nil {
+		t.Errorf("unexpected error in strict mode: %v", err)
+	}
+}
+
+func TestReadV6Lenient(t *testing.T) {
+	layer := crdtID{1, 10}
+	f := &v6Fixture{}
+	f.groupItem(rootID, crdtID{1, 11}, endMarker, endMarker, layer)
+	f.lineItem(layer, crdtID{1, 30}, endMarker, endMarker, 2, fixtureLine(BallpointV5, Black, 0))
+	// a line item that cannot be decoded
+	f.block(blockLineItem, 2, []byte{0xff, 0xff})
+	f.lineItem(layer, crdtID{1, 31}, crdtID{1, 30}, endMarker, 2, fixtureLine(PencilV5, Black, 100))
+
+	_, err := ReadDrawing(f.reader())
+	if !IsDecodeError(err) {
+		t.Errorf("expected a DecodeError in strict mode, got %v", err)
+	}
+
+	d, err := ReadDrawingOptions(f.reader(), ReadOptions{Lenient: true})
+	var de *DecodeError
+	if !errors.As(err, &de) {
+		t.Fatalf("expected a DecodeError in lenient mode, got %v", err)
+	}
+	if de.Offset <= int64(headerLen) {
+		t.Errorf("wrong error offset %v", de.Offset)
+	}
+
+	if d.NumLayers() != 1 {
+		t.Fatalf("wrong layer count (%v != %v)", d.NumLayers(), 1)
+	}
+	s := d.Layers[0].Strokes
+	if len(s) != 2 {
+		t.Fatalf("wrong stroke count (%v != %v)", len(s), 2)
+	}
+	if s[0].BrushType != BallpointV5 || s[1].BrushType != PencilV5 {
+		t.Errorf("strokes in wrong order: %v, %v", s[0].BrushType, s[1].BrushType)
+	}
+}
@@ -0,0 +1,449 @@
+package lines
+
+import (
+	"math"
+
+	"github.com/akeil/rmtool/internal/imaging"
+)
+
+// Point is a position on the page.
+type Point struct {
+	X float32
+	Y float32
+}
+
+// Rect is an axis-aligned rectangle on the page.
+//
+// Unlike image.Rectangle, Min and Max are both inclusive,
+// so the bounds of a single dot or a straight line are not empty.
+type Rect struct {
+	Min Point
+	Max Point
+}
+
+// emptyRect is the neutral element for Union.
+var emptyRect = Rect{
+	Min: Point{float32(math.Inf(1)), float32(math.Inf(1))},
+	Max: Point{float32(math.Inf(-1)), float32(math.Inf(-1))},
+}
+
+// Empty tells if the rectangle contains no points.
+func (r Rect) Empty() bool {
+	return r.Min.X > r.Max.X || r.Min.Y > r.Max.Y
+}
+
+// Dx returns the width of the rectangle.
+func (r Rect) Dx() float32 {
+	if r.Empty() {
+		return 0
+	}
+	return r.Max.X - r.Min.X
+}
+
+// Dy returns the height of the rectangle.
+func (r Rect) Dy() float32 {
+	if r.Empty() {
+		return 0
+	}
+	return r.Max.Y - r.Min.Y
+}
+
+// Contains tells if the given point is inside the rectangle.
+func (r Rect) Contains(p Point) bool {
+	return p.X >= r.Min.X && p.X <= r.Max.X && p.Y >= r.Min.Y && p.Y <= r.Max.Y
+}
+
+// Overlaps tells if the two rectangles have at least one point in common.
+func (r Rect) Overlaps(o Rect) bool {
+	if r.Empty() || o.Empty() {
+		return false
+	}
+	return r.Min.X <= o.Max.X && o.Min.X <= r.Max.X && r.Min.Y <= o.Max.Y && o.Min.Y <= r.Max.Y
+}
+
+// Union returns the smallest rectangle that contains both rectangles.
+func (r Rect) Union(o Rect) Rect {
+	if r.Empty() {
+		return o
+	}
+	if o.Empty() {
+		return r
+	}
+	return Rect{
+		Min: Point{min32(r.Min.X, o.Min.X), min32(r.Min.Y, o.Min.Y)},
+		Max: Point{max32(r.Max.X, o.Max.X), max32(r.Max.Y, o.Max.Y)},
+	}
+}
+
+// Point returns the position of the dot.
+func (d Dot) Point() Point {
+	return Point{d.X, d.Y}
+}
+
+// Distance returns the euclidean distance between two dots.
+func (d Dot) Distance(o Dot) float64 {
+	return math.Hypot(float64(o.X-d.X), float64(o.Y-d.Y))
+}
+
+// Bounds returns the bounding box of all dots in the stroke.
+// The result is empty if the stroke has no dots.
+func (s *Stroke) Bounds() Rect {
+	r := emptyRect
+	for _, d := range s.Dots {
+		r.Min.X = min32(r.Min.X, d.X)
+		r.Min.Y = min32(r.Min.Y, d.Y)
+		r.Max.X = max32(r.Max.X, d.X)
+		r.Max.Y = max32(r.Max.Y, d.Y)
+	}
+	return r
+}
+
+// Length returns the length of the path along all dots.
+func (s *Stroke) Length() float64 {
+	var l float64
+	for i := 1; i < len(s.Dots); i++ {
+		l += s.Dots[i-1].Distance(s.Dots[i])
+	}
+	return l
+}
+
+// Intersects tells if any part of the stroke's path lies within r.
+func (s *Stroke) Intersects(r Rect) bool {
+	if !s.Bounds().Overlaps(r) {
+		return false
+	}
+	if len(s.Dots) == 1 {
+		return r.Contains(s.Dots[0].Point())
+	}
+	for i := 1; i < len(s.Dots); i++ {
+		if segmentIntersects(s.Dots[i-1].Point(), s.Dots[i].Point(), r) {
+			return true
+		}
+	}
+	return false
+}
+
+// Simplify returns a copy of the stroke with fewer dots,
+// using the Ramer–Douglas–Peucker algorithm.
+//
+// No dot that is removed is farther away than tolerance
+// from the simplified path. The first and last dot are always kept.
+func (s *Stroke) Simplify(tolerance float64) Stroke {
+	res := *s
+	if len(s.Dots) < 3 {
+		res.Dots = append([]Dot(nil), s.Dots...)
+		return res
+	}
+
+	keep := make([]bool, len(s.Dots))
+	keep[0] = true
+	keep[len(s.Dots)-1] = true
+	simplify(s.Dots, 0, len(s.Dots)-1, tolerance, keep)
+
+	res.Dots = make([]Dot, 0, len(s.Dots))
+	for i, d := range s.Dots {
+		if keep[i] {
+			res.Dots = append(res.Dots, d)
+		}
+	}
+	return res
+}
+
+func simplify(dots []Dot, first, last int, tolerance float64, keep []bool) {
+	if last-first < 2 {
+		return
+	}
+
+	idx := first
+	maxDist := 0.0
+	for i := first + 1; i < last; i++ {
+		dist := segmentDistance(dots[i], dots[first], dots[last])
+		if dist > maxDist {
+			idx = i
+			maxDist = dist
+		}
+	}
+
+	if maxDist > tolerance {
+		keep[idx] = true
+		simplify(dots, first, idx, tolerance, keep)
+		simplify(dots, idx, last, tolerance, keep)
+	}
+}
+
+// maxResampleDots limits the number of dots created by Resample.
+const maxResampleDots = 1 << 16
+
+// Resample returns a copy of the stroke with dots placed at equal distances
+// along the path.
+//
+// All attributes of the new dots are interpolated from their neighbours.
+// The first and last dot are always kept.
+// The spacing is increased if the stroke would get more than
+// maxResampleDots dots.
+// If the spacing or the length of the stroke is not a positive number,
+// e.g. because of damaged dots, the stroke is copied unchanged.
+func (s *Stroke) Resample(spacing float64) Stroke {
+	res := *s
+	length := s.Length()
+	if len(s.Dots) < 2 || !(spacing > 0) || math.IsInf(spacing, 0) ||
+		!(length > 0) || math.IsInf(length, 0) {
+		res.Dots = append([]Dot(nil), s.Dots...)
+		return res
+	}
+	if length/spacing > maxResampleDots {
+		spacing = length / maxResampleDots
+	}
+
+	res.Dots = make([]Dot, 0, int(length/spacing)+2)
+	res.Dots = append(res.Dots, s.Dots[0])
+
+	// distance from the previous resampled dot
+	carry := 0.0
+	for i := 1; i < len(s.Dots); i++ {
+		a, b := s.Dots[i-1], s.Dots[i]
+		seg := a.Distance(b)
+		pos := spacing - carry
+		for ; pos <= seg; pos += spacing {
+			res.Dots = append(res.Dots, interpolate(a, b, pos/seg))
+		}
+		carry = seg - (pos - spacing)
+	}
+
+	last := s.Dots[len(s.Dots)-1]
+	if res.Dots[len(res.Dots)-1] != last {
+		res.Dots = append(res.Dots, last)
+	}
+	return res
+}
+
+// Translate moves all dots by dx, dy.
+func (s *Stroke) Translate(dx, dy float64) {
+	s.transform(imaging.Translation(dx, dy))
+}
+
+// Scale scales all dot positions by sx, sy, relative to the origin.
+// Brush widths are not changed.
+func (s *Stroke) Scale(sx, sy float64) {
+	s.transform(imaging.Scaling(sx, sy))
+}
+
+// Rotate rotates all dots by angle (radians) around the given center.
+// See imaging.Rotation for the direction.
+func (s *Stroke) Rotate(angle float64, center Point) {
+	s.transform(rotationAround(angle, center))
+}
+
+func (s *Stroke) transform(m []float64) {
+	for i := range s.Dots {
+		d := &s.Dots[i]
+		x, y := imaging.Transform(m, float64(d.X), float64(d.Y))
+		d.X = float32(x)
+		d.Y = float32(y)
+	}
+}
+
+// Bounds returns the bounding box of all strokes in the layer.
+func (l *Layer) Bounds() Rect {
+	r := emptyRect
+	for i := range l.Strokes {
+		r = r.Union(l.Strokes[i].Bounds())
+	}
+	return r
+}
+
+// Length returns the combined length of all strokes in the layer.
+func (l *Layer) Length() float64 {
+	var n float64
+	for i := range l.Strokes {
+		n += l.Strokes[i].Length()
+	}
+	return n
+}
+
+// Intersects tells if any stroke in the layer lies within r.
+func (l *Layer) Intersects(r Rect) bool {
+	for i := range l.Strokes {
+		if l.Strokes[i].Intersects(r) {
+			return true
+		}
+	}
+	return false
+}
+
+// Simplify returns a copy of the layer with all strokes simplified.
+// See Stroke.Simplify.
+func (l *Layer) Simplify(tolerance float64) Layer {
+	res := Layer{Name: l.Name, Hidden: l.Hidden, Strokes: make([]Stroke, len(l.Strokes))}
+	for i := range l.Strokes {
+		res.Strokes[i] = l.Strokes[i].Simplify(tolerance)
+	}
+	return res
+}
+
+// Resample returns a copy of the layer with all strokes resampled.
+// See Stroke.Resample.
+func (l *Layer) Resample(spacing float64) Layer {
+	res := Layer{Name: l.Name, Hidden: l.Hidden, Strokes: make([]Stroke, len(l.Strokes))}
+	for i := range l.Strokes {
+		res.Strokes[i] = l.Strokes[i].Resample(spacing)
+	}
+	return res
+}
+
+// Translate moves all strokes in the layer by dx, dy.
+func (l *Layer) Translate(dx, dy float64) {
+	l.transform(imaging.Translation(dx, dy))
+}
+
+// Scale scales all strokes in the layer by sx, sy, relative to the origin.
+func (l *Layer) Scale(sx, sy float64) {
+	l.transform(imaging.Scaling(sx, sy))
+}
+
+// Rotate rotates all strokes in the layer by angle (radians) around the given center.
+func (l *Layer) Rotate(angle float64, center Point) {
+	l.transform(rotationAround(angle, center))
+}
+
+func (l *Layer) transform(m []float64) {
+	for i := range l.Strokes {
+		l.Strokes[i].transform(m)
+	}
+}
+
+// Bounds returns the bounding box of all strokes in the drawing.
+func (d *Drawing) Bounds() Rect {
+	r := emptyRect
+	for i := range d.Layers {
+		r = r.Union(d.Layers[i].Bounds())
+	}
+	return r
+}
+
+// Length returns the combined length of all strokes in the drawing.
+func (d *Drawing) Length() float64 {
+	var n float64
+	for i := range d.Layers {
+		n += d.Layers[i].Length()
+	}
+	return n
+}
+
+// Intersects tells if any stroke in the drawing lies within r.
+func (d *Drawing) Intersects(r Rect) bool {
+	for i := range d.Layers {
+		if d.Layers[i].Intersects(r) {
+			return true
+		}
+	}
+	return false
+}
+
+// Translate moves all strokes in the drawing by dx, dy.
+func (d *Drawing) Translate(dx, dy float64) {
+	d.transform(imaging.Translation(dx, dy))
+}
+
+// Scale scales all strokes in the drawing by sx, sy, relative to the origin.
+func (d *Drawing) Scale(sx, sy float64) {
+	d.transform(imaging.Scaling(sx, sy))
+}
+
+// Rotate rotates all strokes in the drawing by angle (radians) around the given center.
+func (d *Drawing) Rotate(angle float64, center Point) {
+	d.transform(rotationAround(angle, center))
+}
+
+func (d *Drawing) transform(m []float64) {
+	for i := range d.Layers {
+		d.Layers[i].transform(m)
+	}
+}
+
+// rotationAround creates a matrix that rotates around the given center:
+// Translate - Rotate - Translate
+func rotationAround(angle float64, c Point) []float64 {
+	cx, cy := float64(c.X), float64(c.Y)
+	m := imaging.Translation(-cx, -cy)
+	m = imaging.Multiply(imaging.Rotation(angle), m)
+	return imaging.Multiply(imaging.Translation(cx, cy), m)
+}
+
+// interpolate returns the dot at fraction t between a and b.
+func interpolate(a, b Dot, t float64) Dot {
+	f := func(x, y float32) float32 {
+		return x + (y-x)*float32(t)
+	}
+	return Dot{
+		X:        f(a.X, b.X),
+		Y:        f(a.Y, b.Y),
+		Speed:    f(a.Speed, b.Speed),
+		Tilt:     f(a.Tilt, b.Tilt),
+		Width:    f(a.Width, b.Width),
+		Pressure: f(a.Pressure, b.Pressure),
+	}
+}
+
+// segmentDistance returns the distance of p from the line segment a-b.
+func segmentDistance(p, a, b Dot) float64 {
+	dx := float64(b.X - a.X)
+	dy := float64(b.Y - a.Y)
+	lenSq := dx*dx + dy*dy
+	if lenSq == 0 {
+		return p.Distance(a)
+	}
+
+	t := (float64(p.X-a.X)*dx + float64(p.Y-a.Y)*dy) / lenSq
+	t = math.Max(0, math.Min(1, t))
+	x := float64(a.X) + t*dx
+	y := float64(a.Y) + t*dy
+	return math.Hypot(float64(p.X)-x, float64(p.Y)-y)
+}
+
+// segmentIntersects tells if the line segment a-b has a point within r,
+// using Liang-Barsky clipping.
+func segmentIntersects(a, b Point, r Rect) bool {
+	dx := float64(b.X - a.X)
+	dy := float64(b.Y - a.Y)
+	t0, t1 := 0.0, 1.0
+
+	clip := func(p, q float64) bool {
+		if p == 0 {
+			// parallel to this edge
+			return q >= 0
+		}
+		t := q / p
+		if p < 0 {
+			if t > t1 {
+				return false
+			}
+			t0 = math.Max(t0, t)
+		} else {
+			if t < t0 {
+				return false
+			}
+			t1 = math.Min(t1, t)
+		}
+		return true
+	}
+
+	return clip(-dx, float64(a.X-r.Min.X)) &&
+		clip(dx, float64(r.Max.X-a.X)) &&
+		clip(-dy, float64(a.Y-r.Min.Y)) &&
+		clip(dy, float64(r.Max.Y-a.Y))
+}
+
+func min32(a, b float32) float32 {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+func max32(a, b float32) float32 {
+	if a > b {
+		return a
+	}
+	return b
+}
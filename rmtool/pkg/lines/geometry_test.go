@@ -0,0 +1,183 @@
+package lines
+
+import (
+	"math"
+	"testing"
+)
+
+func TestBounds(t *testing.T) {
+	s := geometryStroke(0, 0, 10, 5, -2, 8)
+	r := s.Bounds()
+	if r.Min != (Point{-2, 0}) || r.Max != (Point{10, 8}) {
+		t.Errorf("wrong bounds %v", r)
+	}
+
+	empty := Stroke{}
+	if !empty.Bounds().Empty() {
+		t.Errorf("bounds of a stroke without dots should be empty")
+	}
+
+	// a single dot is not empty
+	dot := geometryStroke(3, 3)
+	if dot.Bounds().Empty() {
+		t.Errorf("bounds of a single dot should not be empty")
+	}
+
+	l := Layer{Strokes: []Stroke{s, empty, geometryStroke(20, 20)}}
+	r = l.Bounds()
+	if r.Min != (Point{-2, 0}) || r.Max != (Point{20, 20}) {
+		t.Errorf("wrong layer bounds %v", r)
+	}
+}
+
+func TestLength(t *testing.T) {
+	s := geometryStroke(0, 0, 3, 4, 3, 10)
+	if s.Length() != 11 {
+		t.Errorf("wrong length %v", s.Length())
+	}
+
+	d := &Drawing{Layers: []Layer{{Strokes: []Stroke{s, s}}}}
+	if d.Length() != 22 {
+		t.Errorf("wrong drawing length %v", d.Length())
+	}
+}
+
+func TestIntersects(t *testing.T) {
+	// a diagonal line that passes the corner of the rect
+	s := geometryStroke(0, 10, 10, 0)
+	cases := []struct {
+		r    Rect
+		want bool
+	}{
+		{Rect{Point{4, 4}, Point{6, 6}}, true},
+		// inside the bounding box, but not touched by the line
+		{Rect{Point{0, 0}, Point{2, 2}}, false},
+		{Rect{Point{8, 8}, Point{12, 12}}, false},
+		// contains the whole stroke
+		{Rect{Point{-1, -1}, Point{11, 11}}, true},
+		// touches the end point
+		{Rect{Point{10, -5}, Point{12, 0}}, true},
+		{emptyRect, false},
+	}
+
+	for i, c := range cases {
+		if s.Intersects(c.r) != c.want {
+			t.Errorf("case %v: expected %v for %v", i, c.want, c.r)
+		}
+	}
+
+	dot := geometryStroke(5, 5)
+	if !dot.Intersects(Rect{Point{5, 5}, Point{5, 5}}) {
+		t.Errorf("a dot should intersect a rect that contains it")
+	}
+}
+
+func TestSimplify(t *testing.T) {
+	// almost straight line with one distinct corner
+	s := geometryStroke(0, 0, 1, 0.1, 2, -0.1, 3, 0, 3, 5, 3.1, 10)
+	res := s.Simplify(0.5)
+
+	want := geometryStroke(0, 0, 3, 0, 3.1, 10)
+	if !dotsEqual(res.Dots, want.Dots) {
+		t.Errorf("wrong simplified dots %v", res.Dots)
+	}
+	if len(s.Dots) != 6 {
+		t.Errorf("original stroke should not be modified")
+	}
+
+	res = s.Simplify(0)
+	if len(res.Dots) != len(s.Dots) {
+		t.Errorf("zero tolerance should keep all dots")
+	}
+}
+
+func TestResample(t *testing.T) {
+	s := geometryStroke(0, 0, 10, 0, 10, 5)
+	s.Dots[1].Pressure = 1
+	res := s.Resample(2)
+
+	// 15 units long: 0, 2, ... 14 plus the end point
+	if len(res.Dots) != 9 {
+		t.Fatalf("wrong number of dots (%v != %v)", len(res.Dots), 9)
+	}
+	for i := 1; i < len(res.Dots)-1; i++ {
+		d := res.Dots[i-1].Distance(res.Dots[i])
+		if math.Abs(d-2) > 0.001 {
+			t.Errorf("wrong spacing %v between dot %v and %v", d, i-1, i)
+		}
+	}
+	if res.Dots[1].Pressure != 0.2 {
+		t.Errorf("pressure not interpolated: %v", res.Dots[1].Pressure)
+	}
+	if res.Dots[8] != s.Dots[2] {
+		t.Errorf("last dot should be kept")
+	}
+}
+
+func TestResampleInvalid(t *testing.T) {
+	inf := float32(math.Inf(1))
+	nan := float32(math.NaN())
+	for _, s := range []Stroke{
+		geometryStroke(0, 0, inf, 0, 10, 5),
+		geometryStroke(0, 0, nan, 0, 10, 5),
+		geometryStroke(5, 5, 5, 5),
+	} {
+		res := s.Resample(2)
+		if len(res.Dots) != len(s.Dots) {
+			t.Errorf("invalid stroke should be copied (%v != %v dots)", len(res.Dots), len(s.Dots))
+		}
+	}
+
+	s := geometryStroke(0, 0, 10, 0)
+	for _, spacing := range []float64{0, -1, math.NaN(), math.Inf(1)} {
+		res := s.Resample(spacing)
+		if len(res.Dots) != 2 {
+			t.Errorf("spacing %v should copy the stroke, got %v dots", spacing, len(res.Dots))
+		}
+	}
+
+	// a tiny spacing is limited
+	res := s.Resample(1e-300)
+	if len(res.Dots) > maxResampleDots+2 {
+		t.Errorf("too many dots for tiny spacing: %v", len(res.Dots))
+	}
+	if res.Dots[len(res.Dots)-1] != s.Dots[1] {
+		t.Errorf("last dot should be kept")
+	}
+}
+
+func TestTransform(t *testing.T) {
+	s := geometryStroke(1, 2)
+
+	s.Translate(2, 3)
+	if s.Dots[0].Point() != (Point{3, 5}) {
+		t.Errorf("wrong translated point %v", s.Dots[0].Point())
+	}
+
+	s.Scale(2, 0.5)
+	if s.Dots[0].Point() != (Point{6, 2.5}) {
+		t.Errorf("wrong scaled point %v", s.Dots[0].Point())
+	}
+
+	s = geometryStroke(2, 1)
+	s.Rotate(math.Pi/2, Point{1, 1})
+	p := s.Dots[0].Point()
+	if !near(p.X, 1, 0.001) || !near(p.Y, 2, 0.001) {
+		t.Errorf("wrong rotated point %v", p)
+	}
+
+	d := &Drawing{Layers: []Layer{{Strokes: []Stroke{geometryStroke(1, 1)}}}}
+	d.Translate(-1, -1)
+	if d.Layers[0].Strokes[0].Dots[0].Point() != (Point{0, 0}) {
+		t.Errorf("drawing was not translated")
+	}
+}
+
+// geometryStroke creates a stroke from x, y pairs.
+func geometryStroke(xy ...float32) Stroke {
+	s := Stroke{BrushType: BallpointV5}
+	for i := 0; i+1 < len(xy); i += 2 {
+		s.Dots = append(s.Dots, Dot{X: xy[i], Y: xy[i+1]})
+	}
+	return s
+}
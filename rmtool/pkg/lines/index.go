@@ -0,0 +1,287 @@
+package lines
+
+import (
+	"math"
+	"sort"
+)
+
+// indexCellSize is the edge length of a grid cell in the index.
+//
+// A handwritten word is about 100-200 pixels wide,
+// so most strokes occupy only a few cells.
+const indexCellSize = 64
+
+// indexMaxArea is the largest area covered by the grid of an index,
+// the page with a margin of one page on each side.
+var indexMaxArea = Rect{
+	Min: Point{-MaxWidth, -MaxHeight},
+	Max: Point{2 * MaxWidth, 2 * MaxHeight},
+}
+
+// StrokeRef identifies a stroke within a drawing.
+type StrokeRef struct {
+	Layer  int
+	Stroke int
+}
+
+// An Index allows to find strokes by their location.
+//
+// The index is a uniform grid over the page; each stroke is registered
+// with all grid cells that its bounding box covers.
+//
+// The index does not track changes to the drawing.
+// If the drawing is modified, a new index must be created.
+type Index struct {
+	d        *Drawing
+	entries  []indexEntry
+	cells    [][]int32
+	origin   Point
+	cols     int
+	rows     int
+	cellSize float32
+}
+
+type indexEntry struct {
+	ref    StrokeRef
+	bounds Rect
+}
+
+// NewIndex creates a spatial index for all strokes in the given drawing.
+func NewIndex(d *Drawing) *Index {
+	x := &Index{
+		d:        d,
+		cellSize: indexCellSize,
+	}
+
+	// The grid covers the page and any strokes outside of it,
+	// up to indexMaxArea. Strokes beyond that are kept in the cells
+	// at the edge of the grid, so garbage coordinates from a damaged file
+	// cannot blow up the size of the grid.
+	area := Rect{Max: Point{MaxWidth, MaxHeight}}
+	for i := range d.Layers {
+		for j := range d.Layers[i].Strokes {
+			b := d.Layers[i].Strokes[j].Bounds()
+			if b.Empty() || !b.finite() {
+				continue
+			}
+			x.entries = append(x.entries, indexEntry{
+				ref:    StrokeRef{Layer: i, Stroke: j},
+				bounds: b,
+			})
+			area = area.Union(b)
+		}
+	}
+
+	area = area.intersect(indexMaxArea)
+	x.origin = area.Min
+	x.cols = int(area.Dx()/x.cellSize) + 1
+	x.rows = int(area.Dy()/x.cellSize) + 1
+	x.cells = make([][]int32, x.cols*x.rows)
+
+	for i, e := range x.entries {
+		c0, r0 := x.cell(e.bounds.Min)
+		c1, r1 := x.cell(e.bounds.Max)
+		for r := r0; r <= r1; r++ {
+			for c := c0; c <= c1; c++ {
+				idx := r*x.cols + c
+				x.cells[idx] = append(x.cells[idx], int32(i))
+			}
+		}
+	}
+
+	return x
+}
+
+// Len returns the number of strokes in the index.
+func (x *Index) Len() int {
+	return len(x.entries)
+}
+
+// Stroke returns the referenced stroke.
+func (x *Index) Stroke(ref StrokeRef) *Stroke {
+	return &x.d.Layers[ref.Layer].Strokes[ref.Stroke]
+}
+
+// Query returns all strokes that have a part of their path within r.
+//
+// The result is in drawing order, i.e. by layer and stroke.
+func (x *Index) Query(r Rect) []StrokeRef {
+	res := make([]StrokeRef, 0)
+	if r.Empty() {
+		return res
+	}
+
+	c0, r0 := x.cell(r.Min)
+	c1, r1 := x.cell(r.Max)
+	for row := r0; row <= r1; row++ {
+		for col := c0; col <= c1; col++ {
+			for _, i := range x.cells[row*x.cols+col] {
+				e := x.entries[i]
+				// Strokes that span several cells are reported
+				// only in the first cell that is shared with the query.
+				ec, er := x.cell(e.bounds.Min)
+				if col != maxInt(ec, c0) || row != maxInt(er, r0) {
+					continue
+				}
+				if x.Stroke(e.ref).Intersects(r) {
+					res = append(res, e.ref)
+				}
+			}
+		}
+	}
+
+	sort.Slice(res, func(i, j int) bool {
+		return res[i].less(res[j])
+	})
+	return res
+}
+
+// Nearest returns up to k strokes that are closest to the given point,
+// nearest first.
+//
+// The distance is measured to the path of the stroke.
+func (x *Index) Nearest(p Point, k int) []StrokeRef {
+	if k <= 0 || len(x.entries) == 0 {
+		return make([]StrokeRef, 0)
+	}
+
+	type candidate struct {
+		entry int32
+		dist  float64
+	}
+	var candidates []candidate
+	seen := make(map[int32]bool)
+	kth := func() float64 {
+		if len(candidates) < k {
+			return math.Inf(1)
+		}
+		return candidates[k-1].dist
+	}
+
+	pc, pr := x.cell(p)
+	maxRing := maxInt(maxInt(pc, x.cols-1-pc), maxInt(pr, x.rows-1-pr))
+	for ring := 0; ring <= maxRing; ring++ {
+		// visit the cells on the border of the square around p
+		for row := pr - ring; row <= pr+ring; row++ {
+			if row < 0 || row >= x.rows {
+				continue
+			}
+			step := 1
+			if row != pr-ring && row != pr+ring {
+				step = 2 * ring
+			}
+			for col := pc - ring; col <= pc+ring; col += step {
+				if col >= 0 && col < x.cols {
+					for _, i := range x.cells[row*x.cols+col] {
+						if seen[i] {
+							continue
+						}
+						seen[i] = true
+						e := x.entries[i]
+						candidates = append(candidates, candidate{i, distance(x.Stroke(e.ref), p)})
+					}
+				}
+			}
+		}
+
+		sort.Slice(candidates, func(i, j int) bool {
+			if candidates[i].dist != candidates[j].dist {
+				return candidates[i].dist < candidates[j].dist
+			}
+			return x.entries[candidates[i].entry].ref.less(x.entries[candidates[j].entry].ref)
+		})
+
+		// Strokes that have not been seen yet are outside the visited square.
+		if kth() <= x.ringDistance(p, ring) {
+			break
+		}
+	}
+
+	if len(candidates) > k {
+		candidates = candidates[:k]
+	}
+	res := make([]StrokeRef, len(candidates))
+	for i, c := range candidates {
+		res[i] = x.entries[c.entry].ref
+	}
+	return res
+}
+
+// ringDistance returns the distance from p to the nearest point outside
+// the square of cells around p with the given radius.
+func (x *Index) ringDistance(p Point, ring int) float64 {
+	pc, pr := x.cell(p)
+	left := x.origin.X + float32(pc-ring)*x.cellSize
+	top := x.origin.Y + float32(pr-ring)*x.cellSize
+	right := x.origin.X + float32(pc+ring+1)*x.cellSize
+	bottom := x.origin.Y + float32(pr+ring+1)*x.cellSize
+
+	d := math.Min(float64(p.X-left), float64(right-p.X))
+	d = math.Min(d, math.Min(float64(p.Y-top), float64(bottom-p.Y)))
+	return math.Max(d, 0)
+}
+
+// cell returns the column and row for the given point.
+// Points outside the grid are mapped to the nearest cell.
+func (x *Index) cell(p Point) (int, int) {
+	c := int((p.X - x.origin.X) / x.cellSize)
+	r := int((p.Y - x.origin.Y) / x.cellSize)
+	return clampInt(c, 0, x.cols-1), clampInt(r, 0, x.rows-1)
+}
+
+// distance returns the distance from p to the path of s.
+func distance(s *Stroke, p Point) float64 {
+	d := Dot{X: p.X, Y: p.Y}
+	if len(s.Dots) == 1 {
+		return d.Distance(s.Dots[0])
+	}
+
+	min := math.Inf(1)
+	for i := 1; i < len(s.Dots); i++ {
+		min = math.Min(min, segmentDistance(d, s.Dots[i-1], s.Dots[i]))
+	}
+	return min
+}
+
+func (r StrokeRef) less(o StrokeRef) bool {
+	if r.Layer != o.Layer {
+		return r.Layer < o.Layer
+	}
+	return r.Stroke < o.Stroke
+}
+
+func maxInt(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
+
+func clampInt(v, min, max int) int {
+	if v < min {
+		return min
+	}
+	if v > max {
+		return max
+	}
+	return v
+}
+
+// finite tells if all coordinates of r are finite numbers.
+func (r Rect) finite() bool {
+	for _, v := range []float32{r.Min.X, r.Min.Y, r.Max.X, r.Max.Y} {
+		f := float64(v)
+		if math.IsNaN(f) || math.IsInf(f, 0) {
+			return false
+		}
+	}
+	return true
+}
+
+// intersect returns the part of r that is inside o.
+func (r Rect) intersect(o Rect) Rect {
+	return Rect{
+		Min: Point{max32(r.Min.X, o.Min.X), max32(r.Min.Y, o.Min.Y)},
+		Max: Point{min32(r.Max.X, o.Max.X), min32(r.Max.Y, o.Max.Y)},
+	}
+}
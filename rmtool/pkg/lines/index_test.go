@@ -0,0 +1,224 @@
+package lines
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+)
+
+func TestIndexQuery(t *testing.T) {
+	d := randomDrawing(rand.New(rand.NewSource(1)), 2, 500)
+	x := NewIndex(d)
+	if x.Len() != 1000 {
+		t.Fatalf("wrong number of indexed strokes (%v != %v)", x.Len(), 1000)
+	}
+
+	rnd := rand.New(rand.NewSource(2))
+	for i := 0; i < 100; i++ {
+		r := randomRect(rnd)
+		got := x.Query(r)
+		want := linearQuery(d, r)
+		if !refsEqual(got, want) {
+			t.Fatalf("query %v: got %v, want %v", r, got, want)
+		}
+	}
+
+	// covers all strokes
+	all := x.Query(Rect{Point{-1000, -1000}, Point{5000, 5000}})
+	if len(all) != x.Len() {
+		t.Errorf("wrong number of strokes for the whole page (%v != %v)", len(all), x.Len())
+	}
+
+	if len(x.Query(emptyRect)) != 0 {
+		t.Errorf("empty query should return nothing")
+	}
+}
+
+func TestIndexNearest(t *testing.T) {
+	d := randomDrawing(rand.New(rand.NewSource(3)), 1, 300)
+	// a stroke off the page
+	d.Layers[0].Strokes = append(d.Layers[0].Strokes, geometryStroke(-200, -200, -190, -190))
+	x := NewIndex(d)
+
+	rnd := rand.New(rand.NewSource(4))
+	for i := 0; i < 50; i++ {
+		p := Point{rnd.Float32()*MaxWidth*1.2 - 100, rnd.Float32()*MaxHeight*1.2 - 100}
+		got := x.Nearest(p, 5)
+		if len(got) != 5 {
+			t.Fatalf("wrong number of results (%v != %v)", len(got), 5)
+		}
+
+		want := linearNearest(d, p, 5)
+		for j := range got {
+			// ties may come in any order; compare distances
+			dg := distance(x.Stroke(got[j]), p)
+			dw := distance(x.Stroke(want[j]), p)
+			if math.Abs(dg-dw) > 1e-6 {
+				t.Fatalf("point %v, result %v: distance %v, want %v", p, j, dg, dw)
+			}
+		}
+	}
+
+	got := x.Nearest(Point{-195, -195}, 1)
+	if len(got) != 1 || got[0].Stroke != 300 {
+		t.Errorf("off-page stroke not found: %v", got)
+	}
+
+	if len(x.Nearest(Point{}, 0)) != 0 {
+		t.Errorf("k=0 should return nothing")
+	}
+	if len(NewIndex(NewDrawing()).Nearest(Point{}, 3)) != 0 {
+		t.Errorf("empty index should return nothing")
+	}
+}
+
+func TestIndexGarbageCoordinates(t *testing.T) {
+	d := randomDrawing(rand.New(rand.NewSource(5)), 1, 10)
+	far := float32(1e30)
+	nan := float32(math.NaN())
+	d.Layers[0].Strokes = append(d.Layers[0].Strokes,
+		geometryStroke(far, far, far+1, far+1),
+		geometryStroke(nan, 0, 10, 10),
+	)
+	x := NewIndex(d)
+
+	maxCells := int(indexMaxArea.Dx()/indexCellSize+1) * int(indexMaxArea.Dy()/indexCellSize+1)
+	if len(x.cells) > maxCells {
+		t.Fatalf("grid too large: %v cells", len(x.cells))
+	}
+
+	got := x.Query(Rect{Point{far - 10, far - 10}, Point{far + 10, far + 10}})
+	if len(got) != 1 || got[0].Stroke != 10 {
+		t.Errorf("far stroke not found: %v", got)
+	}
+	got = x.Nearest(Point{far, far}, 1)
+	if len(got) != 1 || got[0].Stroke != 10 {
+		t.Errorf("far stroke not nearest: %v", got)
+	}
+}
+
+func BenchmarkNewIndex(b *testing.B) {
+	d := randomDrawing(rand.New(rand.NewSource(1)), 1, 10000)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		NewIndex(d)
+	}
+}
+
+func BenchmarkIndexQuery(b *testing.B) {
+	d := randomDrawing(rand.New(rand.NewSource(1)), 1, 10000)
+	x := NewIndex(d)
+	rects := benchmarkRects()
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		x.Query(rects[i%len(rects)])
+	}
+}
+
+func BenchmarkLinearQuery(b *testing.B) {
+	d := randomDrawing(rand.New(rand.NewSource(1)), 1, 10000)
+	rects := benchmarkRects()
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		linearQuery(d, rects[i%len(rects)])
+	}
+}
+
+func BenchmarkIndexNearest(b *testing.B) {
+	d := randomDrawing(rand.New(rand.NewSource(1)), 1, 10000)
+	x := NewIndex(d)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		x.Nearest(Point{float32(i % MaxWidth), float32(i % MaxHeight)}, 10)
+	}
+}
+
+// randomDrawing creates a drawing with short, random strokes all over the page.
+func randomDrawing(rnd *rand.Rand, layers, strokes int) *Drawing {
+	d := &Drawing{Version: V5}
+	for i := 0; i < layers; i++ {
+		var l Layer
+		for j := 0; j < strokes; j++ {
+			x := rnd.Float32() * MaxWidth
+			y := rnd.Float32() * MaxHeight
+			s := Stroke{BrushType: BallpointV5}
+			for k := 0; k < 20; k++ {
+				s.Dots = append(s.Dots, Dot{X: x, Y: y})
+				x += rnd.Float32()*6 - 3
+				y += rnd.Float32()*6 - 3
+			}
+			l.Strokes = append(l.Strokes, s)
+		}
+		d.Layers = append(d.Layers, l)
+	}
+	return d
+}
+
+func randomRect(rnd *rand.Rand) Rect {
+	x := rnd.Float32() * MaxWidth
+	y := rnd.Float32() * MaxHeight
+	return Rect{Point{x, y}, Point{x + rnd.Float32()*300, y + rnd.Float32()*300}}
+}
+
+func benchmarkRects() []Rect {
+	rnd := rand.New(rand.NewSource(5))
+	rects := make([]Rect, 100)
+	for i := range rects {
+		rects[i] = randomRect(rnd)
+	}
+	return rects
+}
+
+func linearQuery(d *Drawing, r Rect) []StrokeRef {
+	res := make([]StrokeRef, 0)
+	for i := range d.Layers {
+		for j := range d.Layers[i].Strokes {
+			if d.Layers[i].Strokes[j].Intersects(r) {
+				res = append(res, StrokeRef{i, j})
+			}
+		}
+	}
+	return res
+}
+
+func linearNearest(d *Drawing, p Point, k int) []StrokeRef {
+	var refs []StrokeRef
+	var dists []float64
+	for i := range d.Layers {
+		for j := range d.Layers[i].Strokes {
+			refs = append(refs, StrokeRef{i, j})
+			dists = append(dists, distance(&d.Layers[i].Strokes[j], p))
+		}
+	}
+	// selection sort is good enough for the test
+	for i := 0; i < k && i < len(refs); i++ {
+		m := i
+		for j := i + 1; j < len(refs); j++ {
+			if dists[j] < dists[m] {
+				m = j
+			}
+		}
+		refs[i], refs[m] = refs[m], refs[i]
+		dists[i], dists[m] = dists[m], dists[i]
+	}
+	if len(refs) > k {
+		refs = refs[:k]
+	}
+	return refs
+}
+
+func refsEqual(a, b []StrokeRef) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -12,7 +12,7 @@ var endianess = binary.LittleEndian
 // UnmarshalBinary reads a reMarkable drawing from the given bytes.
 func (d *Drawing) UnmarshalBinary(data []byte) error {
 	r := bytes.NewReader(data)
-	err := read(r, d)
+	err := read(r, d, ReadOptions{})
 	if err != nil {
 		return err
 	}
@@ -22,38 +22,72 @@ func (d *Drawing) UnmarshalBinary(data []byte) error {
 
 // ReadDrawing creates a new reMarkable drawing from the given reader.
 func ReadDrawing(r io.Reader) (*Drawing, error) {
+	return ReadDrawingOptions(r, ReadOptions{})
+}
+
+// ReadDrawingOptions creates a new reMarkable drawing from the given reader,
+// using the given options.
+//
+// If the data is corrupt, the returned error is a *DecodeError.
+// In lenient mode, the drawing holds everything that could be recovered.
+func ReadDrawingOptions(r io.Reader, o ReadOptions) (*Drawing, error) {
 	d := &Drawing{}
-	err := read(r, d)
+	err := read(r, d, o)
 	return d, err
 }
 
 // read reads the given byte data into the given drawing.
-func read(r io.Reader, d *Drawing) error {
-	version, err := readHeader(r)
+func read(r io.Reader, d *Drawing, o ReadOptions) error {
+	cr := &countingReader{r: r}
+	version, err := readHeader(cr)
 	if err != nil {
 		return err
 	}
 	d.Version = version
 
-	nLayers, err := readNumber(r)
+	// v6 has a completely different structure
+	if version == V6 {
+		return readV6(cr, d, o)
+	}
+
+	fail := func(err error, layer, stroke int) error {
+		if o.Lenient {
+			d.trim(layer, stroke)
+		}
+		return &DecodeError{Offset: cr.n, Layer: layer, Stroke: stroke, Err: err}
+	}
+
+	nLayers, err := readNumber(cr)
 	if err != nil {
-		return err
+		return fail(fmt.Errorf("failed to read number of layers"), -1, -1)
 	}
 
-	d.Layers = make([]Layer, nLayers)
-	for i := uint32(0); i < nLayers; i++ {
-		nStrokes, err := readNumber(r)
-		d.Layers[i].Strokes = make([]Stroke, nStrokes)
+	d.Layers = make([]Layer, prealloc(nLayers))
+	for i := 0; i < int(nLayers); i++ {
+		if i == len(d.Layers) {
+			d.Layers = append(d.Layers, Layer{})
+		}
+
+		nStrokes, err := readNumber(cr)
 		if err != nil {
-			return err
+			return fail(fmt.Errorf("failed to read number of strokes"), i, -1)
 		}
+		d.Layers[i].Strokes = make([]Stroke, prealloc(nStrokes))
 
-		for j := uint32(0); j < nStrokes; j++ {
-			s, err := readStroke(r, version)
+		for j := 0; j < int(nStrokes); j++ {
+			s, err := readStroke(cr, version)
 			if err != nil {
-				return err
+				return fail(err, i, j)
+			}
+			// Unknown brushes mean that we have lost track of the structure.
+			if o.Lenient && validateBrushType(s.BrushType) != nil {
+				return fail(fmt.Errorf("invalid brush type %v", s.BrushType), i, j)
+			}
+			if j == len(d.Layers[i].Strokes) {
+				d.Layers[i].Strokes = append(d.Layers[i].Strokes, s)
+			} else {
+				d.Layers[i].Strokes[j] = s
 			}
-			d.Layers[i].Strokes[j] = s
 		}
 	}
 
@@ -73,12 +107,19 @@ func readHeader(r io.Reader) (Version, error) {
 		return v, fmt.Errorf("unexpected header size")
 	}
 
-	s := string(buf)
+	return parseHeader(string(buf))
+}
+
+// parseHeader determines the version from the given header.
+func parseHeader(s string) (Version, error) {
+	var v Version
 	switch s {
 	case headerV3:
 		v = V3
 	case headerV5:
 		v = V5
+	case headerV6:
+		v = V6
 	default:
 		return v, fmt.Errorf("unsupported header %q", s)
 	}
@@ -123,13 +164,13 @@ func readStroke(r io.Reader, v Version) (Stroke, error) {
 		return s, fmt.Errorf("failed to read number of dots")
 	}
 
-	s.Dots = make([]Dot, nDots)
+	s.Dots = make([]Dot, 0, prealloc(nDots))
 	for i := uint32(0); i < nDots; i++ {
 		d, err := readDot(r)
 		if err != nil {
 			return s, err
 		}
-		s.Dots[i] = d
+		s.Dots = append(s.Dots, d)
 	}
 
 	return s, nil
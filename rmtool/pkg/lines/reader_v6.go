@@ -0,0 +1,954 @@
+package lines
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"sort"
+)
+
+// The v6 format is a sequence of tagged blocks which describe a CRDT scene
+// tree. Layers are groups below the root node, strokes are "line items"
+// within these groups.
+//
+// See:
+// https://github.com/ricklupton/rmscene
+
+// tagType is the lower nibble of a tag and tells how the tagged value is encoded.
+type tagType uint8
+
+const (
+	tagByte1   tagType = 0x1
+	tagByte4   tagType = 0x4
+	tagByte8   tagType = 0x8
+	tagLength4 tagType = 0xC
+	tagID      tagType = 0xF
+)
+
+// blockType identifies the contents of a top-level block.
+type blockType uint8
+
+const (
+	blockMigrationInfo blockType = 0x00
+	blockSceneTree     blockType = 0x01
+	blockTreeNode      blockType = 0x02
+	blockGlyphItem     blockType = 0x03
+	blockGroupItem     blockType = 0x04
+	blockLineItem      blockType = 0x05
+	blockTextItem      blockType = 0x06
+	blockRootText      blockType = 0x07
+	blockTombstoneItem blockType = 0x08
+	blockAuthorIDs     blockType = 0x09
+	blockPageInfo      blockType = 0x0A
+	blockSceneInfo     blockType = 0x0D
+)
+
+// Size of a serialized point, depending on the version of the line block.
+const (
+	pointSizeV1 = 24
+	pointSizeV2 = 14
+)
+
+// maxDeletedLength limits the number of deleted characters in a text item,
+// so that a damaged length cannot cause huge allocations.
+const maxDeletedLength = 1 << 20
+
+// crdtID identifies a node or item in the scene tree.
+type crdtID struct {
+	part1 uint8
+	part2 uint64
+}
+
+// The well known IDs for the end-of-sequence marker and the root group.
+var (
+	endMarker = crdtID{0, 0}
+	rootID    = crdtID{0, 1}
+)
+
+// less gives a stable ordering for IDs.
+func (c crdtID) less(o crdtID) bool {
+	if c.part1 != o.part1 {
+		return c.part1 < o.part1
+	}
+	return c.part2 < o.part2
+}
+
+// sceneItem is a single entry in a CRDT sequence,
+// i.e. the children of a group or the fragments of a text.
+type sceneItem struct {
+	id      crdtID
+	left    crdtID
+	right   crdtID
+	deleted bool
+	// group is set for group items and references the child group node.
+	group *crdtID
+	// stroke is set for line items.
+	stroke *Stroke
+	// text is set for text items.
+	text string
+	// deletedLength is the number of deleted characters for text items.
+	deletedLength int
+}
+
+// scene holds the items collected from the blocks of a v6 file.
+type scene struct {
+	// items maps the ID of a parent group to its (unordered) children.
+	items map[crdtID][]sceneItem
+	// text is the typed text for the page, if any.
+	text *Text
+	// nodes holds the attributes of groups, by group ID.
+	nodes map[crdtID]treeNode
+}
+
+// treeNode holds the attributes of a group in the scene tree.
+// For layers, this is the name and visibility.
+type treeNode struct {
+	label   string
+	visible bool
+}
+
+// readV6 reads the blocks following the header of a v6 file.
+func readV6(r io.Reader, d *Drawing, o ReadOptions) error {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return err
+	}
+
+	sc, err := parseScene(data, o)
+	if sc != nil {
+		sc.build(d)
+	}
+	return err
+}
+
+// parseScene reads all blocks from the given data.
+//
+// In lenient mode, blocks that cannot be decoded are skipped and the scene
+// is returned together with the first error.
+func parseScene(data []byte, o ReadOptions) (*scene, error) {
+	sc := &scene{
+		items: make(map[crdtID][]sceneItem),
+		nodes: make(map[crdtID]treeNode),
+	}
+
+	var firstErr error
+	fail := func(offset int, err error) error {
+		de := &DecodeError{Offset: int64(headerLen + offset), Layer: -1, Stroke: -1, Err: err}
+		if firstErr == nil {
+			firstErr = de
+		}
+		return de
+	}
+
+	br := &blockReader{data: data}
+	for !br.done() {
+		start := br.pos
+		// Block header:
+		// length (uint32), unknown (uint8), min version (uint8),
+		// current version (uint8), block type (uint8)
+		length, err := br.uint32()
+		if err != nil {
+			return scOrNil(sc, o), fail(start, fmt.Errorf("failed to read block length"))
+		}
+		header, err := br.bytes(4)
+		if err != nil {
+			return scOrNil(sc, o), fail(start, fmt.Errorf("failed to read block header"))
+		}
+		version := header[2]
+		bt := blockType(header[3])
+
+		content, err := br.bytes(int(length))
+		if err != nil {
+			return scOrNil(sc, o), fail(start, fmt.Errorf("block of type %v exceeds data", bt))
+		}
+
+		// Each block gets its own reader;
+		// unknown trailing fields within a block are ignored.
+		err = sc.readBlock(&blockReader{data: content}, bt, version)
+		if err != nil {
+			de := fail(start, err)
+			if !o.Lenient {
+				return nil, de
+			}
+		}
+	}
+
+	return sc, firstErr
+}
+
+// scOrNil returns the scene in lenient mode only.
+func scOrNil(sc *scene, o ReadOptions) *scene {
+	if o.Lenient {
+		return sc
+	}
+	return nil
+}
+
+func (sc *scene) readBlock(br *blockReader, bt blockType, version uint8) error {
+	switch bt {
+	case blockGroupItem, blockLineItem:
+		item, parent, err := readSceneItem(br, bt, version)
+		if err != nil {
+			return err
+		}
+		sc.items[parent] = append(sc.items[parent], item)
+	case blockTreeNode:
+		id, node, err := readTreeNode(br)
+		if err != nil {
+			return err
+		}
+		sc.nodes[id] = node
+	case blockRootText:
+		t, err := readRootText(br)
+		if err != nil {
+			return err
+		}
+		sc.text = t
+	default:
+		// not relevant for the drawing
+	}
+
+	return nil
+}
+
+// readTreeNode reads the label and visibility of a group.
+//
+// Both values are last-write-wins registers,
+// each in a subblock with a timestamp and the value.
+func readTreeNode(br *blockReader) (crdtID, treeNode, error) {
+	node := treeNode{visible: true}
+
+	id, err := br.taggedID(1)
+	if err != nil {
+		return id, node, fmt.Errorf("failed to read node id")
+	}
+
+	label, err := br.subblock(2)
+	if err != nil {
+		return id, node, fmt.Errorf("failed to read node label")
+	}
+	_, err = label.taggedID(1)
+	if err != nil {
+		return id, node, fmt.Errorf("failed to read node label")
+	}
+	node.label, _, err = label.taggedString(2)
+	if err != nil {
+		return id, node, fmt.Errorf("failed to read node label")
+	}
+
+	visible, err := br.subblock(3)
+	if err != nil {
+		return id, node, fmt.Errorf("failed to read node visibility")
+	}
+	_, err = visible.taggedID(1)
+	if err != nil {
+		return id, node, fmt.Errorf("failed to read node visibility")
+	}
+	err = visible.tag(2, tagByte1)
+	if err != nil {
+		return id, node, fmt.Errorf("failed to read node visibility")
+	}
+	v, err := visible.uint8()
+	if err != nil {
+		return id, node, fmt.Errorf("failed to read node visibility")
+	}
+	node.visible = v != 0
+
+	return id, node, nil
+}
+
+// readSceneItem reads the common attributes of a scene item and the value
+// for group or line items.
+//
+// Returns the item and the ID of the group that contains it.
+func readSceneItem(br *blockReader, bt blockType, version uint8) (sceneItem, crdtID, error) {
+	var item sceneItem
+
+	parent, err := br.taggedID(1)
+	if err != nil {
+		return item, parent, fmt.Errorf("failed to read parent id")
+	}
+	item.id, err = br.taggedID(2)
+	if err != nil {
+		return item, parent, fmt.Errorf("failed to read item id")
+	}
+	item.left, err = br.taggedID(3)
+	if err != nil {
+		return item, parent, fmt.Errorf("failed to read left id")
+	}
+	item.right, err = br.taggedID(4)
+	if err != nil {
+		return item, parent, fmt.Errorf("failed to read right id")
+	}
+	deletedLength, err := br.taggedUint32(5)
+	if err != nil {
+		return item, parent, fmt.Errorf("failed to read deleted length")
+	}
+	item.deleted = deletedLength > 0
+
+	// Deleted items have no value.
+	if !br.hasTag(6, tagLength4) {
+		return item, parent, nil
+	}
+	value, err := br.subblock(6)
+	if err != nil {
+		return item, parent, fmt.Errorf("failed to read item value")
+	}
+	// the item type is redundant with the block type
+	_, err = value.uint8()
+	if err != nil {
+		return item, parent, fmt.Errorf("failed to read item type")
+	}
+
+	switch bt {
+	case blockGroupItem:
+		g, err := value.taggedID(2)
+		if err != nil {
+			return item, parent, fmt.Errorf("failed to read group id")
+		}
+		item.group = &g
+	case blockLineItem:
+		s, err := readLine(value, version)
+		if err != nil {
+			return item, parent, err
+		}
+		item.stroke = &s
+	}
+
+	return item, parent, nil
+}
+
+// readLine reads the value of a line item into a Stroke.
+func readLine(br *blockReader, version uint8) (Stroke, error) {
+	var s Stroke
+
+	tool, err := br.taggedUint32(1)
+	if err != nil {
+		return s, fmt.Errorf("failed to read brush type")
+	}
+	s.BrushType = BrushType(tool)
+
+	color, err := br.taggedUint32(2)
+	if err != nil {
+		return s, fmt.Errorf("failed to read brush color")
+	}
+	s.BrushColor = BrushColor(color)
+
+	size, err := br.taggedFloat64(3)
+	if err != nil {
+		return s, fmt.Errorf("failed to read brush size")
+	}
+	s.BrushSize = BrushSize(size)
+
+	// starting length, not used
+	_, err = br.taggedFloat32(4)
+	if err != nil {
+		return s, fmt.Errorf("failed to read starting length")
+	}
+
+	points, err := br.subblock(5)
+	if err != nil {
+		return s, fmt.Errorf("failed to read points")
+	}
+
+	pointSize := pointSizeV1
+	if version >= 2 {
+		pointSize = pointSizeV2
+	}
+	nDots := len(points.data) / pointSize
+	s.Dots = make([]Dot, nDots)
+	for i := 0; i < nDots; i++ {
+		var d Dot
+		if version >= 2 {
+			d, err = readPointV2(points)
+		} else {
+			d, err = readPointV1(points)
+		}
+		if err != nil {
+			return s, err
+		}
+		s.Dots[i] = d
+	}
+
+	return s, nil
+}
+
+// readPointV1 reads a point where all values are stored as float32.
+func readPointV1(br *blockReader) (Dot, error) {
+	var d Dot
+	values := make([]float32, 6)
+	for i := range values {
+		v, err := br.float32()
+		if err != nil {
+			return d, fmt.Errorf("failed to read point")
+		}
+		values[i] = v
+	}
+
+	d.X = values[0] + MaxWidth/2
+	d.Y = values[1]
+	d.Speed = values[2]
+	d.Tilt = values[3]
+	d.Width = values[4]
+	d.Pressure = values[5]
+
+	return d, nil
+}
+
+// readPointV2 reads a point in the compact representation.
+//
+// Speed and width are stored as fixed point values,
+// direction and pressure as a single byte each.
+func readPointV2(br *blockReader) (Dot, error) {
+	var d Dot
+	x, err := br.float32()
+	if err != nil {
+		return d, fmt.Errorf("failed to read X-coordinate")
+	}
+	y, err := br.float32()
+	if err != nil {
+		return d, fmt.Errorf("failed to read Y-coordinate")
+	}
+	speed, err := br.uint16()
+	if err != nil {
+		return d, fmt.Errorf("failed to read speed")
+	}
+	width, err := br.uint16()
+	if err != nil {
+		return d, fmt.Errorf("failed to read width")
+	}
+	direction, err := br.uint8()
+	if err != nil {
+		return d, fmt.Errorf("failed to read tilt")
+	}
+	pressure, err := br.uint8()
+	if err != nil {
+		return d, fmt.Errorf("failed to read pressure")
+	}
+
+	// v6 uses a coordinate system with the origin at the top center.
+	d.X = x + MaxWidth/2
+	d.Y = y
+	d.Speed = float32(speed) / 4
+	d.Width = float32(width) / 4
+	d.Tilt = float32(direction) * (2 * math.Pi / 255)
+	d.Pressure = float32(pressure) / 255
+
+	return d, nil
+}
+
+// readRootText reads the typed text for a page.
+//
+// The text consists of a CRDT sequence of text fragments, followed by the
+// paragraph styles which are keyed by character IDs.
+// Each character in a fragment has its own ID, counting up from the fragment ID.
+func readRootText(br *blockReader) (*Text, error) {
+	_, err := br.taggedID(1)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read text id")
+	}
+
+	content, err := br.subblock(2)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read text content")
+	}
+
+	// Text fragments
+	items, err := readTextItems(content)
+	if err != nil {
+		return nil, err
+	}
+
+	// Formatting
+	styles, err := readTextFormats(content)
+	if err != nil {
+		return nil, err
+	}
+
+	pos, err := br.subblock(3)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read text position")
+	}
+	x, err := pos.float64()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read text position")
+	}
+	y, err := pos.float64()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read text position")
+	}
+
+	width, err := br.taggedFloat32(4)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read text width")
+	}
+
+	t := &Text{
+		X:     float32(x) + MaxWidth/2,
+		Y:     float32(y),
+		Width: width,
+	}
+
+	// Split the text into paragraphs.
+	// The style for the first paragraph is keyed with the end marker,
+	// all others with the ID of the newline that starts them.
+	style := func(id crdtID) ParagraphStyle {
+		s, ok := styles[id]
+		if !ok {
+			return StylePlain
+		}
+		return s
+	}
+	current := Paragraph{Style: style(endMarker)}
+	for _, item := range orderItems(splitChars(items)) {
+		if item.text == "\n" {
+			t.Paragraphs = append(t.Paragraphs, current)
+			current = Paragraph{Style: style(item.id)}
+		} else {
+			current.Text += item.text
+		}
+	}
+	t.Paragraphs = append(t.Paragraphs, current)
+	t.layout()
+
+	return t, nil
+}
+
+// splitChars splits text fragments into single characters.
+//
+// Other fragments can be inserted after any character,
+// so the sequence must be ordered on a per-character level.
+func splitChars(items []sceneItem) []sceneItem {
+	chars := make([]sceneItem, 0, len(items))
+	for _, item := range items {
+		left := item.left
+		// Deleted characters are kept as placeholders,
+		// they may still be referenced by other fragments.
+		if item.deleted {
+			for i := 0; i < item.deletedLength; i++ {
+				id := crdtID{item.id.part1, item.id.part2 + uint64(i)}
+				chars = append(chars, sceneItem{id: id, left: left, deleted: true})
+				left = id
+			}
+			continue
+		}
+		for i, r := range []rune(item.text) {
+			id := crdtID{item.id.part1, item.id.part2 + uint64(i)}
+			chars = append(chars, sceneItem{id: id, left: left, text: string(r)})
+			left = id
+		}
+	}
+	return chars
+}
+
+func readTextItems(content *blockReader) ([]sceneItem, error) {
+	outer, err := content.subblock(1)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read text items")
+	}
+	inner, err := outer.subblock(1)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read text items")
+	}
+	n, err := inner.count()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read number of text items")
+	}
+
+	items := make([]sceneItem, 0, n)
+	for i := 0; i < n; i++ {
+		sub, err := inner.subblock(0)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read text item")
+		}
+		var item sceneItem
+		item.id, err = sub.taggedID(2)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read text item id")
+		}
+		item.left, err = sub.taggedID(3)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read left id")
+		}
+		item.right, err = sub.taggedID(4)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read right id")
+		}
+		deleted, err := sub.taggedUint32(5)
+		if err != nil || deleted > maxDeletedLength {
+			return nil, fmt.Errorf("failed to read deleted length")
+		}
+		item.deleted = deleted > 0
+		item.deletedLength = int(deleted)
+		if sub.hasTag(6, tagLength4) {
+			item.text, _, err = sub.taggedString(6)
+			if err != nil {
+				return nil, fmt.Errorf("failed to read text")
+			}
+		}
+		items = append(items, item)
+	}
+
+	return items, nil
+}
+
+func readTextFormats(content *blockReader) (map[crdtID]ParagraphStyle, error) {
+	outer, err := content.subblock(2)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read text formats")
+	}
+	inner, err := outer.subblock(1)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read text formats")
+	}
+	n, err := inner.count()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read number of text formats")
+	}
+
+	styles := make(map[crdtID]ParagraphStyle)
+	timestamps := make(map[crdtID]crdtID)
+	for i := 0; i < n; i++ {
+		// The character ID comes without a tag.
+		charID, err := inner.crdtID()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read character id")
+		}
+		ts, err := inner.taggedID(1)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read format timestamp")
+		}
+		sub, err := inner.subblock(2)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read format")
+		}
+		// unknown, always 17
+		_, err = sub.uint8()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read format")
+		}
+		code, err := sub.uint8()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read format code")
+		}
+
+		// last writer wins
+		prev, ok := timestamps[charID]
+		if !ok || prev.less(ts) {
+			styles[charID] = ParagraphStyle(code)
+			timestamps[charID] = ts
+		}
+	}
+
+	return styles, nil
+}
+
+// build creates the layers for the drawing from the scene tree.
+//
+// Each group below the root node becomes a layer.
+// Nested groups are flattened into the layer that contains them.
+func (sc *scene) build(d *Drawing) {
+	d.Layers = make([]Layer, 0)
+
+	// Strokes placed directly on the root group go to an additional layer.
+	var loose []Stroke
+	for _, item := range sc.sequence(rootID) {
+		if item.group != nil {
+			seen := map[crdtID]bool{rootID: true}
+			l := Layer{Strokes: sc.strokes(*item.group, seen)}
+			if node, ok := sc.nodes[*item.group]; ok {
+				l.Name = node.label
+				l.Hidden = !node.visible
+			}
+			d.Layers = append(d.Layers, l)
+		} else if item.stroke != nil {
+			loose = append(loose, *item.stroke)
+		}
+	}
+	if len(loose) != 0 {
+		d.Layers = append(d.Layers, Layer{Strokes: loose})
+	}
+
+	// A single empty layer is the minimum requirement for a valid drawing
+	if len(d.Layers) == 0 {
+		d.Layers = append(d.Layers, Layer{})
+	}
+
+	d.Text = sc.text
+}
+
+// strokes collects all strokes from the given group, including nested groups.
+//
+// Groups that were already seen are skipped,
+// as a damaged file may contain a group within itself.
+func (sc *scene) strokes(group crdtID, seen map[crdtID]bool) []Stroke {
+	strokes := make([]Stroke, 0)
+	if seen[group] {
+		return strokes
+	}
+	seen[group] = true
+	for _, item := range sc.sequence(group) {
+		if item.stroke != nil {
+			strokes = append(strokes, *item.stroke)
+		} else if item.group != nil {
+			strokes = append(strokes, sc.strokes(*item.group, seen)...)
+		}
+	}
+	return strokes
+}
+
+// sequence returns the non-deleted children of the given group in order.
+//
+// Items are linked to their left neighbour at the time they were inserted.
+// Items inserted at the same position are ordered newest first.
+func (sc *scene) sequence(group crdtID) []sceneItem {
+	return orderItems(sc.items[group])
+}
+
+// orderItems brings the items of a CRDT sequence into order
+// and drops deleted items.
+func orderItems(items []sceneItem) []sceneItem {
+	known := make(map[crdtID]bool)
+	byLeft := make(map[crdtID][]sceneItem)
+	for _, item := range items {
+		known[item.id] = true
+	}
+	for _, item := range items {
+		left := item.left
+		if !known[left] {
+			left = endMarker
+		}
+		byLeft[left] = append(byLeft[left], item)
+	}
+
+	ordered := make([]sceneItem, 0, len(items))
+	// IDs are unique in a valid file;
+	// a damaged file may contain cycles.
+	visited := make(map[crdtID]bool)
+	var visit func(anchor crdtID)
+	visit = func(anchor crdtID) {
+		if visited[anchor] {
+			return
+		}
+		visited[anchor] = true
+		children := byLeft[anchor]
+		sort.Slice(children, func(i, j int) bool {
+			return children[j].id.less(children[i].id)
+		})
+		for _, c := range children {
+			if !c.deleted {
+				ordered = append(ordered, c)
+			}
+			visit(c.id)
+		}
+	}
+	visit(endMarker)
+
+	return ordered
+}
+
+// blockReader reads primitive and tagged values from a byte slice.
+type blockReader struct {
+	data []byte
+	pos  int
+}
+
+func (b *blockReader) done() bool {
+	return b.pos >= len(b.data)
+}
+
+// remaining returns the number of bytes that were not read yet.
+func (b *blockReader) remaining() int {
+	return len(b.data) - b.pos
+}
+
+func (b *blockReader) bytes(n int) ([]byte, error) {
+	if n < 0 || n > b.remaining() {
+		return nil, io.ErrUnexpectedEOF
+	}
+	v := b.data[b.pos : b.pos+n]
+	b.pos += n
+	return v, nil
+}
+
+func (b *blockReader) uint8() (uint8, error) {
+	v, err := b.bytes(1)
+	if err != nil {
+		return 0, err
+	}
+	return v[0], nil
+}
+
+func (b *blockReader) uint16() (uint16, error) {
+	v, err := b.bytes(2)
+	if err != nil {
+		return 0, err
+	}
+	return endianess.Uint16(v), nil
+}
+
+func (b *blockReader) uint32() (uint32, error) {
+	v, err := b.bytes(4)
+	if err != nil {
+		return 0, err
+	}
+	return endianess.Uint32(v), nil
+}
+
+func (b *blockReader) float32() (float32, error) {
+	v, err := b.uint32()
+	return math.Float32frombits(v), err
+}
+
+func (b *blockReader) float64() (float64, error) {
+	v, err := b.bytes(8)
+	if err != nil {
+		return 0, err
+	}
+	return math.Float64frombits(endianess.Uint64(v)), nil
+}
+
+func (b *blockReader) varuint() (uint64, error) {
+	v, n := binary.Uvarint(b.data[b.pos:])
+	if n <= 0 {
+		return 0, io.ErrUnexpectedEOF
+	}
+	b.pos += n
+	return v, nil
+}
+
+// count reads the number of elements that follow.
+//
+// Each element takes at least one byte,
+// so a count that exceeds the remaining bytes is an error.
+func (b *blockReader) count() (int, error) {
+	n, err := b.varuint()
+	if err != nil {
+		return 0, err
+	}
+	if n > uint64(b.remaining()) {
+		return 0, io.ErrUnexpectedEOF
+	}
+	return int(n), nil
+}
+
+func (b *blockReader) crdtID() (crdtID, error) {
+	var id crdtID
+	p1, err := b.uint8()
+	if err != nil {
+		return id, err
+	}
+	p2, err := b.varuint()
+	if err != nil {
+		return id, err
+	}
+	return crdtID{p1, p2}, nil
+}
+
+// hasTag tells if the next value has the given tag, without consuming it.
+func (b *blockReader) hasTag(index uint64, t tagType) bool {
+	if b.done() {
+		return false
+	}
+	v, n := binary.Uvarint(b.data[b.pos:])
+	if n <= 0 {
+		return false
+	}
+	return v == index<<4|uint64(t)
+}
+
+// tag consumes a tag and checks that it matches the expected index and type.
+func (b *blockReader) tag(index uint64, t tagType) error {
+	if !b.hasTag(index, t) {
+		return fmt.Errorf("expected tag %v of type %v at offset %v", index, t, b.pos)
+	}
+	_, err := b.varuint()
+	return err
+}
+
+func (b *blockReader) taggedID(index uint64) (crdtID, error) {
+	err := b.tag(index, tagID)
+	if err != nil {
+		return crdtID{}, err
+	}
+	return b.crdtID()
+}
+
+func (b *blockReader) taggedUint32(index uint64) (uint32, error) {
+	err := b.tag(index, tagByte4)
+	if err != nil {
+		return 0, err
+	}
+	return b.uint32()
+}
+
+func (b *blockReader) taggedFloat32(index uint64) (float32, error) {
+	err := b.tag(index, tagByte4)
+	if err != nil {
+		return 0, err
+	}
+	return b.float32()
+}
+
+func (b *blockReader) taggedFloat64(index uint64) (float64, error) {
+	err := b.tag(index, tagByte8)
+	if err != nil {
+		return 0, err
+	}
+	return b.float64()
+}
+
+// taggedString reads a string from a subblock.
+//
+// The subblock contains the length of the string, an "is ASCII" flag and the
+// UTF-8 encoded string. It may be followed by a formatting code, which is
+// returned as well (or -1 if not present).
+func (b *blockReader) taggedString(index uint64) (string, int, error) {
+	sub, err := b.subblock(index)
+	if err != nil {
+		return "", 0, err
+	}
+	n, err := sub.count()
+	if err != nil {
+		return "", 0, err
+	}
+	// is ASCII
+	_, err = sub.uint8()
+	if err != nil {
+		return "", 0, err
+	}
+	raw, err := sub.bytes(n)
+	if err != nil {
+		return "", 0, err
+	}
+
+	format := -1
+	if sub.hasTag(2, tagByte4) {
+		f, err := sub.taggedUint32(2)
+		if err != nil {
+			return "", 0, err
+		}
+		format = int(f)
+	}
+
+	return string(raw), format, nil
+}
+
+// subblock reads a length-prefixed subblock and returns a reader for its content.
+func (b *blockReader) subblock(index uint64) (*blockReader, error) {
+	err := b.tag(index, tagLength4)
+	if err != nil {
+		return nil, err
+	}
+	n, err := b.uint32()
+	if err != nil {
+		return nil, err
+	}
+	content, err := b.bytes(int(n))
+	if err != nil {
+		return nil, err
+	}
+	return &blockReader{data: content}, nil
+}
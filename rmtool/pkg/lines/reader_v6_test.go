@@ -0,0 +1,541 @@
+package lines
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"testing"
+)
+
+func TestReadV6(t *testing.T) {
+	layer1 := crdtID{1, 10}
+	layer2 := crdtID{1, 20}
+
+	f := &v6Fixture{}
+	// layer 2 is inserted *after* layer 1
+	f.groupItem(rootID, crdtID{1, 11}, endMarker, endMarker, layer1)
+	f.groupItem(rootID, crdtID{1, 21}, crdtID{1, 11}, endMarker, layer2)
+	// two strokes in layer 1, the second one inserted to the left of the first.
+	f.lineItem(layer1, crdtID{1, 30}, endMarker, endMarker, 2, fixtureLine(BallpointV5, 0, 100))
+	f.lineItem(layer1, crdtID{1, 31}, endMarker, crdtID{1, 30}, 2, fixtureLine(FinelinerV5, 0, 200))
+	// a deleted stroke
+	f.deletedItem(blockLineItem, layer1, crdtID{1, 32}, crdtID{1, 30}, endMarker)
+	// one stroke in layer 2, v1 point format
+	f.lineItem(layer2, crdtID{1, 40}, endMarker, endMarker, 1, fixtureLine(PencilV5, 0, 300))
+	// irrelevant blocks are skipped
+	f.block(blockAuthorIDs, 1, []byte{0x01, 0x02, 0x03})
+
+	d, err := ReadDrawing(f.reader())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if d.Version != V6 {
+		t.Errorf("wrong version number")
+	}
+
+	if d.NumLayers() != 2 {
+		t.Fatalf("wrong layer count (%v != %v)", d.NumLayers(), 2)
+	}
+
+	s := d.Layers[0].Strokes
+	if len(s) != 2 {
+		t.Fatalf("wrong stroke count in layer 1 (%v != %v)", len(s), 2)
+	}
+	if s[0].BrushType != FinelinerV5 || s[1].BrushType != BallpointV5 {
+		t.Errorf("strokes in wrong order: %v, %v", s[0].BrushType, s[1].BrushType)
+	}
+
+	s = d.Layers[1].Strokes
+	if len(s) != 1 {
+		t.Fatalf("wrong stroke count in layer 2 (%v != %v)", len(s), 1)
+	}
+	if s[0].BrushType != PencilV5 {
+		t.Errorf("wrong brush type %v", s[0].BrushType)
+	}
+	if s[0].BrushSize != Medium {
+		t.Errorf("wrong brush size %v", s[0].BrushSize)
+	}
+}
+
+func TestReadV6Layers(t *testing.T) {
+	layer1 := crdtID{1, 10}
+	layer2 := crdtID{1, 20}
+
+	f := &v6Fixture{}
+	f.treeNode(layer1, "Layer 1", true)
+	f.treeNode(layer2, "Sketch", false)
+	f.groupItem(rootID, crdtID{1, 11}, endMarker, endMarker, layer1)
+	f.groupItem(rootID, crdtID{1, 21}, crdtID{1, 11}, endMarker, layer2)
+
+	d, err := ReadDrawing(f.reader())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if d.NumLayers() != 2 {
+		t.Fatalf("wrong layer count (%v != %v)", d.NumLayers(), 2)
+	}
+	if d.Layers[0].Name != "Layer 1" || d.Layers[0].Hidden {
+		t.Errorf("wrong attributes for layer 1: %q, hidden=%v", d.Layers[0].Name, d.Layers[0].Hidden)
+	}
+	if d.Layers[1].Name != "Sketch" || !d.Layers[1].Hidden {
+		t.Errorf("wrong attributes for layer 2: %q, hidden=%v", d.Layers[1].Name, d.Layers[1].Hidden)
+	}
+	if d.Layer("Sketch") != &d.Layers[1] {
+		t.Errorf("layer not found by name")
+	}
+}
+
+func TestReadV6Points(t *testing.T) {
+	layer := crdtID{1, 10}
+	line := fixtureLine(BallpointV5, Gray, 0)
+
+	for _, version := range []uint8{1, 2} {
+		f := &v6Fixture{}
+		f.groupItem(rootID, crdtID{1, 11}, endMarker, endMarker, layer)
+		f.lineItem(layer, crdtID{1, 30}, endMarker, endMarker, version, line)
+
+		d, err := ReadDrawing(f.reader())
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		s := d.Layers[0].Strokes[0]
+		if s.BrushColor != Gray {
+			t.Errorf("v%v: wrong brush color %v", version, s.BrushColor)
+		}
+		if len(s.Dots) != len(line.Dots) {
+			t.Fatalf("v%v: wrong dot count (%v != %v)", version, len(s.Dots), len(line.Dots))
+		}
+		for i, dot := range s.Dots {
+			expected := line.Dots[i]
+			// the compact v2 format looses some precision
+			if !near(dot.X, expected.X, 0.001) || !near(dot.Y, expected.Y, 0.001) {
+				t.Errorf("v%v: coordinate mismatch %v,%v != %v,%v", version, dot.X, dot.Y, expected.X, expected.Y)
+			}
+			if !near(dot.Width, expected.Width, 0.25) {
+				t.Errorf("v%v: width mismatch %v != %v", version, dot.Width, expected.Width)
+			}
+			if !near(dot.Pressure, expected.Pressure, 0.01) {
+				t.Errorf("v%v: pressure mismatch %v != %v", version, dot.Pressure, expected.Pressure)
+			}
+			if !near(dot.Tilt, expected.Tilt, 0.03) {
+				t.Errorf("v%v: tilt mismatch %v != %v", version, dot.Tilt, expected.Tilt)
+			}
+		}
+	}
+}
+
+func TestReadV6Empty(t *testing.T) {
+	f := &v6Fixture{}
+
+	d, err := ReadDrawing(f.reader())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = d.Validate()
+	if err != nil {
+		t.Errorf("empty v6 drawing should be valid: %v", err)
+	}
+}
+
+func TestReadV6Truncated(t *testing.T) {
+	layer := crdtID{1, 10}
+	f := &v6Fixture{}
+	f.groupItem(rootID, crdtID{1, 11}, endMarker, endMarker, layer)
+	f.lineItem(layer, crdtID{1, 30}, endMarker, endMarker, 2, fixtureLine(BallpointV5, Black, 0))
+
+	data := f.buf.Bytes()
+	r := io.MultiReader(bytes.NewBufferString(headerV6), bytes.NewReader(data[:len(data)-5]))
+	_, err := ReadDrawing(r)
+	if err == nil {
+		t.Errorf("truncated data should not be accepted")
+	}
+}
+
+func TestReadV6RoundTrip(t *testing.T) {
+	layer := crdtID{1, 10}
+	line := fixtureLine(BallpointV5, Black, 0)
+	f := &v6Fixture{}
+	f.groupItem(rootID, crdtID{1, 11}, endMarker, endMarker, layer)
+	f.lineItem(layer, crdtID{1, 30}, endMarker, endMarker, 1, line)
+
+	d, err := ReadDrawing(f.reader())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// v6 drawings can be written in the v5 format
+	d.Version = V5
+	var buf bytes.Buffer
+	err = WriteDrawing(&buf, d)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	x, err := ReadDrawing(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := x.Layers[0].Strokes[0]
+	if len(s.Dots) != len(line.Dots) {
+		t.Fatalf("dot mismatch afer r/w cycle")
+	}
+	for i, dot := range s.Dots {
+		if dot != line.Dots[i] {
+			t.Errorf("dot mismatch afer r/w cycle: %v != %v", dot, line.Dots[i])
+		}
+	}
+}
+
+func TestReadV6Text(t *testing.T) {
+	f := &v6Fixture{}
+	// "Title\nsecond\nthird" with the last paragraph inserted before the second
+	f.rootText(-302, 234, 750,
+		[]fixtureTextItem{
+			fixtureTextItem{crdtID{1, 100}, endMarker, "Title\n"},
+			fixtureTextItem{crdtID{1, 200}, crdtID{1, 105}, "second"},
+			fixtureTextItem{crdtID{1, 300}, crdtID{1, 105}, "third\n"},
+		},
+		map[crdtID]ParagraphStyle{
+			endMarker:        StyleHeading,
+			crdtID{1, 105}:   StyleBullet,
+			crdtID{1, 305}:   StyleCheckboxChecked,
+			crdtID{1, 12345}: StylePlain,
+		},
+	)
+
+	d, err := ReadDrawing(f.reader())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if d.Text == nil {
+		t.Fatalf("expected typed text")
+	}
+	if d.Text.X != 400 || d.Text.Y != 234 || d.Text.Width != 750 {
+		t.Errorf("wrong text position %v,%v (%v)", d.Text.X, d.Text.Y, d.Text.Width)
+	}
+	if d.Text.String() != "Title\nthird\nsecond" {
+		t.Errorf("wrong text %q", d.Text.String())
+	}
+
+	p := d.Text.Paragraphs
+	if len(p) != 3 {
+		t.Fatalf("wrong paragraph count (%v != %v)", len(p), 3)
+	}
+	if p[0].Style != StyleHeading || p[1].Style != StyleBullet || p[2].Style != StyleCheckboxChecked {
+		t.Errorf("wrong paragraph styles %v, %v, %v", p[0].Style, p[1].Style, p[2].Style)
+	}
+	if !(p[0].Y == d.Text.Y && p[0].Y < p[1].Y && p[1].Y < p[2].Y) {
+		t.Errorf("paragraph positions not in order")
+	}
+}
+
+func TestReadV6Corrupt(t *testing.T) {
+	// a string length that overflows the position
+	var str bytes.Buffer
+	putVaruint(&str, math.MaxUint64-8)
+	str.WriteByte(1)
+	str.WriteString("Layer 1")
+	var lww bytes.Buffer
+	putID(&lww, 1, crdtID{1, 1})
+	putSubblock(&lww, 2, str.Bytes())
+	var node bytes.Buffer
+	putID(&node, 1, crdtID{1, 10})
+	putSubblock(&node, 2, lww.Bytes())
+	f := &v6Fixture{}
+	f.block(blockTreeNode, 1, node.Bytes())
+	assertReadFails(t, "string length", f.buf.Bytes())
+
+	// a huge number of text items
+	var entries bytes.Buffer
+	putVaruint(&entries, math.MaxUint64/2)
+	var items bytes.Buffer
+	putSubblock(&items, 1, entries.Bytes())
+	var content bytes.Buffer
+	putSubblock(&content, 1, items.Bytes())
+	var text bytes.Buffer
+	putID(&text, 1, crdtID{0, 0})
+	putSubblock(&text, 2, content.Bytes())
+	f = &v6Fixture{}
+	f.block(blockRootText, 1, text.Bytes())
+	assertReadFails(t, "item count", f.buf.Bytes())
+
+	// a group that contains itself
+	layer := crdtID{1, 10}
+	f = &v6Fixture{}
+	f.groupItem(rootID, crdtID{1, 11}, endMarker, endMarker, layer)
+	f.groupItem(layer, crdtID{1, 12}, endMarker, endMarker, layer)
+	f.lineItem(layer, crdtID{1, 30}, endMarker, endMarker, 2, fixtureLine(BallpointV5, Black, 0))
+	d, err := ReadDrawing(f.reader())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(d.Layers[0].Strokes) != 1 {
+		t.Errorf("wrong stroke count (%v != %v)", len(d.Layers[0].Strokes), 1)
+	}
+
+	// items with the same ID
+	f = &v6Fixture{}
+	f.groupItem(rootID, crdtID{1, 11}, endMarker, endMarker, layer)
+	f.lineItem(layer, crdtID{1, 30}, endMarker, endMarker, 2, fixtureLine(BallpointV5, Black, 0))
+	f.lineItem(layer, crdtID{1, 30}, crdtID{1, 30}, endMarker, 2, fixtureLine(BallpointV5, Black, 0))
+	_, err = ReadDrawing(f.reader())
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// TestReadV6Damaged reads truncated and modified versions of a valid file.
+// Reading may fail, but must not panic.
+func TestReadV6Damaged(t *testing.T) {
+	layer := crdtID{1, 10}
+	f := &v6Fixture{}
+	f.groupItem(rootID, crdtID{1, 11}, endMarker, endMarker, layer)
+	f.treeNode(layer, "Layer 1", true)
+	f.lineItem(layer, crdtID{1, 30}, endMarker, endMarker, 2, fixtureLine(BallpointV5, Black, 0))
+	f.lineItem(layer, crdtID{1, 31}, crdtID{1, 30}, endMarker, 1, fixtureLine(PencilV5, Black, 100))
+	f.rootText(-302, 234, 750,
+		[]fixtureTextItem{
+			fixtureTextItem{crdtID{1, 100}, endMarker, "Title\n"},
+			fixtureTextItem{crdtID{1, 200}, crdtID{1, 105}, "second"},
+		},
+		map[crdtID]ParagraphStyle{endMarker: StyleHeading},
+	)
+	data := f.buf.Bytes()
+
+	for n := 0; n < len(data); n++ {
+		readDamaged(t, fmt.Sprintf("truncated at %v", n), data[:n])
+	}
+	for i := range data {
+		for _, b := range []byte{0x00, 0x7F, 0x80, 0xFF} {
+			damaged := append([]byte{}, data...)
+			damaged[i] = b
+			readDamaged(t, fmt.Sprintf("0x%X at %v", b, i), damaged)
+		}
+	}
+}
+
+func readDamaged(t *testing.T, name string, data []byte) {
+	defer func() {
+		if r := recover(); r != nil {
+			t.Errorf("%v: panic: %v", name, r)
+		}
+	}()
+	for _, lenient := range []bool{false, true} {
+		r := io.MultiReader(bytes.NewBufferString(headerV6), bytes.NewReader(data))
+		ReadDrawingOptions(r, ReadOptions{Lenient: lenient})
+	}
+}
+
+func assertReadFails(t *testing.T, name string, data []byte) {
+	for _, lenient := range []bool{false, true} {
+		r := io.MultiReader(bytes.NewBufferString(headerV6), bytes.NewReader(data))
+		_, err := ReadDrawingOptions(r, ReadOptions{Lenient: lenient})
+		if !IsDecodeError(err) {
+			t.Errorf("%v: expected a decode error, got %v", name, err)
+		}
+	}
+}
+
+// Fixture Helpers ------------------------------------------------------------
+
+func near(a, b, delta float32) bool {
+	return math.Abs(float64(a-b)) <= float64(delta)
+}
+
+func fixtureLine(bt BrushType, bc BrushColor, y float32) Stroke {
+	return Stroke{
+		BrushType:  bt,
+		BrushColor: bc,
+		BrushSize:  Medium,
+		Dots: []Dot{
+			Dot{X: 100, Y: y + 10, Speed: 2.5, Tilt: 1.0, Width: 3.5, Pressure: 0.5},
+			Dot{X: 110, Y: y + 12, Speed: 3, Tilt: 1.2, Width: 3.75, Pressure: 0.6},
+			Dot{X: 125, Y: y + 20, Speed: 3.5, Tilt: 1.4, Width: 4, Pressure: 0.75},
+		},
+	}
+}
+
+// v6Fixture encodes blocks in the v6 format.
+type v6Fixture struct {
+	buf bytes.Buffer
+}
+
+func (f *v6Fixture) reader() io.Reader {
+	return io.MultiReader(bytes.NewBufferString(headerV6), bytes.NewReader(f.buf.Bytes()))
+}
+
+func (f *v6Fixture) block(bt blockType, version uint8, content []byte) {
+	binary.Write(&f.buf, endianess, uint32(len(content)))
+	f.buf.Write([]byte{0, version, version, byte(bt)})
+	f.buf.Write(content)
+}
+
+func (f *v6Fixture) groupItem(parent, id, left, right, group crdtID) {
+	var value bytes.Buffer
+	value.WriteByte(0x02)
+	putID(&value, 2, group)
+
+	f.block(blockGroupItem, 1, itemHeader(parent, id, left, right, 0, value.Bytes()))
+}
+
+func (f *v6Fixture) lineItem(parent, id, left, right crdtID, version uint8, s Stroke) {
+	var value bytes.Buffer
+	value.WriteByte(0x03)
+	putTag(&value, 1, tagByte4)
+	binary.Write(&value, endianess, uint32(s.BrushType))
+	putTag(&value, 2, tagByte4)
+	binary.Write(&value, endianess, uint32(s.BrushColor))
+	putTag(&value, 3, tagByte8)
+	binary.Write(&value, endianess, float64(s.BrushSize))
+	putTag(&value, 4, tagByte4)
+	binary.Write(&value, endianess, float32(0))
+
+	var points bytes.Buffer
+	for _, d := range s.Dots {
+		x := d.X - MaxWidth/2
+		if version == 1 {
+			binary.Write(&points, endianess, []float32{x, d.Y, d.Speed, d.Tilt, d.Width, d.Pressure})
+		} else {
+			binary.Write(&points, endianess, x)
+			binary.Write(&points, endianess, d.Y)
+			binary.Write(&points, endianess, uint16(d.Speed*4))
+			binary.Write(&points, endianess, uint16(d.Width*4))
+			binary.Write(&points, endianess, uint8(math.Round(float64(d.Tilt)*255/(2*math.Pi))))
+			binary.Write(&points, endianess, uint8(math.Round(float64(d.Pressure)*255)))
+		}
+	}
+	putSubblock(&value, 5, points.Bytes())
+	putID(&value, 6, crdtID{1, 99})
+
+	f.block(blockLineItem, version, itemHeader(parent, id, left, right, 0, value.Bytes()))
+}
+
+type fixtureTextItem struct {
+	id   crdtID
+	left crdtID
+	text string
+}
+
+func (f *v6Fixture) rootText(x, y float64, width float32, items []fixtureTextItem, styles map[crdtID]ParagraphStyle) {
+	var entries bytes.Buffer
+	putVaruint(&entries, uint64(len(items)))
+	for _, item := range items {
+		var sub bytes.Buffer
+		putID(&sub, 2, item.id)
+		putID(&sub, 3, item.left)
+		putID(&sub, 4, endMarker)
+		putTag(&sub, 5, tagByte4)
+		binary.Write(&sub, endianess, uint32(0))
+		var str bytes.Buffer
+		putVaruint(&str, uint64(len(item.text)))
+		str.WriteByte(1)
+		str.WriteString(item.text)
+		putSubblock(&sub, 6, str.Bytes())
+		putSubblock(&entries, 0, sub.Bytes())
+	}
+	var itemsOuter bytes.Buffer
+	putSubblock(&itemsOuter, 1, entries.Bytes())
+
+	var formats bytes.Buffer
+	putVaruint(&formats, uint64(len(styles)))
+	for id, style := range styles {
+		formats.WriteByte(id.part1)
+		putVaruint(&formats, id.part2)
+		putID(&formats, 1, crdtID{1, 1})
+		putSubblock(&formats, 2, []byte{17, byte(style)})
+	}
+	var formatsOuter bytes.Buffer
+	putSubblock(&formatsOuter, 1, formats.Bytes())
+
+	var content bytes.Buffer
+	putSubblock(&content, 1, itemsOuter.Bytes())
+	putSubblock(&content, 2, formatsOuter.Bytes())
+
+	var pos bytes.Buffer
+	binary.Write(&pos, endianess, x)
+	binary.Write(&pos, endianess, y)
+
+	var buf bytes.Buffer
+	putID(&buf, 1, crdtID{0, 0})
+	putSubblock(&buf, 2, content.Bytes())
+	putSubblock(&buf, 3, pos.Bytes())
+	putTag(&buf, 4, tagByte4)
+	binary.Write(&buf, endianess, width)
+
+	f.block(blockRootText, 1, buf.Bytes())
+}
+
+func (f *v6Fixture) treeNode(id crdtID, label string, visible bool) {
+	var str bytes.Buffer
+	putVaruint(&str, uint64(len(label)))
+	str.WriteByte(1)
+	str.WriteString(label)
+
+	var lww bytes.Buffer
+	putID(&lww, 1, crdtID{1, 1})
+	putSubblock(&lww, 2, str.Bytes())
+
+	var vis bytes.Buffer
+	putID(&vis, 1, crdtID{1, 1})
+	putTag(&vis, 2, tagByte1)
+	if visible {
+		vis.WriteByte(1)
+	} else {
+		vis.WriteByte(0)
+	}
+
+	var buf bytes.Buffer
+	putID(&buf, 1, id)
+	putSubblock(&buf, 2, lww.Bytes())
+	putSubblock(&buf, 3, vis.Bytes())
+
+	f.block(blockTreeNode, 1, buf.Bytes())
+}
+
+func (f *v6Fixture) deletedItem(bt blockType, parent, id, left, right crdtID) {
+	f.block(bt, 1, itemHeader(parent, id, left, right, 1, nil))
+}
+
+func itemHeader(parent, id, left, right crdtID, deleted uint32, value []byte) []byte {
+	var buf bytes.Buffer
+	putID(&buf, 1, parent)
+	putID(&buf, 2, id)
+	putID(&buf, 3, left)
+	putID(&buf, 4, right)
+	putTag(&buf, 5, tagByte4)
+	binary.Write(&buf, endianess, deleted)
+	if value != nil {
+		putSubblock(&buf, 6, value)
+	}
+	return buf.Bytes()
+}
+
+func putTag(buf *bytes.Buffer, index uint64, t tagType) {
+	putVaruint(buf, index<<4|uint64(t))
+}
+
+func putVaruint(buf *bytes.Buffer, v uint64) {
+	b := make([]byte, binary.MaxVarintLen64)
+	n := binary.PutUvarint(b, v)
+	buf.Write(b[:n])
+}
+
+func putID(buf *bytes.Buffer, index uint64, id crdtID) {
+	putTag(buf, index, tagID)
+	buf.WriteByte(id.part1)
+	putVaruint(buf, id.part2)
+}
+
+func putSubblock(buf *bytes.Buffer, index uint64, content []byte) {
+	putTag(buf, index, tagLength4)
+	binary.Write(buf, endianess, uint32(len(content)))
+	buf.Write(content)
+}
@@ -0,0 +1,92 @@
+package lines
+
+import (
+	"strings"
+)
+
+// ParagraphStyle is the formatting for a paragraph of typed text.
+type ParagraphStyle uint8
+
+const (
+	StyleBasic           ParagraphStyle = 0
+	StylePlain           ParagraphStyle = 1
+	StyleHeading         ParagraphStyle = 2
+	StyleBold            ParagraphStyle = 3
+	StyleBullet          ParagraphStyle = 4
+	StyleBullet2         ParagraphStyle = 5
+	StyleCheckbox        ParagraphStyle = 6
+	StyleCheckboxChecked ParagraphStyle = 7
+)
+
+// Approximate line heights in pixels for the paragraph styles.
+// Used to estimate the vertical position of paragraphs.
+const (
+	lineHeightPlain   = 71
+	lineHeightHeading = 150
+)
+
+// Text is a block of typed text on a page.
+//
+// Typed text is only available for drawings in the v6 format.
+type Text struct {
+	// X is the x-coordinate for the top left corner of the text.
+	X float32
+	// Y is the y-coordinate for the top left corner of the text.
+	Y float32
+	// Width is the width of the text box.
+	Width float32
+	// Paragraphs are the paragraphs of text, in order.
+	Paragraphs []Paragraph
+}
+
+// Paragraph is a single paragraph of typed text.
+type Paragraph struct {
+	// Style is the formatting for this paragraph, e.g. a heading or bullet.
+	Style ParagraphStyle
+	// Text is the content of the paragraph, without the trailing newline.
+	Text string
+	// Y is the estimated y-coordinate for the top of this paragraph.
+	// The estimate does not account for paragraphs that wrap
+	// to more than one line.
+	Y float32
+}
+
+// String returns the complete text with paragraphs separated by newlines.
+func (t *Text) String() string {
+	parts := make([]string, len(t.Paragraphs))
+	for i, p := range t.Paragraphs {
+		parts[i] = p.Text
+	}
+	return strings.Join(parts, "\n")
+}
+
+// layout sets the estimated positions for all paragraphs.
+func (t *Text) layout() {
+	y := t.Y
+	for i := range t.Paragraphs {
+		t.Paragraphs[i].Y = y
+		y += t.Paragraphs[i].Style.lineHeight()
+	}
+}
+
+// IsHeading tells if this is a heading style.
+func (p ParagraphStyle) IsHeading() bool {
+	return p == StyleHeading
+}
+
+// IsBullet tells if this is a bullet point style.
+func (p ParagraphStyle) IsBullet() bool {
+	return p == StyleBullet || p == StyleBullet2
+}
+
+// IsCheckbox tells if this is a checkbox style, checked or unchecked.
+func (p ParagraphStyle) IsCheckbox() bool {
+	return p == StyleCheckbox || p == StyleCheckboxChecked
+}
+
+func (p ParagraphStyle) lineHeight() float32 {
+	if p.IsHeading() {
+		return lineHeightHeading
+	}
+	return lineHeightPlain
+}
@@ -10,7 +10,7 @@ import (
 // Validate checks this drawing and all layers, strokes and dots for valid data.
 // Returns an error if invalid data is found, nil if everything is fine.
 func (d *Drawing) Validate() error {
-	if d.Version != V3 && d.Version != V5 {
+	if d.Version != V3 && d.Version != V5 && d.Version != V6 {
 		return fmt.Errorf("invalid version: %v", d.Version)
 	}
 
@@ -38,7 +38,7 @@ func write(w io.Writer, d *Drawing) error {
 	}
 
 	for _, l := range d.Layers {
-		err = writeLayer(w, l)
+		err = writeLayer(w, l, d.Version)
 		if err != nil {
 			return err
 		}
@@ -54,6 +54,8 @@ func writeHeader(w io.Writer, d *Drawing) error {
 		h = headerV3
 	case V5:
 		h = headerV5
+	case V6:
+		return fmt.Errorf("writing version %v is not supported", d.Version)
 	default:
 		return fmt.Errorf("invalid version %v", d.Version)
 	}
@@ -62,7 +64,7 @@ func writeHeader(w io.Writer, d *Drawing) error {
 	return err
 }
 
-func writeLayer(w io.Writer, l Layer) error {
+func writeLayer(w io.Writer, l Layer, v Version) error {
 	numStrokes := uint32(len(l.Strokes))
 	err := binary.Write(w, endianess, numStrokes)
 	if err != nil {
@@ -70,7 +72,7 @@ func writeLayer(w io.Writer, l Layer) error {
 	}
 
 	for _, s := range l.Strokes {
-		err = writeStroke(w, s)
+		err = writeStroke(w, s, v)
 		if err != nil {
 			return err
 		}
@@ -78,7 +80,7 @@ func writeLayer(w io.Writer, l Layer) error {
 	return nil
 }
 
-func writeStroke(w io.Writer, s Stroke) error {
+func writeStroke(w io.Writer, s Stroke, v Version) error {
 	err := binary.Write(w, endianess, s.BrushType)
 	if err != nil {
 		return err
@@ -99,9 +101,12 @@ func writeStroke(w io.Writer, s Stroke) error {
 		return err
 	}
 
-	err = binary.Write(w, endianess, s.Unknown)
-	if err != nil {
-		return err
+	// additional attribute in v5 only
+	if v == V5 {
+		err = binary.Write(w, endianess, s.Unknown)
+		if err != nil {
+			return err
+		}
 	}
 
 	numDots := uint32(len(s.Dots))
@@ -0,0 +1,200 @@
+package lines
+
+import (
+	"bytes"
+	"math/rand"
+	"reflect"
+	"testing"
+	"testing/quick"
+)
+
+// quickDrawing generates random drawings for property-based tests.
+type quickDrawing struct {
+	*Drawing
+}
+
+func (quickDrawing) Generate(r *rand.Rand, size int) reflect.Value {
+	brushes := []BrushType{Ballpoint, Pencil, Marker, Eraser, BallpointV5, FinelinerV5, HighlighterV5}
+	v := V3
+	if r.Intn(2) == 1 {
+		v = V5
+	}
+
+	d := &Drawing{Version: v}
+	nLayers := 1 + r.Intn(3)
+	for i := 0; i < nLayers; i++ {
+		var l Layer
+		nStrokes := r.Intn(size + 1)
+		for j := 0; j < nStrokes; j++ {
+			s := Stroke{
+				BrushType:  brushes[r.Intn(len(brushes))],
+				BrushColor: BrushColor(r.Intn(3)),
+				BrushSize:  BrushSize(r.Float32() * 3),
+			}
+			if v == V5 {
+				s.Unknown = r.Float32()
+			}
+			nDots := r.Intn(size + 1)
+			for k := 0; k < nDots; k++ {
+				s.Dots = append(s.Dots, Dot{
+					X:        r.Float32() * MaxWidth,
+					Y:        r.Float32() * MaxHeight,
+					Speed:    r.Float32(),
+					Tilt:     r.Float32(),
+					Width:    r.Float32() * 10,
+					Pressure: r.Float32(),
+				})
+			}
+			l.Strokes = append(l.Strokes, s)
+		}
+		d.Layers = append(d.Layers, l)
+	}
+
+	return reflect.ValueOf(quickDrawing{d})
+}
+
+func TestWriteReadProperty(t *testing.T) {
+	roundTrip := func(q quickDrawing) bool {
+		d := q.Drawing
+		var buf bytes.Buffer
+		err := WriteDrawing(&buf, d)
+		if err != nil {
+			t.Log(err)
+			return false
+		}
+
+		x, err := ReadDrawing(&buf)
+		if err != nil {
+			t.Log(err)
+			return false
+		}
+
+		return drawingEqual(d, x)
+	}
+
+	err := quick.Check(roundTrip, &quick.Config{MaxCount: 200})
+	if err != nil {
+		t.Error(err)
+	}
+}
+
+func TestConvertToProperty(t *testing.T) {
+	// v3 -> v5 -> v3 keeps all brush types
+	convert := func(q quickDrawing) bool {
+		d := q.Drawing
+		err := d.ConvertTo(V3)
+		if err != nil {
+			return false
+		}
+		// the expected v3 drawing, after the first conversion
+		var expected bytes.Buffer
+		err = WriteDrawing(&expected, d)
+		if err != nil {
+			return false
+		}
+
+		err = d.ConvertTo(V5)
+		if err != nil {
+			return false
+		}
+		var buf bytes.Buffer
+		err = WriteDrawing(&buf, d)
+		if err != nil {
+			return false
+		}
+		x, err := ReadDrawing(&buf)
+		if err != nil {
+			return false
+		}
+		if x.Version != V5 {
+			return false
+		}
+
+		err = x.ConvertTo(V3)
+		if err != nil {
+			return false
+		}
+		var actual bytes.Buffer
+		err = WriteDrawing(&actual, x)
+		if err != nil {
+			return false
+		}
+
+		return bytes.Equal(expected.Bytes(), actual.Bytes())
+	}
+
+	err := quick.Check(convert, &quick.Config{MaxCount: 100})
+	if err != nil {
+		t.Error(err)
+	}
+}
+
+func TestConvertTo(t *testing.T) {
+	d := &Drawing{
+		Version: V5,
+		Layers: []Layer{
+			Layer{
+				Strokes: []Stroke{
+					Stroke{BrushType: BallpointV5},
+					Stroke{BrushType: Eraser},
+					Stroke{BrushType: CalligraphyV5},
+					// older brush in a v5 file
+					Stroke{BrushType: Fineliner},
+				},
+			},
+		},
+	}
+
+	err := d.ConvertTo(V3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []BrushType{Ballpoint, Eraser, PaintBrush, Fineliner}
+	for i, s := range d.Layers[0].Strokes {
+		if s.BrushType != expected[i] {
+			t.Errorf("wrong brush type after conversion to v3: %v != %v", s.BrushType, expected[i])
+		}
+	}
+
+	err = d.ConvertTo(V5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected = []BrushType{BallpointV5, Eraser, PaintBrushV5, FinelinerV5}
+	for i, s := range d.Layers[0].Strokes {
+		if s.BrushType != expected[i] {
+			t.Errorf("wrong brush type after conversion to v5: %v != %v", s.BrushType, expected[i])
+		}
+	}
+
+	// v6 cannot be written
+	err = d.ConvertTo(V6)
+	if err == nil {
+		t.Errorf("conversion to v6 should not be accepted")
+	}
+	if d.Version != V5 {
+		t.Errorf("failed conversion changed the version to %v", d.Version)
+	}
+
+	err = d.ConvertTo(Version(100))
+	if err == nil {
+		t.Errorf("invalid version should not be accepted")
+	}
+}
+
+func drawingEqual(a, b *Drawing) bool {
+	if a.Version != b.Version || len(a.Layers) != len(b.Layers) {
+		return false
+	}
+	for i := range a.Layers {
+		if len(a.Layers[i].Strokes) != len(b.Layers[i].Strokes) {
+			return false
+		}
+		for j := range a.Layers[i].Strokes {
+			if !strokeEqual(a.Layers[i].Strokes[j], b.Layers[i].Strokes[j]) {
+				return false
+			}
+		}
+	}
+	return true
+}
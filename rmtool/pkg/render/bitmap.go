@@ -97,14 +97,10 @@ func renderBackground(c *Context, dst draw.Image) {
 
 // renderLayoers paints all layers on the destination image.
 func renderLayers(c *Context, dst draw.Image, d *lines.Drawing) error {
+	// Eraser strokes are recorded, but the erased content is not deleted.
+	d = d.Flatten()
 	for _, l := range d.Layers {
 		for _, s := range l.Strokes {
-			// The erased content is deleted,
-			// but eraser strokes are recorded.
-			if s.BrushType == lines.Eraser || s.BrushType == lines.EraseArea {
-				continue
-			}
-
 			brush, err := c.loadBrush(s.BrushType, s.BrushColor)
 			if err != nil {
 				return err
@@ -219,8 +219,7 @@ func drawStamp(dst draw.Image, mask image.Image, fill image.Image, start, end li
 	// calculate the length of the segment
 	a := math.Abs(float64(start.Y - end.Y))
 	b := math.Abs(float64(start.X - end.X))
-	cSquared := math.Pow(a, float64(2.0)) + math.Pow(b, float64(2.0))
-	length := math.Sqrt(cSquared)
+	length := start.Distance(end)
 
 	stampSize := float64(h) / overlap // assumes stamps are quadratic
 	numStamps := math.Ceil((length / stampSize))
@@ -0,0 +1,105 @@
+package rescript
+
+import (
+	"bytes"
+	"encoding/base64"
+	"image"
+	"image/color"
+	"image/png"
+	"math"
+
+	"github.com/akeil/rmtool/pkg/lines"
+)
+
+const (
+	// sketchMargin is the white space around a sketch, in pixels.
+	sketchMargin = 10
+	// sketchPen is the radius of the pen for a sketch, in pixels.
+	sketchPen = 1.5
+)
+
+// Sketch is a drawing from a page that is included as an image.
+type Sketch struct {
+	// Bounds is the area of the page with the drawing, in pixels.
+	Bounds lines.Rect
+	// PNG is the image data.
+	PNG []byte
+}
+
+// DataURI returns the image as a "data:" URI
+// that can be embedded in markdown or HTML.
+func (s Sketch) DataURI() string {
+	return "data:image/png;base64," + base64.StdEncoding.EncodeToString(s.PNG)
+}
+
+// renderSketch paints the strokes to a PNG image.
+//
+// The image is cropped to the strokes, with a small margin.
+// All strokes are painted black with the same width.
+func renderSketch(groups []StrokeGroup) (Sketch, error) {
+	var sk Sketch
+	first := true
+	for _, g := range groups {
+		for _, s := range g.Strokes {
+			for i := range s.X {
+				p := lines.Point{X: float32(s.X[i]), Y: float32(s.Y[i])}
+				r := lines.Rect{Min: p, Max: p}
+				if first {
+					sk.Bounds = r
+					first = false
+				} else {
+					sk.Bounds = sk.Bounds.Union(r)
+				}
+			}
+		}
+	}
+
+	x0 := int(sk.Bounds.Min.X) - sketchMargin
+	y0 := int(sk.Bounds.Min.Y) - sketchMargin
+	w := int(sk.Bounds.Dx()) + 2*sketchMargin + 1
+	h := int(sk.Bounds.Dy()) + 2*sketchMargin + 1
+	img := image.NewGray(image.Rect(0, 0, w, h))
+	for i := range img.Pix {
+		img.Pix[i] = 0xff
+	}
+
+	for _, g := range groups {
+		for _, s := range g.Strokes {
+			for i := range s.X {
+				ax, ay := float64(s.X[i]-x0), float64(s.Y[i]-y0)
+				if i == 0 {
+					stamp(img, ax, ay)
+					continue
+				}
+				bx, by := float64(s.X[i-1]-x0), float64(s.Y[i-1]-y0)
+				steps := math.Max(1, math.Ceil(math.Hypot(ax-bx, ay-by)))
+				for k := 1.0; k <= steps; k++ {
+					t := k / steps
+					stamp(img, bx+t*(ax-bx), by+t*(ay-by))
+				}
+			}
+		}
+	}
+
+	var buf bytes.Buffer
+	err := png.Encode(&buf, img)
+	if err != nil {
+		return sk, err
+	}
+	sk.PNG = buf.Bytes()
+
+	return sk, nil
+}
+
+// stamp paints a dot with the sketch pen at the given position.
+func stamp(img *image.Gray, x, y float64) {
+	r := int(math.Ceil(sketchPen))
+	for dy := -r; dy <= r; dy++ {
+		for dx := -r; dx <= r; dx++ {
+			px, py := int(math.Round(x))+dx, int(math.Round(y))+dy
+			if math.Hypot(float64(px)-x, float64(py)-y) <= sketchPen {
+				img.SetGray(px, py, color.Gray{})
+			}
+		}
+	}
+}
@@ -0,0 +1,255 @@
+package rescript
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// StageConfig selects and configures a pipeline stage.
+//
+// Only some stages have options;
+// the options that do not apply to a stage are ignored.
+type StageConfig struct {
+	// Name is the registered name of the stage, e.g. "dehyphenate".
+	Name string `yaml:"stage"`
+	// Pattern is the regular expression for the "replace" stage.
+	Pattern string `yaml:"pattern,omitempty"`
+	// Replace is the replacement for the "replace" stage.
+	// It can refer to groups in the pattern, e.g. "$1".
+	Replace string `yaml:"replace,omitempty"`
+	// Abbreviations maps abbreviations to their expansion
+	// for the "expand-abbreviations" stage.
+	Abbreviations map[string]string `yaml:"abbreviations,omitempty"`
+}
+
+// StageFactory creates a pipeline stage from its configuration.
+type StageFactory func(c StageConfig) (PipelineFunc, error)
+
+var stages = map[string]StageFactory{
+	"reflow":               stage(Reflow),
+	"dehyphenate":          stage(Dehyphenate),
+	"normalize-quotes":     stage(NormalizeQuotes),
+	"fix-spacing":          stage(FixSpacing),
+	"capitalize":           stage(CapitalizeSentences),
+	"expand-abbreviations": newAbbreviationsStage,
+	"replace":              newReplaceStage,
+	"tasks":                stage(DetectTasks),
+	"lists":                stage(DetectLists),
+	"headings":             stage(DetectHeadings),
+	"emphasis":             stage(DetectEmphasis),
+}
+
+// RegisterStage makes a pipeline stage available under the given name.
+// A stage that is already registered with the same name is replaced.
+//
+// RegisterStage is not safe for concurrent use;
+// stages should be registered during initialization.
+func RegisterStage(name string, f StageFactory) {
+	stages[name] = f
+}
+
+// StageNames returns the names of all registered stages.
+func StageNames() []string {
+	names := make([]string, 0, len(stages))
+	for name := range stages {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// NewStage creates the pipeline stage for the given configuration.
+func NewStage(c StageConfig) (PipelineFunc, error) {
+	f, ok := stages[c.Name]
+	if !ok {
+		return nil, fmt.Errorf("unknown pipeline stage %q", c.Name)
+	}
+	return f(c)
+}
+
+// NewPipeline creates a pipeline with the configured stages, in order.
+func NewPipeline(cs []StageConfig) (PipelineFunc, error) {
+	p := make([]PipelineFunc, len(cs))
+	for i, c := range cs {
+		f, err := NewStage(c)
+		if err != nil {
+			return nil, err
+		}
+		p[i] = f
+	}
+	return BuildPipeline(p...), nil
+}
+
+func stage(f PipelineFunc) StageFactory {
+	return func(c StageConfig) (PipelineFunc, error) {
+		return f, nil
+	}
+}
+
+func newAbbreviationsStage(c StageConfig) (PipelineFunc, error) {
+	if len(c.Abbreviations) == 0 {
+		return nil, fmt.Errorf("no abbreviations for stage %q", c.Name)
+	}
+	return NewAbbreviationsFunc(c.Abbreviations), nil
+}
+
+func newReplaceStage(c StageConfig) (PipelineFunc, error) {
+	f, err := NewReplaceFunc(c.Pattern, c.Replace)
+	if err != nil {
+		return nil, fmt.Errorf("invalid pattern for stage %q: %v", c.Name, err)
+	}
+	return f, nil
+}
+
+var quoteReplacer = strings.NewReplacer(
+	"“", "\"",
+	"”", "\"",
+	"„", "\"",
+	"‟", "\"",
+	"«", "\"",
+	"»", "\"",
+	"‘", "'",
+	"’", "'",
+	"‚", "'",
+	"‛", "'",
+)
+
+// NormalizeQuotes replaces typographic quotes with plain ASCII quotes.
+func NormalizeQuotes(l *TokenList) *TokenList {
+	it := l.Iter()
+	for it.Next() {
+		t := it.Token()
+		s := quoteReplacer.Replace(t.String())
+		if s != t.String() {
+			it.Node().Update(t.resolve(s))
+		}
+	}
+	return l
+}
+
+// FixSpacing removes spaces before punctuation like "." or ","
+// and after an opening parenthesis.
+// Consecutive spaces are reduced to a single one.
+func FixSpacing(l *TokenList) *TokenList {
+	it := l.Iter()
+	for it.Next() {
+		node := it.Node()
+		next := node.Next()
+		if next == nil {
+			break
+		}
+		t := node.Token()
+		switch {
+		case isSpace(t) && (isSpace(next.Token()) || closesSpace(next.Token())):
+			node.Remove()
+		case t.String() == "(" && isSpace(next.Token()):
+			next.Remove()
+		}
+	}
+	return l
+}
+
+// CapitalizeSentences makes the first word of each sentence start
+// with an uppercase letter.
+//
+// A sentence starts at the beginning of the text and after ".", "!" or "?".
+func CapitalizeSentences(l *TokenList) *TokenList {
+	start := true
+	it := l.Iter()
+	for it.Next() {
+		t := it.Token()
+		s := t.String()
+		switch {
+		case s == "." || s == "!" || s == "?":
+			start = true
+		case t.IsWhitespace() || t.IsPunctuation():
+			// opening quotes, list markers, ...
+		case len(t.runes) != 0 && unicode.IsLetter(t.runes[0]):
+			if start && !t.StartsUpper() {
+				r := []rune(s)
+				r[0] = unicode.ToUpper(r[0])
+				it.Node().Update(t.resolve(string(r)))
+			}
+			start = false
+		default:
+			start = false
+		}
+	}
+	return l
+}
+
+// NewAbbreviationsFunc creates a PipelineFunc that expands abbreviations.
+//
+// The keys of the map are abbreviations, matched against single words.
+// If an abbreviation ends with ".", the word must be followed by a period
+// which is replaced together with the word.
+func NewAbbreviationsFunc(abbr map[string]string) PipelineFunc {
+	return func(l *TokenList) *TokenList {
+		for node := l.First(); node != nil; {
+			word := node.Token().String()
+			next := node.Next()
+			if exp, ok := abbr[word]; ok {
+				l.ReplaceRange(node, node, tokenize(exp)...)
+			} else if next != nil && next.Token().String() == "." {
+				if exp, ok := abbr[word+"."]; ok {
+					after := next.Next()
+					l.ReplaceRange(node, next, tokenize(exp)...)
+					next = after
+				}
+			}
+			node = next
+		}
+		return l
+	}
+}
+
+// NewReplaceFunc creates a PipelineFunc that replaces text matching
+// a regular expression.
+//
+// The expression is applied to each line.
+// Lines with math or diagrams are skipped.
+// Lines that are changed lose the position of their words,
+// so this should come after layout related stages.
+func NewReplaceFunc(pattern, replace string) (PipelineFunc, error) {
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, err
+	}
+
+	return func(l *TokenList) *TokenList {
+		for _, line := range tokenLines(l.First()) {
+			if len(line.nodes) == 0 || line.hasBlock() {
+				continue
+			}
+			var sb strings.Builder
+			for _, node := range line.nodes {
+				sb.WriteString(node.Token().String())
+			}
+			text := sb.String()
+			replaced := re.ReplaceAllString(text, replace)
+			if replaced != text {
+				l.ReplaceRange(line.nodes[0], line.nodes[len(line.nodes)-1], tokenize(replaced)...)
+			}
+		}
+		return l
+	}, nil
+}
+
+// isSpace tells if t is whitespace, but not a newline.
+func isSpace(t *Token) bool {
+	return t.IsWhitespace() && !t.IsNewline()
+}
+
+// closesSpace tells if t is punctuation that should directly follow
+// the preceding word.
+func closesSpace(t *Token) bool {
+	switch t.String() {
+	case ".", ",", ";", ":", "!", "?", ")":
+		return true
+	default:
+		return false
+	}
+}
@@ -0,0 +1,109 @@
+package rescript
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/yaml.v2"
+)
+
+func TestNewPipeline(t *testing.T) {
+	assert := assert.New(t)
+
+	var cfg []StageConfig
+	err := yaml.Unmarshal([]byte(`
+- stage: dehyphenate
+- stage: replace
+  pattern: "(\\d+) ?EUR"
+  replace: "€$1"
+- stage: capitalize
+`), &cfg)
+	assert.Nil(err)
+
+	p, err := NewPipeline(cfg)
+	assert.Nil(err)
+
+	l := p(buildSampleList("pay", " ", "10", " ", "EUR", " ", "for", " ", "tick", "-", "\n", "ets"))
+	assert.Equal("Pay €10 for tickets", l.String())
+
+	_, err = NewPipeline([]StageConfig{{Name: "dehyphenate"}, {Name: "unknown"}})
+	assert.Error(err)
+
+	_, err = NewStage(StageConfig{Name: "replace", Pattern: "("})
+	assert.Error(err)
+
+	_, err = NewStage(StageConfig{Name: "expand-abbreviations"})
+	assert.Error(err)
+}
+
+func TestRegisterStage(t *testing.T) {
+	assert := assert.New(t)
+
+	RegisterStage("test-upper", func(c StageConfig) (PipelineFunc, error) {
+		return func(l *TokenList) *TokenList {
+			return NewTokenList(NewToken("UPPER"))
+		}, nil
+	})
+	defer delete(stages, "test-upper")
+
+	assert.Contains(StageNames(), "test-upper")
+	assert.Contains(StageNames(), "dehyphenate")
+
+	f, err := NewStage(StageConfig{Name: "test-upper"})
+	assert.Nil(err)
+	assert.Equal("UPPER", f(buildSampleList("foo")).String())
+}
+
+func TestNormalizeQuotes(t *testing.T) {
+	assert := assert.New(t)
+
+	l := NormalizeQuotes(buildSampleList("„", "Don’t", "“", " ", "‘", "x", "’"))
+	assert.Equal("\"Don't\" 'x'", l.String())
+}
+
+func TestFixSpacing(t *testing.T) {
+	assert := assert.New(t)
+
+	l := FixSpacing(buildSampleList("foo", " ", ",", " ", " ", "bar", " ", "(", " ", "baz", " ", ")", " ", "!", "\n", " ", "."))
+	assert.Equal("foo, bar (baz)!\n.", l.String())
+}
+
+func TestCapitalizeSentences(t *testing.T) {
+	assert := assert.New(t)
+
+	l := CapitalizeSentences(buildSampleList(
+		"\"", "hello", "\"", " ", "world", ".", " ",
+		"what", "?", "\n", "2", " ", "apples", "!", " ", "ok"))
+	assert.Equal("\"Hello\" world. What?\n2 apples! Ok", l.String())
+}
+
+func TestExpandAbbreviations(t *testing.T) {
+	assert := assert.New(t)
+
+	f := NewAbbreviationsFunc(map[string]string{
+		"asap":    "as soon as possible",
+		"approx.": "approximately",
+	})
+
+	l := f(buildSampleList("asap", " ", "approx", ".", " ", "10", " ", "approx", " ", "asap", "."))
+	assert.Equal("as soon as possible approximately 10 approx as soon as possible.", l.String())
+	// words are separate tokens
+	assert.Equal("as", l.First().Token().String())
+}
+
+func TestReplace(t *testing.T) {
+	assert := assert.New(t)
+
+	f, err := NewReplaceFunc(`^TODO:?\s*`, "")
+	assert.Nil(err)
+
+	l := f(buildSampleList("TODO", ":", " ", "call", "\n", "\n", "no", " ", "TODO"))
+	assert.Equal("call\n\nno TODO", l.String())
+
+	// the whole line is removed
+	l = f(buildSampleList("foo", "\n", "TODO", "\n", "bar"))
+	assert.Equal("foo\n\nbar", l.String())
+
+	_, err = NewReplaceFunc("[", "")
+	assert.Error(err)
+}
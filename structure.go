@@ -0,0 +1,554 @@
+package rescript
+
+import (
+	"regexp"
+	"sort"
+
+	"github.com/akeil/rmtool/pkg/lines"
+)
+
+// The functions in this file add markdown syntax to the recognized text.
+// They are meant to be used with the markdown composer and should run
+// in this order:
+//
+//	DetectTasks, DetectLists, DetectHeadings, DetectEmphasis
+
+const (
+	// headingScale is the minimum ratio between the ink height of a heading
+	// and the typical ink height on the page.
+	headingScale = 1.4
+	// headingScaleLarge is the ratio for a top-level heading.
+	headingScaleLarge = 2.0
+	// headingMaxWords is the maximum number of words in a heading.
+	headingMaxWords = 8
+	// underlineRatio is the minimum ratio of width to height for an underline.
+	underlineRatio = 4.0
+	// circleRatio is the minimum ratio between the size of a circle
+	// and the size of the words it encloses, in both directions.
+	circleRatio = 1.2
+	// circleSlack is the part of a word's height
+	// that may stick out of a circle.
+	circleSlack = 0.2
+)
+
+var (
+	numberRe      = regexp.MustCompile(`^\d+$`)
+	orderedItemRe = regexp.MustCompile(`^\d+[.)]$`)
+	underlineRe   = regexp.MustCompile(`^[-_~=\x{2010}-\x{2015}]+$`)
+)
+
+// DetectTasks turns lines that start with a hand-drawn box into task items.
+//
+// A box is recognized as a symbol like "☐" or as "[ ]";
+// a crossed or checked box ("☑", "☒", "[x]") becomes a completed task.
+// Uncertain tokens are accepted if one of their candidates is a box.
+func DetectTasks(l *TokenList) *TokenList {
+	n := l.First()
+	if n == nil {
+		return l
+	}
+
+	for _, l := range tokenLines(n) {
+		start := l.content()
+		if start == nil {
+			continue
+		}
+		end, checked, ok := taskBox(start)
+		if !ok {
+			continue
+		}
+
+		// replace the box with a single token
+		for end != start {
+			prev := end.Prev()
+			end.Remove()
+			end = prev
+		}
+		box := "[ ]"
+		if checked {
+			box = "[x]"
+		}
+		start.Update(NewToken(box))
+		start.InsertBefore(NewNode(NewToken(" ")))
+		start.Prev().InsertBefore(NewNode(NewToken("-")))
+		spaceAfter(start)
+	}
+
+	return l
+}
+
+// DetectLists formats lines starting with "-", "*" or a number like "1."
+// as markdown list items.
+//
+// Bullets are replaced with "-" and a missing space after the list marker
+// is added. Consecutive list items are separated from the surrounding text
+// by an empty line.
+func DetectLists(l *TokenList) *TokenList {
+	n := l.First()
+	if n == nil {
+		return l
+	}
+
+	ls := tokenLines(n)
+	items := make([]bool, len(ls))
+	for i, l := range ls {
+		start := l.content()
+		marker, ok := listMarker(start)
+		if !ok {
+			continue
+		}
+		items[i] = true
+		if marker == start && !orderedItemRe.MatchString(start.Token().String()) {
+			start.Update(NewToken("-"))
+		}
+		spaceAfter(marker)
+	}
+
+	for i, l := range ls {
+		if !items[i] {
+			continue
+		}
+		// first item
+		if i > 0 && !items[i-1] && !ls[i-1].empty() {
+			ls[i-1].end.InsertAfter(NewNode(NewToken("\n")))
+		}
+		// last item
+		if i < len(ls)-1 && !items[i+1] && !ls[i+1].empty() {
+			l.end.InsertAfter(NewNode(NewToken("\n")))
+		}
+	}
+
+	return l
+}
+
+// DetectHeadings formats short lines in larger handwriting as headings.
+//
+// A heading is the first line of a paragraph with no more than a few words
+// and a bounding box that is clearly higher than the text on the rest
+// of the page. Headings are level two or three ("##", "###"),
+// as the document title is the top-level heading.
+func DetectHeadings(l *TokenList) *TokenList {
+	n := l.First()
+	if n == nil {
+		return l
+	}
+
+	ls := tokenLines(n)
+	var heights []float64
+	for node := n; node != nil; node = node.Next() {
+		if h, ok := inkHeight(node.Token()); ok {
+			heights = append(heights, h)
+		}
+	}
+	if len(heights) == 0 {
+		return l
+	}
+	typical := median(heights)
+
+	for i, l := range ls {
+		start := l.content()
+		if start == nil || (i > 0 && !ls[i-1].empty()) {
+			continue
+		}
+		if _, ok := listMarker(start); ok {
+			continue
+		}
+
+		var lh []float64
+		words := 0
+		var last *Token
+		for _, node := range l.nodes {
+			t := node.Token()
+			if t.IsWhitespace() {
+				continue
+			}
+			last = t
+			if !t.IsPunctuation() {
+				words++
+			}
+			if h, ok := inkHeight(t); ok {
+				lh = append(lh, h)
+			}
+		}
+		// the line must be short and there must be other text on the page
+		if len(lh) == 0 || words > headingMaxWords || len(lh) == len(heights) {
+			continue
+		}
+		if s := last.String(); s == "." || s == "," || s == ";" {
+			continue
+		}
+
+		scale := median(lh) / typical
+		if scale < headingScale {
+			continue
+		}
+		marker := "###"
+		if scale >= headingScaleLarge {
+			marker = "##"
+		}
+		start.InsertBefore(NewNode(NewToken(marker)))
+		start.InsertBefore(NewNode(NewToken(" ")))
+
+		if i < len(ls)-1 && !ls[i+1].empty() {
+			l.end.InsertAfter(NewNode(NewToken("\n")))
+		}
+	}
+
+	return l
+}
+
+// DetectEmphasis emphasizes words that are underlined or circled.
+//
+// An underline is a long, flat stroke recognized as a dash or underscore
+// directly below one or more words.
+// A circle is a token recognized as a circle ("O", "0", "○")
+// whose bounding box encloses other words with some room to spare.
+// The underline or circle is removed from the text
+// and the words are wrapped in "*".
+//
+// DetectEmphasis should run after DetectLists,
+// as emphasis at the start of a line looks like a list marker.
+func DetectEmphasis(l *TokenList) *TokenList {
+	n := l.First()
+	if n == nil {
+		return l
+	}
+
+	var nodes []*Node
+	for node := n; node != nil; node = node.Next() {
+		nodes = append(nodes, node)
+	}
+
+	emphasized := make(map[*Node]bool)
+	shapes := make(map[*Node]bool)
+	for _, s := range nodes {
+		var marked []*Node
+		if isUnderline(s.Token()) {
+			marked = underlined(s, nodes)
+		} else if isCircleCandidate(s.Token()) {
+			marked = enclosed(s, nodes)
+		}
+		if len(marked) == 0 {
+			continue
+		}
+		shapes[s] = true
+		for _, m := range marked {
+			emphasized[m] = true
+		}
+	}
+	if len(shapes) == 0 {
+		return l
+	}
+
+	for _, node := range nodes {
+		if shapes[node] {
+			removeShape(node)
+		}
+	}
+
+	// wrap runs of emphasized words, allowing single spaces in between
+	var runStart, runEnd *Node
+	flush := func() {
+		if runStart != nil {
+			runStart.InsertBefore(NewNode(NewToken("*")))
+			runEnd.InsertAfter(NewNode(NewToken("*")))
+		}
+		runStart, runEnd = nil, nil
+	}
+	for node := l.First(); node != nil; node = node.Next() {
+		t := node.Token()
+		switch {
+		case emphasized[node]:
+			if runStart == nil {
+				runStart = node
+			}
+			runEnd = node
+		case runStart != nil && t.IsWhitespace() && !t.IsNewline():
+			if next := node.Next(); next == nil || !emphasized[next] {
+				flush()
+			}
+		default:
+			flush()
+		}
+	}
+	flush()
+
+	return l
+}
+
+// tokenLine is a line of tokens, without the terminating newline.
+type tokenLine struct {
+	nodes []*Node
+	// end is the newline after the line, nil for the last line.
+	end *Node
+}
+
+// tokenLines splits the token list at newlines, including empty lines.
+func tokenLines(n *Node) []tokenLine {
+	var result []tokenLine
+	current := tokenLine{}
+	for node := n; node != nil; node = node.Next() {
+		if node.Token().IsNewline() {
+			current.end = node
+			result = append(result, current)
+			current = tokenLine{}
+			continue
+		}
+		current.nodes = append(current.nodes, node)
+	}
+	return append(result, current)
+}
+
+// content returns the first node in the line that is not whitespace.
+func (l tokenLine) content() *Node {
+	for _, node := range l.nodes {
+		if !node.Token().IsWhitespace() {
+			return node
+		}
+	}
+	return nil
+}
+
+func (l tokenLine) empty() bool {
+	return l.content() == nil
+}
+
+// hasBlock tells if the line contains a math or diagram token.
+func (l tokenLine) hasBlock() bool {
+	for _, node := range l.nodes {
+		if node.Token().IsBlock() {
+			return true
+		}
+	}
+	return false
+}
+
+// listMarker checks if a list item starts with the given node.
+// It returns the last node of the list marker.
+func listMarker(n *Node) (*Node, bool) {
+	if n == nil {
+		return nil, false
+	}
+	s := n.Token().String()
+	switch {
+	case n.Token().IsDash() || s == "*" || s == "•" || s == "·":
+		return n, hasContent(n.Next())
+	case orderedItemRe.MatchString(s):
+		return n, hasContent(n.Next())
+	case numberRe.MatchString(s):
+		next := n.Next()
+		if next != nil && (next.Token().String() == "." || next.Token().String() == ")") {
+			return next, hasContent(next.Next())
+		}
+	}
+	return nil, false
+}
+
+// startsItem tells if a list or task item starts with the given node.
+func startsItem(n *Node) bool {
+	if _, ok := listMarker(n); ok {
+		return true
+	}
+	_, _, ok := taskBox(n)
+	return ok
+}
+
+// taskBox checks if a task box starts with the given node.
+// It returns the last node of the box and whether the box is checked.
+func taskBox(n *Node) (*Node, bool, bool) {
+	if n == nil {
+		return nil, false, false
+	}
+	t := n.Token()
+	if checked, ok := boxSymbol(t.String()); ok {
+		return n, checked, true
+	}
+	if t.isSingle() {
+		for _, c := range t.Candidates() {
+			if checked, ok := boxSymbol(c); ok {
+				return n, checked, true
+			}
+		}
+	}
+
+	// "[", optional " " or "x", "]"
+	if t.String() != "[" {
+		return nil, false, false
+	}
+	checked := false
+	end := n.Next()
+	if end != nil {
+		switch end.Token().String() {
+		case " ":
+			end = end.Next()
+		case "x", "X":
+			checked = true
+			end = end.Next()
+		}
+	}
+	if end == nil || end.Token().String() != "]" {
+		return nil, false, false
+	}
+	return end, checked, true
+}
+
+// boxSymbol tells if s is a box and if the box is checked.
+func boxSymbol(s string) (bool, bool) {
+	switch s {
+	case "□", "☐", "▢", "[]", "[ ]":
+		return false, true
+	case "☑", "☒", "[x]", "[X]":
+		return true, true
+	default:
+		return false, false
+	}
+}
+
+// hasContent tells if there is a non-whitespace token
+// between n and the end of the line.
+func hasContent(n *Node) bool {
+	for node := n; node != nil; node = node.Next() {
+		t := node.Token()
+		if t.IsNewline() {
+			return false
+		}
+		if !t.IsWhitespace() {
+			return true
+		}
+	}
+	return false
+}
+
+// spaceAfter makes sure that n is followed by a single space.
+func spaceAfter(n *Node) {
+	next := n.Next()
+	if next != nil && next.Token().IsWhitespace() && !next.Token().IsNewline() {
+		next.Update(NewToken(" "))
+		return
+	}
+	n.InsertAfter(NewNode(NewToken(" ")))
+}
+
+// inkHeight returns the height of a positioned word.
+func inkHeight(t *Token) (float64, bool) {
+	b, ok := t.Bounds()
+	if !ok || t.IsWhitespace() || t.IsPunctuation() {
+		return 0, false
+	}
+	return float64(b.Dy()), true
+}
+
+func isUnderline(t *Token) bool {
+	b, ok := t.Bounds()
+	if !ok || !underlineRe.MatchString(t.String()) {
+		return false
+	}
+	return float64(b.Dx()) >= underlineRatio*float64(b.Dy())
+}
+
+func isCircleCandidate(t *Token) bool {
+	if _, ok := t.Bounds(); !ok {
+		return false
+	}
+	if circleSymbol(t.String()) {
+		return true
+	}
+	if t.isSingle() {
+		for _, c := range t.Candidates() {
+			if circleSymbol(c) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// circleSymbol tells if s is a recognized circle.
+func circleSymbol(s string) bool {
+	switch s {
+	case "O", "o", "0", "○", "◯", "⭕", "()":
+		return true
+	default:
+		return false
+	}
+}
+
+// underlined returns the words directly above the underline u.
+func underlined(u *Node, nodes []*Node) []*Node {
+	ub, _ := u.Token().Bounds()
+	var result []*Node
+	for _, node := range nodes {
+		t := node.Token()
+		b, ok := t.Bounds()
+		if node == u || !ok || t.IsWhitespace() {
+			continue
+		}
+		cx := (b.Min.X + b.Max.X) / 2
+		cy := (b.Min.Y + b.Max.Y) / 2
+		// below the middle of the word, but not further than half its height
+		if cx < ub.Min.X || cx > ub.Max.X {
+			continue
+		}
+		if ub.Min.Y < cy || ub.Min.Y > b.Max.Y+b.Dy()/2 {
+			continue
+		}
+		result = append(result, node)
+	}
+	return result
+}
+
+// enclosed returns the words within the bounding box of the circle c.
+//
+// Words must lie inside the circle, except for a small part of their height.
+// The circle must be larger than the enclosed words by circleRatio,
+// otherwise it is probably a letter that overlaps its neighbour.
+func enclosed(c *Node, nodes []*Node) []*Node {
+	cb, _ := c.Token().Bounds()
+	var result []*Node
+	var inner lines.Rect
+	for _, node := range nodes {
+		t := node.Token()
+		b, ok := t.Bounds()
+		if node == c || !ok || t.IsWhitespace() || t.IsPunctuation() {
+			continue
+		}
+		slack := circleSlack * b.Dy()
+		if b.Min.X < cb.Min.X-slack || b.Max.X > cb.Max.X+slack ||
+			b.Min.Y < cb.Min.Y-slack || b.Max.Y > cb.Max.Y+slack {
+			continue
+		}
+		if len(result) == 0 {
+			inner = b
+		} else {
+			inner = inner.Union(b)
+		}
+		result = append(result, node)
+	}
+
+	if len(result) == 0 ||
+		float64(cb.Dx()) < circleRatio*float64(inner.Dx()) ||
+		float64(cb.Dy()) < circleRatio*float64(inner.Dy()) {
+		return nil
+	}
+	return result
+}
+
+// removeShape removes the token for an underline or circle
+// together with the whitespace that separates it from the text.
+func removeShape(n *Node) {
+	var candidates []*Node
+	if next := n.Next(); next != nil && next.Token().IsWhitespace() {
+		candidates = append(candidates, next)
+	}
+	if prev := n.Prev(); prev != nil && prev.Token().IsWhitespace() {
+		candidates = append(candidates, prev)
+	}
+	// prefer to remove a space over a newline
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return !candidates[i].Token().IsNewline() && candidates[j].Token().IsNewline()
+	})
+	if len(candidates) != 0 {
+		candidates[0].Remove()
+	}
+	n.Remove()
+}
@@ -0,0 +1,163 @@
+package rescript
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDetectLists(t *testing.T) {
+	assert := assert.New(t)
+
+	n := buildSampleList(
+		"Shopping", "\n",
+		"*", "milk", "\n",
+		"-", " ", "eggs", "\n",
+		"1", ".", "bread", "\n",
+		"2)", " ", "butter", "\n",
+		"done", " ", "-", " ", "really", "\n",
+		"-", "\n",
+		"\n",
+		"•", " ", "last")
+	n = DetectLists(n)
+
+	expected := "Shopping\n\n- milk\n- eggs\n1. bread\n2) butter\n\ndone - really\n-\n\n- last"
+	assert.Equal(expected, n.String())
+
+	assert.Equal(0, DetectLists(NewTokenList()).Len())
+}
+
+func TestDetectTasks(t *testing.T) {
+	assert := assert.New(t)
+
+	n := buildSampleList(
+		"Todo", "\n",
+		"☐", "call", "\n",
+		"[", "x", "]", " ", "pay", "\n",
+		"[", " ", "]", " ", "read", "\n",
+		"Other", " ", "[", "]")
+	n = DetectTasks(n)
+	assert.Equal("Todo\n- [ ] call\n- [x] pay\n- [ ] read\nOther []", n.String())
+
+	// the box at the start of the list
+	uncertain := wordToken(Word{Label: "O", Candidates: []string{"O", "☐"}})
+	n = DetectTasks(NewTokenList(uncertain, NewToken("write")))
+	assert.Equal("- [ ] write", n.String())
+
+	// tasks are list items
+	n = buildSampleList("Todo", "\n", "☒", " ", "done", "\n", "Next")
+	n = DetectLists(DetectTasks(n))
+	assert.Equal("Todo\n\n- [x] done\n\nNext", n.String())
+}
+
+func TestDetectHeadings(t *testing.T) {
+	assert := assert.New(t)
+
+	r := Result{
+		Words: []Word{
+			sizedWord("Title", 100, 100, 400, 120),
+			layoutWord("\n", 0, 0, 0),
+			layoutWord("Some", 100, 260, 200),
+			layoutWord(" ", 0, 0, 0),
+			layoutWord("text", 320, 260, 200),
+			layoutWord(" ", 0, 0, 0),
+			layoutWord("on", 540, 260, 100),
+			layoutWord(" ", 0, 0, 0),
+			layoutWord("the", 660, 260, 150),
+			layoutWord(" ", 0, 0, 0),
+			layoutWord("page", 830, 260, 200),
+			layoutWord("\n", 0, 0, 0),
+			// not the first line of a paragraph
+			sizedWord("Large", 100, 340, 300, 120),
+			layoutWord("\n", 0, 0, 0),
+			layoutWord("\n", 0, 0, 0),
+			sizedWord("Section", 100, 600, 300, 90),
+			layoutWord("\n", 0, 0, 0),
+			layoutWord("more", 100, 720, 200),
+			layoutWord("\n", 0, 0, 0),
+			layoutWord("\n", 0, 0, 0),
+			// a sentence, not a heading
+			sizedWord("Big", 100, 900, 200, 120),
+			sizedWord(".", 310, 900, 20, 20),
+		},
+	}
+
+	n := DetectHeadings(ToTokenList(r))
+	expected := "## Title\n\nSome text on the page\nLarge\n\n### Section\n\nmore\n\nBig."
+	assert.Equal(expected, n.String())
+
+	// no positions
+	n = DetectHeadings(buildSampleList("Title", "\n", "text"))
+	assert.Equal("Title\ntext", n.String())
+}
+
+func TestDetectEmphasis(t *testing.T) {
+	assert := assert.New(t)
+
+	// underline below two words
+	r := Result{
+		Words: []Word{
+			layoutWord("very", 100, 100, 200),
+			layoutWord(" ", 0, 0, 0),
+			layoutWord("important", 320, 100, 300),
+			layoutWord(" ", 0, 0, 0),
+			layoutWord("word", 640, 100, 200),
+			layoutWord("\n", 0, 0, 0),
+			sizedWord("___", 90, 165, 540, 10),
+			layoutWord("\n", 0, 0, 0),
+			layoutWord("next", 100, 260, 200),
+		},
+	}
+	n := DetectEmphasis(ToTokenList(r))
+	assert.Equal("*very important* word\nnext", n.String())
+
+	// circle around a word
+	r = Result{
+		Words: []Word{
+			layoutWord("see", 100, 100, 150),
+			layoutWord(" ", 0, 0, 0),
+			layoutWord("this", 260, 100, 150),
+			layoutWord(" ", 0, 0, 0),
+			sizedWord("O", 240, 80, 200, 100),
+		},
+	}
+	n = DetectEmphasis(ToTokenList(r))
+	assert.Equal("see *this*", n.String())
+
+	// short words that overlap their neighbour are not circles
+	r = Result{
+		Words: []Word{
+			layoutWord("a", 100, 100, 60),
+			layoutWord(" ", 0, 0, 0),
+			layoutWord("I", 140, 90, 30),
+			layoutWord(" ", 0, 0, 0),
+			sizedWord("of", 180, 80, 120, 100),
+			layoutWord(" ", 0, 0, 0),
+			layoutWord("it", 200, 100, 50),
+		},
+	}
+	n = DetectEmphasis(ToTokenList(r))
+	assert.Equal("a I of it", n.String())
+
+	// an "O" that is not much larger than the word inside
+	r = Result{
+		Words: []Word{
+			sizedWord("O", 100, 100, 160, 62),
+			layoutWord(" ", 0, 0, 0),
+			layoutWord("word", 105, 101, 150),
+		},
+	}
+	n = DetectEmphasis(ToTokenList(r))
+	assert.Equal("O word", n.String())
+
+	// a hyphen is not an underline
+	r = Result{
+		Words: []Word{
+			layoutWord("well", 100, 100, 150),
+			sizedWord("-", 260, 120, 40, 5),
+			layoutWord("known", 310, 100, 200),
+		},
+	}
+	n = DetectEmphasis(ToTokenList(r))
+	assert.Equal("well-known", n.String())
+}
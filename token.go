@@ -2,6 +2,8 @@ package rescript
 
 import (
 	"unicode"
+
+	"github.com/akeil/rmtool/pkg/lines"
 )
 
 // Token represents a single text element that was reconized from the
@@ -12,13 +14,164 @@ import (
 // - consecutive whitespace is split into multiple tokens
 // - punctuation is a single token
 type Token struct {
-	text  string
-	runes []rune
+	text       string
+	runes      []rune
+	bounds     lines.Rect
+	hasBounds  bool
+	strokes    []lines.StrokeRef
+	candidates []string
+	xHeight    float64
+	math       *MathResult
+	diagram    *DiagramResult
+	sketch     *Sketch
 }
 
 // NewToken creates a new token with the given content.
 func NewToken(s string) *Token {
-	return &Token{s, []rune(s)}
+	return &Token{text: s, runes: []rune(s)}
+}
+
+// NewMathToken creates a block token for a recognized math expression.
+//
+// Block tokens have no text and no position,
+// so pipeline stages leave them alone; composers render them
+// from the recognition result.
+func NewMathToken(m MathResult) *Token {
+	return &Token{math: &m}
+}
+
+// NewDiagramToken creates a block token for a recognized diagram.
+func NewDiagramToken(d DiagramResult) *Token {
+	return &Token{diagram: &d}
+}
+
+// NewSketchToken creates a block token for a drawing.
+func NewSketchToken(s Sketch) *Token {
+	return &Token{sketch: &s}
+}
+
+// wordToken creates a token for a recognized word,
+// including its position and source strokes.
+func wordToken(w Word) *Token {
+	t := NewToken(w.Label)
+	if !w.BoundingBox.IsZero() {
+		t.bounds = toRect(w.BoundingBox)
+		t.hasBounds = true
+	}
+
+	t.candidates = w.Candidates
+
+	// the x-height is given per item; use the average.
+	n := 0
+	for _, item := range w.Items {
+		if item.XHeight > 0 {
+			t.xHeight += toPixels(item.XHeight)
+			n++
+		}
+	}
+	if n > 0 {
+		t.xHeight /= float64(n)
+	}
+
+	seen := make(map[lines.StrokeRef]bool)
+	for _, item := range w.Items {
+		ref, ok := parseStrokeID(item.ID)
+		if ok && !seen[ref] {
+			seen[ref] = true
+			t.strokes = append(t.strokes, ref)
+		}
+	}
+
+	return t
+}
+
+// Bounds returns the position of the token on the page, in pixels.
+// The second return value is false if the position is not known,
+// e.g. for typed text.
+func (t *Token) Bounds() (lines.Rect, bool) {
+	return t.bounds, t.hasBounds
+}
+
+// Strokes returns the strokes that make up this token, if known.
+func (t *Token) Strokes() []lines.StrokeRef {
+	return t.strokes
+}
+
+// XHeight returns the height of lowercase letters in pixels,
+// or 0 if it is not known.
+func (t *Token) XHeight() float64 {
+	return t.xHeight
+}
+
+// Math returns the math recognition result for a math token, or nil.
+func (t *Token) Math() *MathResult {
+	return t.math
+}
+
+// Diagram returns the diagram recognition result for a diagram token, or nil.
+func (t *Token) Diagram() *DiagramResult {
+	return t.diagram
+}
+
+// Sketch returns the image for a drawing token, or nil.
+func (t *Token) Sketch() *Sketch {
+	return t.sketch
+}
+
+// IsBlock tells if this token holds a math expression, a diagram
+// or a drawing rather than text.
+func (t *Token) IsBlock() bool {
+	return t.math != nil || t.diagram != nil || t.sketch != nil
+}
+
+// Candidates returns the alternative readings for a recognized word.
+//
+// The list is ordered by likelihood and usually includes the token's text.
+func (t *Token) Candidates() []string {
+	return t.candidates
+}
+
+// Alternatives returns the candidates that differ from the token's text.
+func (t *Token) Alternatives() []string {
+	alts := make([]string, 0, len(t.candidates))
+	for _, c := range t.candidates {
+		if c != t.text {
+			alts = append(alts, c)
+		}
+	}
+	return alts
+}
+
+// IsUncertain tells if the token's text is not the recognizer's
+// most likely reading, i.e. not the first candidate.
+//
+// MyScript offers alternatives for almost every word,
+// so alternatives alone do not make a token uncertain.
+func (t *Token) IsUncertain() bool {
+	return len(t.candidates) != 0 && t.candidates[0] != t.text
+}
+
+// certainty rates how sure the recognizer was about the token's text,
+// from 0 to 1.
+//
+// Uncertain tokens have a certainty of zero;
+// otherwise, each alternative reading lowers the certainty.
+func (t *Token) certainty() float64 {
+	if t.IsUncertain() {
+		return 0
+	}
+	return 1 / float64(len(t.Alternatives())+1)
+}
+
+// resolve creates a copy of this token with the given text
+// and no alternatives.
+func (t *Token) resolve(s string) *Token {
+	r := NewToken(s)
+	r.bounds = t.bounds
+	r.hasBounds = t.hasBounds
+	r.strokes = t.strokes
+	r.xHeight = t.xHeight
+	return r
 }
 
 func (t *Token) String() string {
@@ -4,6 +4,8 @@ import (
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+
+	"github.com/akeil/rmtool/pkg/lines"
 )
 
 func TestTokenIs(t *testing.T) {
@@ -43,3 +45,65 @@ func TestTokenIs(t *testing.T) {
 	assert.True(NewToken("-").IsDash())
 	assert.False(NewToken("_").IsDash())
 }
+
+func TestWordToken(t *testing.T) {
+	assert := assert.New(t)
+
+	w := Word{
+		Label:       "foo",
+		BoundingBox: BoundingBox{X: 25.4, Y: 50.8, Width: 2.54, Height: 5.08},
+		Items: []Item{
+			Item{ID: "0.3", Type: "stroke"},
+			Item{ID: "0.3", Type: "stroke"},
+			Item{ID: "1.12", Type: "stroke"},
+			Item{ID: "", Type: "glyph"},
+		},
+	}
+	tk := wordToken(w)
+
+	assert.Equal("foo", tk.String())
+	b, ok := tk.Bounds()
+	assert.True(ok)
+	assert.InDelta(96, b.Min.X, 0.001)
+	assert.InDelta(192, b.Min.Y, 0.001)
+	assert.InDelta(105.6, b.Max.X, 0.001)
+	assert.InDelta(211.2, b.Max.Y, 0.001)
+	assert.Equal([]lines.StrokeRef{{Layer: 0, Stroke: 3}, {Layer: 1, Stroke: 12}}, tk.Strokes())
+
+	_, ok = NewToken("bar").Bounds()
+	assert.False(ok)
+	assert.Empty(NewToken("bar").Strokes())
+}
+
+func TestConvertLayerIDs(t *testing.T) {
+	assert := assert.New(t)
+
+	stroke := func(x float32) lines.Stroke {
+		return lines.Stroke{
+			BrushType: lines.BallpointV5,
+			Dots:      []lines.Dot{{X: x, Y: 10}, {X: x + 5, Y: 20}},
+		}
+	}
+	hl := stroke(100)
+	hl.BrushType = lines.HighlighterV5
+	l := lines.Layer{Strokes: []lines.Stroke{stroke(0), hl, stroke(200)}}
+
+	g, _ := ConvertLayer(0, 2, l)
+	assert.Equal(2, len(g.Strokes))
+	assert.Equal("2.0", g.Strokes[0].ID)
+	assert.Equal("2.2", g.Strokes[1].ID)
+
+	ref, ok := parseStrokeID(g.Strokes[1].ID)
+	assert.True(ok)
+	assert.Equal(lines.StrokeRef{Layer: 2, Stroke: 2}, ref)
+	_, ok = parseStrokeID("foo")
+	assert.False(ok)
+
+	// parts of an erased stroke refer to the source stroke
+	assert.Equal("2.2.1", strokeID(lines.StrokeRef{Layer: 2, Stroke: 2}, 1))
+	ref, ok = parseStrokeID("2.2.1")
+	assert.True(ok)
+	assert.Equal(lines.StrokeRef{Layer: 2, Stroke: 2}, ref)
+	_, ok = parseStrokeID("2.x")
+	assert.False(ok)
+}
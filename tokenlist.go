@@ -0,0 +1,216 @@
+package rescript
+
+import (
+	"strings"
+)
+
+// TokenList is a sequence of Tokens.
+//
+// The list keeps track of its first and last node.
+// Nodes can be changed with the methods of the list or of the Node itself;
+// either way, the list stays consistent.
+type TokenList struct {
+	first *Node
+	last  *Node
+}
+
+// NewTokenList creates a list with the given tokens.
+func NewTokenList(tokens ...*Token) *TokenList {
+	l := &TokenList{}
+	l.Append(tokens...)
+	return l
+}
+
+// TokenListFromNode creates a list from a chain of nodes.
+//
+// The given node can be any node in the chain; the list starts at the
+// first one. If n is nil, the list is empty.
+func TokenListFromNode(n *Node) *TokenList {
+	l := &TokenList{}
+	if n == nil {
+		return l
+	}
+	for n.Prev() != nil {
+		n = n.Prev()
+	}
+	l.first = n
+	for node := n; node != nil; node = node.Next() {
+		node.list = l
+		l.last = node
+	}
+	return l
+}
+
+// First returns the first node of the list or nil if the list is empty.
+func (l *TokenList) First() *Node {
+	return l.first
+}
+
+// Last returns the last node of the list or nil if the list is empty.
+func (l *TokenList) Last() *Node {
+	return l.last
+}
+
+// Len returns the number of tokens in the list.
+func (l *TokenList) Len() int {
+	count := 0
+	for node := l.first; node != nil; node = node.Next() {
+		count++
+	}
+	return count
+}
+
+// Tokens returns the tokens in the list as a slice.
+func (l *TokenList) Tokens() []*Token {
+	tokens := make([]*Token, 0)
+	for node := l.first; node != nil; node = node.Next() {
+		tokens = append(tokens, node.Token())
+	}
+	return tokens
+}
+
+// String returns the text of all tokens.
+func (l *TokenList) String() string {
+	var sb strings.Builder
+	for node := l.first; node != nil; node = node.Next() {
+		sb.WriteString(node.Token().String())
+	}
+	return sb.String()
+}
+
+// Append adds the given tokens to the end of the list.
+func (l *TokenList) Append(tokens ...*Token) {
+	for _, t := range tokens {
+		n := NewNode(t)
+		if l.last != nil {
+			l.last.InsertAfter(n)
+		} else {
+			n.list = l
+			l.first = n
+			l.last = n
+		}
+	}
+}
+
+// Find returns the first node whose token matches, or nil.
+func (l *TokenList) Find(match func(t *Token) bool) *Node {
+	for node := l.first; node != nil; node = node.Next() {
+		if match(node.Token()) {
+			return node
+		}
+	}
+	return nil
+}
+
+// Splice removes count tokens starting at index i and inserts the given
+// tokens in their place. It returns the removed tokens.
+//
+// Like with slices, i must not be larger than the length of the list.
+// If fewer than count tokens follow i, all of them are removed.
+func (l *TokenList) Splice(i, count int, tokens ...*Token) []*Token {
+	at := l.first
+	for j := 0; j < i; j++ {
+		if at == nil {
+			panic("rescript: splice index out of range")
+		}
+		at = at.Next()
+	}
+
+	removed := make([]*Token, 0, count)
+	for j := 0; j < count && at != nil; j++ {
+		next := at.Next()
+		removed = append(removed, at.Token())
+		at.Remove()
+		at = next
+	}
+
+	l.insertBefore(at, tokens)
+	return removed
+}
+
+// ReplaceRange replaces the nodes from first to last (inclusive)
+// with the given tokens.
+//
+// Both nodes must belong to this list and first must not come after last.
+// If no tokens are given, the range is removed.
+func (l *TokenList) ReplaceRange(first, last *Node, tokens ...*Token) {
+	if first.list != l || last.list != l {
+		panic("rescript: node does not belong to the list")
+	}
+	after := last.Next()
+	for node := first; node != after; {
+		next := node.Next()
+		node.Remove()
+		node = next
+	}
+	l.insertBefore(after, tokens)
+}
+
+// insertBefore inserts tokens before the given node,
+// or at the end of the list if the node is nil.
+func (l *TokenList) insertBefore(at *Node, tokens []*Token) {
+	if at == nil {
+		l.Append(tokens...)
+		return
+	}
+	for _, t := range tokens {
+		at.InsertBefore(NewNode(t))
+	}
+}
+
+// Iter returns an iterator over the nodes in the list.
+//
+// The list can be changed while iterating.
+// Nodes that are inserted after the current node will be visited.
+// If the current node is removed, the iteration continues with the node
+// that came after it.
+func (l *TokenList) Iter() *Iterator {
+	return &Iterator{list: l}
+}
+
+// Iterator visits the nodes of a TokenList in order.
+//
+//	it := l.Iter()
+//	for it.Next() {
+//		t := it.Token()
+//	}
+type Iterator struct {
+	list    *TokenList
+	current *Node
+	next    *Node
+	started bool
+}
+
+// Next advances to the next node.
+// It returns false when there are no more nodes.
+func (it *Iterator) Next() bool {
+	switch {
+	case !it.started:
+		it.started = true
+		it.current = it.list.first
+	case it.current == nil:
+		return false
+	case it.current.list == it.list:
+		it.current = it.current.Next()
+	case it.next != nil && it.next.list == it.list:
+		it.current = it.next
+	default:
+		it.current = nil
+	}
+
+	if it.current == nil {
+		return false
+	}
+	it.next = it.current.Next()
+	return true
+}
+
+// Node returns the current node.
+func (it *Iterator) Node() *Node {
+	return it.current
+}
+
+// Token returns the token of the current node.
+func (it *Iterator) Token() *Token {
+	return it.current.Token()
+}
@@ -0,0 +1,151 @@
+package rescript
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTokenList(t *testing.T) {
+	assert := assert.New(t)
+
+	l := NewTokenList()
+	assert.Equal(0, l.Len())
+	assert.Nil(l.First())
+	assert.Nil(l.Last())
+	assert.Empty(l.Tokens())
+
+	l = buildSampleList("foo", " ", "bar")
+	assert.Equal(3, l.Len())
+	assert.Equal("foo", l.First().Token().String())
+	assert.Equal("bar", l.Last().Token().String())
+	assert.Equal("foo bar", l.String())
+
+	tokens := l.Tokens()
+	assert.Equal(3, len(tokens))
+	assert.Equal("foo bar", NewTokenList(tokens...).String())
+
+	// changes through the Node API keep first and last up to date
+	l.First().InsertBefore(NewNode(NewToken(">")))
+	l.Last().InsertAfter(NewNode(NewToken("<")))
+	assert.Equal(">foo bar<", l.String())
+	assert.Equal(">", l.First().Token().String())
+	assert.Equal("<", l.Last().Token().String())
+
+	l.First().Remove()
+	l.Last().Remove()
+	assert.Equal("foo bar", l.String())
+	assert.Equal("foo", l.First().Token().String())
+	assert.Equal("bar", l.Last().Token().String())
+}
+
+func TestTokenListFind(t *testing.T) {
+	assert := assert.New(t)
+
+	l := buildSampleList("foo", " ", "bar", ".")
+	n := l.Find(func(t *Token) bool { return t.IsPunctuation() })
+	assert.Equal(".", n.Token().String())
+
+	n = l.Find(func(t *Token) bool { return t.IsNewline() })
+	assert.Nil(n)
+}
+
+func TestTokenListSplice(t *testing.T) {
+	assert := assert.New(t)
+
+	l := buildSampleList("a", "b", "c", "d")
+	removed := l.Splice(1, 2, NewToken("x"))
+	assert.Equal("axd", l.String())
+	assert.Equal(2, len(removed))
+	assert.Equal("b", removed[0].String())
+
+	// insert only
+	l.Splice(0, 0, NewToken("<"))
+	assert.Equal("<axd", l.String())
+	assert.Equal("<", l.First().Token().String())
+
+	// at the end
+	l.Splice(4, 0, NewToken(">"))
+	assert.Equal("<axd>", l.String())
+	assert.Equal(">", l.Last().Token().String())
+
+	// more than available
+	removed = l.Splice(3, 10)
+	assert.Equal("<ax", l.String())
+	assert.Equal(2, len(removed))
+	assert.Equal("x", l.Last().Token().String())
+
+	// everything
+	l.Splice(0, 3)
+	assert.Equal(0, l.Len())
+	assert.Nil(l.First())
+	assert.Nil(l.Last())
+
+	assert.Panics(func() { l.Splice(2, 0) })
+}
+
+func TestTokenListReplaceRange(t *testing.T) {
+	assert := assert.New(t)
+
+	l := buildSampleList("foo", "-", "\n", "bar", " ", "baz")
+	first := l.First()
+	last := first.Ahead(3)
+	l.ReplaceRange(first, last, NewToken("foobar"))
+	assert.Equal("foobar baz", l.String())
+	assert.Equal("foobar", l.First().Token().String())
+
+	l.ReplaceRange(l.Last(), l.Last())
+	assert.Equal("foobar ", l.String())
+	assert.Equal(" ", l.Last().Token().String())
+
+	other := buildSampleList("x")
+	assert.Panics(func() { l.ReplaceRange(other.First(), other.First()) })
+}
+
+func TestTokenListIter(t *testing.T) {
+	assert := assert.New(t)
+
+	l := buildSampleList("a", " ", "b", " ", "c")
+
+	var visited []string
+	it := l.Iter()
+	for it.Next() {
+		visited = append(visited, it.Token().String())
+		switch it.Token().String() {
+		case " ":
+			// remove the current node
+			it.Node().Remove()
+		case "b":
+			it.Node().InsertAfter(NewNode(NewToken("!")))
+		}
+	}
+	assert.Equal([]string{"a", " ", "b", "!", " ", "c"}, visited)
+	assert.Equal("ab!c", l.String())
+
+	it = NewTokenList().Iter()
+	assert.False(it.Next())
+	assert.False(it.Next())
+}
+
+func TestNodeFunc(t *testing.T) {
+	assert := assert.New(t)
+
+	// drops the first node and returns the second
+	f := NodeFunc(func(n *Node) *Node {
+		next := n.Next()
+		n.Remove()
+		return next
+	})
+
+	l := f(buildSampleList("a", "b", "c"))
+	assert.Equal("bc", l.String())
+	assert.Equal(2, l.Len())
+	assert.Equal("c", l.Last().Token().String())
+
+	l = NodeFunc(func(n *Node) *Node { return nil })(buildSampleList("a"))
+	assert.Equal(0, l.Len())
+
+	// any node of the chain
+	n := buildSampleList("a", "b", "c").Last()
+	assert.Equal("abc", TokenListFromNode(n).String())
+}